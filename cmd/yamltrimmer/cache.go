@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// ByteSize is a size in bytes, written in the configuration in a human-readable form like "100MB"
+type ByteSize int64
+
+// byteSizeUnits are the multipliers of the size units, all of them powers of 1024
+var byteSizeUnits = map[string]int64{
+	"":    1,
+	"B":   1,
+	"K":   1 << 10,
+	"KB":  1 << 10,
+	"KIB": 1 << 10,
+	"M":   1 << 20,
+	"MB":  1 << 20,
+	"MIB": 1 << 20,
+	"G":   1 << 30,
+	"GB":  1 << 30,
+	"GIB": 1 << 30,
+	"T":   1 << 40,
+	"TB":  1 << 40,
+	"TIB": 1 << 40,
+}
+
+// parseByteSize parses a size like "512", "100MB" or "1.5GiB"
+func parseByteSize(str string) (ByteSize, error) {
+	str = strings.TrimSpace(str)
+	end := strings.IndexFunc(str, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if end == -1 {
+		end = len(str)
+	}
+
+	number, err := strconv.ParseFloat(str[:end], 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size %q", str)
+	}
+	multiplier, ok := byteSizeUnits[strings.ToUpper(strings.TrimSpace(str[end:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q", str, str[end:])
+	}
+	return ByteSize(number * float64(multiplier)), nil
+}
+
+// UnmarshalYAML parses the human-readable size of the configuration
+func (size *ByteSize) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := parseByteSize(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	*size = parsed
+	return nil
+}
+
+// cacheEntry is a cached file together with its validators file
+type cacheEntry struct {
+	paths    []string
+	size     int64
+	lastUsed time.Time
+}
+
+// evictCache deletes the least recently used entries of the cache directory until its size is under the limit.
+// The recency of an entry is the last time its cached file was downloaded or used from the cache, as recorded in the index.
+// The files cached before the index go by the latest modification time of their files instead.
+func evictCache(cachePath string, maxSize ByteSize) error {
+	files, err := os.ReadDir(cachePath)
+	if err != nil {
+		return fmt.Errorf("failed to read cache directory: %w", err)
+	}
+	index, err := readCacheIndex(cachePath)
+	if err != nil {
+		return err
+	}
+
+	// Group the cached files with their validators files, and sum up the size of the cache
+	entries := map[string]*cacheEntry{}
+	var total int64
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			return fmt.Errorf("failed to stat cached file: %w", err)
+		}
+
+		// The index is part of the size of the cache, but it's never evicted
+		if file.Name() == indexFileName || file.Name() == indexLockFileName {
+			total += info.Size()
+			continue
+		}
+
+		name := strings.TrimSuffix(file.Name(), ".etag")
+		entry, ok := entries[name]
+		if !ok {
+			entry = &cacheEntry{}
+			entries[name] = entry
+		}
+		entry.paths = append(entry.paths, filepath.Join(cachePath, file.Name()))
+		entry.size += info.Size()
+		if info.ModTime().After(entry.lastUsed) {
+			entry.lastUsed = info.ModTime()
+		}
+		total += info.Size()
+	}
+	if total <= int64(maxSize) {
+		return nil
+	}
+	for name, entry := range entries {
+		if indexed, ok := index[name]; ok && !indexed.LastUsed.IsZero() {
+			entry.lastUsed = indexed.LastUsed
+		}
+	}
+
+	// Delete the least recently used entries first
+	sorted := make([]*cacheEntry, 0, len(entries))
+	for _, entry := range entries {
+		sorted = append(sorted, entry)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].lastUsed.Before(sorted[j].lastUsed)
+	})
+	var evicted []string
+	for _, entry := range sorted {
+		if total <= int64(maxSize) {
+			break
+		}
+		for _, path := range entry.paths {
+			logrus.Debugf("Evicting cached file: %s", path)
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("failed to evict cached file: %w", err)
+			}
+			evicted = append(evicted, filepath.Base(path))
+		}
+		total -= entry.size
+	}
+	return removeIndexEntries(cachePath, evicted)
+}
+
+// removeIndexEntries deletes the entries of the cached files from the index of the cache directory
+func removeIndexEntries(cachePath string, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	// Without an index, there is nothing to delete and no index to create
+	if _, err := os.Stat(filepath.Join(cachePath, indexFileName)); os.IsNotExist(err) {
+		return nil
+	}
+	return updateCacheIndex(cachePath, func(index cacheIndex) {
+		for _, name := range names {
+			delete(index, name)
+		}
+	})
+}
+
+// clearCache deletes the cached files of the given URLs with their validators files,
+// or all the files in the cache directory if all is set. It returns the number of deleted files.
+func clearCache(cachePath string, urls []string, all bool) (int, error) {
+	var paths []string
+	if all {
+		files, err := os.ReadDir(cachePath)
+		if os.IsNotExist(err) {
+			return 0, nil
+		} else if err != nil {
+			return 0, fmt.Errorf("failed to read cache directory: %w", err)
+		}
+		for _, file := range files {
+			if !file.IsDir() {
+				paths = append(paths, filepath.Join(cachePath, file.Name()))
+			}
+		}
+	} else {
+		for _, url := range urls {
+			paths = append(paths,
+				filepath.Join(cachePath, generateFileName(url, "")),
+				filepath.Join(cachePath, generateFileName(url, "etag")),
+				filepath.Join(cachePath, legacyFileName(url, "")),
+				filepath.Join(cachePath, legacyFileName(url, "etag")))
+		}
+	}
+
+	removed := 0
+	var names []string
+	for _, path := range paths {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return removed, fmt.Errorf("failed to delete cached file: %w", err)
+		}
+		logrus.Debugf("Deleted cached file: %s", path)
+		// The index is deleted with all the files, but it's not a cached file
+		if name := filepath.Base(path); name != indexFileName && name != indexLockFileName {
+			removed++
+			names = append(names, name)
+		}
+	}
+
+	// With all the files deleted, the index is gone too
+	if all {
+		return removed, nil
+	}
+	return removed, removeIndexEntries(cachePath, names)
+}
+
+// legacyFileName returns the name the cached file of a URL had before the names were readable, the MD5 hash of the URL
+func legacyFileName(url, extension string) string {
+	hash := fmt.Sprintf("%x", md5.Sum([]byte(url)))
+	if extension == "" {
+		return hash
+	}
+	return fmt.Sprintf("%s.%s", hash, extension)
+}
+
+// migrateLegacyCacheFiles renames the cached files of a URL with the legacy names to the current names,
+// so that the files cached by the earlier versions are still used
+func migrateLegacyCacheFiles(cachePath, url string) error {
+	for _, extension := range []string{"", "etag"} {
+		legacyPath := filepath.Join(cachePath, legacyFileName(url, extension))
+		currentPath := filepath.Join(cachePath, generateFileName(url, extension))
+		if _, err := os.Stat(legacyPath); err != nil {
+			continue
+		}
+		if _, err := os.Stat(currentPath); err == nil {
+			continue
+		}
+		logrus.Debugf("Renaming legacy cached file %s to %s", legacyPath, currentPath)
+		if err := os.Rename(legacyPath, currentPath); err != nil {
+			return fmt.Errorf("failed to rename legacy cached file: %w", err)
+		}
+	}
+	return nil
+}
+
+// cacheReportEntry is the cache result of a URL input in the cache report
+type cacheReportEntry struct {
+	URL string `json:"url"`
+	cacheResult
+}
+
+// writeCacheReport writes the cache results of the URL inputs read so far to the report file as JSON, in the order of the inputs
+func writeCacheReport(path string, inputs []string, downloader *downloader) error {
+	entries := []cacheReportEntry{}
+	downloader.mutex.Lock()
+	for _, input := range inputs {
+		if result, ok := downloader.cacheResults[input]; ok {
+			entries = append(entries, cacheReportEntry{URL: input, cacheResult: result})
+		}
+	}
+	downloader.mutex.Unlock()
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache report: %w", err)
+	}
+	if err := writeFileAtomic(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write cache report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func Test_parseByteSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected ByteSize
+		invalid  bool
+	}{
+		{input: "512", expected: 512},
+		{input: "10B", expected: 10},
+		{input: "100MB", expected: 100 << 20},
+		{input: "1.5 GiB", expected: 3 << 29},
+		{input: "2k", expected: 2048},
+		{input: "10XB", invalid: true},
+		{input: "MB", invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			size, err := parseByteSize(tt.input)
+			if tt.invalid {
+				if err == nil {
+					t.Errorf("expected an error, got %d", size)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to parse size: %v", err)
+			}
+			if size != tt.expected {
+				t.Errorf("unexpected size: %d, expected %d", size, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_ByteSize_yaml(t *testing.T) {
+	var cache CacheConfig
+	if err := yaml.Unmarshal([]byte("maxSize: 100MB\n"), &cache); err != nil {
+		t.Fatalf("failed to unmarshal cache config: %v", err)
+	}
+	if cache.MaxSize != 100<<20 {
+		t.Errorf("unexpected max size: %d", cache.MaxSize)
+	}
+
+	if err := yaml.Unmarshal([]byte("maxSize: lots\n"), &cache); err == nil || !strings.Contains(err.Error(), `invalid size "lots"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_evictCache(t *testing.T) {
+	cacheDir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+
+	// three entries of 150 bytes each, the first one is the oldest
+	names := []string{"first", "second", "third"}
+	for i, name := range names {
+		localFilePath := filepath.Join(cacheDir, generateFileName(name, ""))
+		etagFilePath := filepath.Join(cacheDir, generateFileName(name, "etag"))
+		if err := os.WriteFile(localFilePath, []byte(strings.Repeat("a", 100)), 0644); err != nil {
+			t.Fatalf("failed to write cached file: %v", err)
+		}
+		if err := os.WriteFile(etagFilePath, []byte(strings.Repeat("b", 50)), 0644); err != nil {
+			t.Fatalf("failed to write ETag file: %v", err)
+		}
+		modTime := start.Add(time.Duration(i) * time.Minute)
+		for _, filePath := range []string{localFilePath, etagFilePath} {
+			if err := os.Chtimes(filePath, modTime, modTime); err != nil {
+				t.Fatalf("failed to set the modification time: %v", err)
+			}
+		}
+	}
+
+	if err := evictCache(cacheDir, 350); err != nil {
+		t.Fatalf("failed to evict cache: %v", err)
+	}
+
+	for i, name := range names {
+		for _, extension := range []string{"", "etag"} {
+			_, err := os.Stat(filepath.Join(cacheDir, generateFileName(name, extension)))
+			if i == 0 && !os.IsNotExist(err) {
+				t.Errorf("expected the oldest entry to be evicted: %s %s", name, extension)
+			} else if i > 0 && err != nil {
+				t.Errorf("expected the entry to be kept: %s %s: %v", name, extension, err)
+			}
+		}
+	}
+}
+
+func Test_evictCache_lastUsed(t *testing.T) {
+	cacheDir := t.TempDir()
+	start := time.Now().Truncate(time.Second)
+
+	// three entries downloaded one after the other, the first one is the oldest
+	names := []string{"first", "second", "third"}
+	for i, name := range names {
+		useFakeClock(t, start.Add(time.Duration(i)*time.Minute))
+		localFilePath := filepath.Join(cacheDir, generateFileName(name, ""))
+		if err := os.WriteFile(localFilePath, []byte(strings.Repeat("a", 100)), 0644); err != nil {
+			t.Fatalf("failed to write cached file: %v", err)
+		}
+		if err := storeValidators(name, localFilePath, cacheValidators{ETag: `"v1"`}, nil); err != nil {
+			t.Fatalf("failed to store validators: %v", err)
+		}
+	}
+
+	// The first entry is used from the cache without downloading it
+	useFakeClock(t, start.Add(3*time.Minute))
+	if err := markUsed(filepath.Join(cacheDir, generateFileName("first", ""))); err != nil {
+		t.Fatalf("failed to mark the cached file used: %v", err)
+	}
+
+	// Evict a single entry, the least recently used one is the second
+	files, err := os.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatalf("failed to read cache directory: %v", err)
+	}
+	var total int64
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil {
+			t.Fatalf("failed to stat cached file: %v", err)
+		}
+		total += info.Size()
+	}
+	if err := evictCache(cacheDir, ByteSize(total-1)); err != nil {
+		t.Fatalf("failed to evict cache: %v", err)
+	}
+
+	for _, name := range names {
+		_, err := os.Stat(filepath.Join(cacheDir, generateFileName(name, "")))
+		if name == "second" && !os.IsNotExist(err) {
+			t.Errorf("expected the least recently used entry to be evicted: %s", name)
+		} else if name != "second" && err != nil {
+			t.Errorf("expected the entry to be kept: %s: %v", name, err)
+		}
+	}
+}
+
+func Test_clearCache(t *testing.T) {
+	cacheDir := t.TempDir()
+	urls := []string{"https://example.com/a.yaml", "https://example.com/b.yaml"}
+	for _, url := range urls {
+		for _, extension := range []string{"", "etag"} {
+			if err := os.WriteFile(filepath.Join(cacheDir, generateFileName(url, extension)), []byte("foo: bar\n"), 0644); err != nil {
+				t.Fatalf("failed to write cached file: %v", err)
+			}
+		}
+	}
+
+	// only the entries of the given URL are deleted
+	removed, err := clearCache(cacheDir, urls[:1], false)
+	if err != nil {
+		t.Fatalf("failed to clear cache: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("expected 2 removed files, got %d", removed)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, generateFileName(urls[0], ""))); !os.IsNotExist(err) {
+		t.Errorf("expected the cached file of %s to be deleted", urls[0])
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, generateFileName(urls[1], ""))); err != nil {
+		t.Errorf("expected the cached file of %s to be kept: %v", urls[1], err)
+	}
+
+	// everything else is deleted with all
+	removed, err = clearCache(cacheDir, nil, true)
+	if err != nil {
+		t.Fatalf("failed to clear cache: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("expected 2 removed files, got %d", removed)
+	}
+	if files, _ := os.ReadDir(cacheDir); len(files) != 0 {
+		t.Errorf("expected an empty cache directory, got %d files", len(files))
+	}
+}
+
+func Test_generateFileName(t *testing.T) {
+	tests := []struct {
+		url    string
+		prefix string
+		suffix string
+	}{
+		{url: "https://example.com/charts/values.yaml", prefix: "values-", suffix: ".yaml"},
+		{url: "https://example.com/charts/My Values_v2.JSON?ref=main", prefix: "my-values-v2-", suffix: ".json"},
+		{url: "https://example.com/", prefix: "", suffix: ""},
+	}
+
+	names := map[string]bool{}
+	for _, tt := range tests {
+		name := generateFileName(tt.url, "")
+		if name != generateFileName(tt.url, "") {
+			t.Errorf("the name of %s is not deterministic", tt.url)
+		}
+		if !strings.HasPrefix(name, tt.prefix) || !strings.HasSuffix(name, tt.suffix) || len(name) != len(tt.prefix)+32+len(tt.suffix) {
+			t.Errorf("unexpected name of %s: %s", tt.url, name)
+		}
+		if etagName := generateFileName(tt.url, "etag"); etagName != name+".etag" {
+			t.Errorf("unexpected validators file name of %s: %s", tt.url, etagName)
+		}
+		names[name] = true
+	}
+
+	// The same last path segment on different URLs gives different names
+	names[generateFileName("https://example.org/values.yaml", "")] = true
+	if len(names) != len(tests)+1 {
+		t.Errorf("expected distinct names for distinct URLs, got %v", names)
+	}
+}
+
+func Test_migrateLegacyCacheFiles(t *testing.T) {
+	cacheDir := t.TempDir()
+	url := "https://example.com/values.yaml"
+	for _, extension := range []string{"", "etag"} {
+		if err := os.WriteFile(filepath.Join(cacheDir, legacyFileName(url, extension)), []byte(extension), 0644); err != nil {
+			t.Fatalf("failed to write legacy cached file: %v", err)
+		}
+	}
+
+	if err := migrateLegacyCacheFiles(cacheDir, url); err != nil {
+		t.Fatalf("failed to migrate legacy cached files: %v", err)
+	}
+
+	for _, extension := range []string{"", "etag"} {
+		content, err := os.ReadFile(filepath.Join(cacheDir, generateFileName(url, extension)))
+		if err != nil || string(content) != extension {
+			t.Errorf("expected the legacy file to be renamed: %q, %v", string(content), err)
+		}
+		if _, err := os.Stat(filepath.Join(cacheDir, legacyFileName(url, extension))); !os.IsNotExist(err) {
+			t.Errorf("expected the legacy file to be gone: %v", err)
+		}
+	}
+}
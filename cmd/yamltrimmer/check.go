@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aliok/yamltrimmer/pkg/trimmer"
+)
+
+// checkOutput compares the trimmed content with the existing output file without writing it.
+// It prints the diff and returns false if the file would change, a missing file is the same as an empty one.
+// A compressed output file is compared decompressed.
+func checkOutput(output string, trimmedContent []byte, stdout io.Writer) (bool, error) {
+	if isStdout(output) {
+		return false, withExitCode(exitConfigError, fmt.Errorf("-check can't be used with the stdout output"))
+	}
+	existing, err := os.ReadFile(output)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read the output file: %w", err)
+	}
+	if existing, err = decompress(existing); err != nil {
+		return false, fmt.Errorf("failed to decompress the output file: %w", err)
+	}
+	if bytes.Equal(existing, trimmedContent) {
+		return true, nil
+	}
+
+	fmt.Fprintf(stdout, "%s is not up to date\n", output)
+	fmt.Fprint(stdout, unifiedDiff(output, output+" (trimmed)", existing, trimmedContent))
+	return false, nil
+}
+
+// checkDocuments is like checkOutput for the files of the documents in the output directory
+func checkDocuments(outputDir string, documents []trimmer.Document, stdout io.Writer) (bool, error) {
+	upToDate := true
+	for i, path := range documentPaths(outputDir, documents) {
+		documentUpToDate, err := checkOutput(path, documents[i].Content, stdout)
+		if err != nil {
+			return false, err
+		}
+		upToDate = upToDate && documentUpToDate
+	}
+	return upToDate, nil
+}
+
+// outdatedError is the error of the check mode when an output would change
+func outdatedError(upToDate bool, output string) error {
+	if upToDate {
+		return nil
+	}
+	return withExitCode(exitOutdated, fmt.Errorf("the output is not up to date, run without -check to update it: %s", output))
+}
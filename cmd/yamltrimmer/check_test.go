@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_runTrim_check(t *testing.T) {
+	configPath, outputPath := writeTestConfig(t)
+
+	// A missing output is not up to date
+	var stdout bytes.Buffer
+	err := runTrim([]string{"-config", configPath, "-check"}, &stdout)
+	if exitCode(err) != exitOutdated || !strings.Contains(err.Error(), "the output is not up to date") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+		t.Errorf("expected the output not to be written, got: %v", err)
+	}
+
+	// An up to date output passes
+	if err := os.WriteFile(outputPath, []byte("database:\n  host: localhost\n"), 0644); err != nil {
+		t.Fatalf("failed to write output file: %v", err)
+	}
+	stdout.Reset()
+	if err := runTrim([]string{"-config", configPath, "-check"}, &stdout); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("unexpected stdout: %s", stdout.String())
+	}
+
+	// A drifted output fails with a diff, and is left as it is
+	drifted := []byte("database:\n  host: remote\n")
+	if err := os.WriteFile(outputPath, drifted, 0644); err != nil {
+		t.Fatalf("failed to write output file: %v", err)
+	}
+	stdout.Reset()
+	err = runTrim([]string{"-config", configPath, "-check"}, &stdout)
+	if exitCode(err) != exitOutdated {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, expected := range []string{outputPath + " is not up to date", "-  host: remote", "+  host: localhost"} {
+		if !strings.Contains(stdout.String(), expected) {
+			t.Errorf("expected stdout to contain %q, got:\n%s", expected, stdout.String())
+		}
+	}
+	if content, err := os.ReadFile(outputPath); err != nil || !bytes.Equal(content, drifted) {
+		t.Errorf("expected the output to be left as it is: %q, %v", string(content), err)
+	}
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/aliok/yamltrimmer/pkg/trimmer"
+	"github.com/sirupsen/logrus"
+)
+
+// command is an operation of yamltrimmer, run as "yamltrimmer <name> [flags]"
+type command struct {
+	name        string
+	description string
+	run         func(args []string, stdout io.Writer) error
+}
+
+// commands returns the available commands, the first one is the default when no command is given
+func commands() []command {
+	return []command{
+		{name: "trim", description: "Trim the inputs using the rules of the configuration", run: runTrim},
+		{name: "list-paths", description: "Print the paths of all the values in the inputs", run: runListPaths},
+		{name: "validate", description: "Check the configuration without reading the inputs", run: runValidate},
+		{name: "cache", description: "Manage the cache of the downloaded inputs, \"cache clear\" deletes the cached files", run: runCache},
+		{name: "version", description: "Print the version information", run: runVersion},
+	}
+}
+
+// runCommand runs the command named by the first argument with the rest of the arguments.
+// Without a command name, like in "yamltrimmer -config config.yaml", the trim command is run.
+func runCommand(args []string, stdout io.Writer) error {
+	available := commands()
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return available[0].run(args, stdout)
+	}
+
+	for _, command := range available {
+		if command.name == args[0] {
+			return command.run(args[1:], stdout)
+		}
+	}
+	if args[0] == "help" {
+		printUsage(stdout)
+		return nil
+	}
+	printUsage(os.Stderr)
+	return withExitCode(exitConfigError, fmt.Errorf("unknown command %q", args[0]))
+}
+
+// printUsage prints the available commands
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: yamltrimmer [command] [flags]\n\nCommands:\n")
+	for _, command := range commands() {
+		fmt.Fprintf(w, "  %-12s %s\n", command.name, command.description)
+	}
+	fmt.Fprintf(w, "\nThe trim command is run when no command is given. Use \"yamltrimmer <command> -h\" for the flags of a command.\n")
+}
+
+// commonFlags are the flags shared by the commands that read the configuration
+type commonFlags struct {
+	flags       *flag.FlagSet
+	configPaths *stringList
+	mergeLists  *string
+	verbose     *bool
+	logFormat   *string
+	logLevel    *string
+
+	// The inline settings override the ones of the configuration file, which is not needed with them
+	input   *string
+	output  *string
+	include *stringList
+}
+
+// stringList is the value of a flag that can be given several times
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ", ")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// newFlagSet creates the flag set of a command, with the flags shared by the commands
+func newFlagSet(name string) (*flag.FlagSet, commonFlags) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	common := commonFlags{
+		flags:       flags,
+		configPaths: &stringList{},
+		mergeLists:  flags.String("merge-lists", listsReplace, "How the lists of the merged configuration files are merged: replace or append"),
+		verbose:     flags.Bool("verbose", false, "Enable verbose logging, the same as -log-level debug"),
+		logFormat:   flags.String("log-format", "text", "Format of the logs: text or json"),
+		logLevel:    flags.String("log-level", "info", "Level of the logs: debug, info, warn or error"),
+		input:       flags.String("input", "", "Input file or URL, overrides the inputs of the configuration file"),
+		output:      flags.String("output", "", "Output file, overrides the output of the configuration file"),
+		include:     &stringList{},
+	}
+	flags.Var(common.configPaths, "config", "Path or URL of the configuration file, config.yaml if not set. "+
+		"Can be given several times to merge the files in order, the later ones overriding the earlier ones")
+	flags.Var(common.include, "include", "Dotted path of a key to keep, can be given several times, overrides the rules of the configuration file")
+	return flags, common
+}
+
+// isSet checks if the flag is given on the command line
+func (common commonFlags) isSet(name string) bool {
+	set := false
+	common.flags.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// configFiles returns the paths of the configuration files given on the command line, or the default one
+func (common commonFlags) configFiles() []string {
+	if len(*common.configPaths) == 0 {
+		return []string{"config.yaml"}
+	}
+	return *common.configPaths
+}
+
+// usesConfigFile checks if the configuration is read from a file.
+// It's not when only the inline settings are given, without -config.
+func (common commonFlags) usesConfigFile() bool {
+	return common.isSet("config") || !(common.isSet("input") || common.isSet("output") || common.isSet("include"))
+}
+
+// applyInlineSettings overrides the configuration with the inline settings given on the command line
+func (common commonFlags) applyInlineSettings(config *Configuration) {
+	if common.isSet("input") {
+		config.Input = *common.input
+		config.Inputs = nil
+	}
+	if common.isSet("output") {
+		config.Output = *common.output
+		config.OutputDir = ""
+		config.Profiles = nil
+	}
+	if common.isSet("include") {
+		config.Include = nil
+		config.Paths = nil
+		for _, key := range *common.include {
+			config.Include = append(config.Include, trimmer.IncludeItem{Key: key})
+		}
+	}
+}
+
+// configureLogging sets the level and the format of the logs from the flags
+func (common commonFlags) configureLogging() error {
+	level, err := parseLogLevel(*common.logLevel, *common.verbose)
+	if err != nil {
+		return err
+	}
+	logrus.SetLevel(level)
+
+	switch *common.logFormat {
+	case "text":
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return fmt.Errorf("unsupported log format %q, expected text or json", *common.logFormat)
+	}
+	return nil
+}
+
+// parseLogLevel returns the logrus level for the -log-level flag, -verbose is an alias for the debug level
+func parseLogLevel(level string, verbose bool) (logrus.Level, error) {
+	if verbose {
+		return logrus.DebugLevel, nil
+	}
+	switch level {
+	case "debug":
+		return logrus.DebugLevel, nil
+	case "info":
+		return logrus.InfoLevel, nil
+	case "warn":
+		return logrus.WarnLevel, nil
+	case "error":
+		return logrus.ErrorLevel, nil
+	default:
+		return 0, fmt.Errorf("unsupported log level %q, expected debug, info, warn or error", level)
+	}
+}
+
+// loadConfiguration reads the configuration file given by the flags, overridden by the inline settings.
+// Only the settings for reading the inputs are validated if inputsOnly is set.
+func (common commonFlags) loadConfiguration(inputsOnly bool) (*Configuration, error) {
+	if err := common.configureLogging(); err != nil {
+		return nil, withExitCode(exitConfigError, err)
+	}
+
+	config := &Configuration{}
+	var err error
+	if common.usesConfigFile() {
+		if config, err = common.loadConfigurationFile(); err != nil {
+			return nil, err
+		}
+	} else {
+		logrus.Debugf("No configuration file, using the settings of the command line")
+	}
+	common.applyInlineSettings(config)
+
+	// Validate the configuration
+	if inputsOnly {
+		err = config.validateInputs()
+	} else if err = config.validate(); err != nil {
+		err = fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err != nil {
+		return nil, withExitCode(exitConfigError, fmt.Errorf("failed to parse configuration: %w", err))
+	}
+	logrus.Debugf("Parsed configuration: %+v", *config)
+	return config, nil
+}
+
+// loadConfigurationFile reads the configuration file given by the -config flag, without validating it
+func (common commonFlags) loadConfigurationFile() (*Configuration, error) {
+	if *common.mergeLists != listsReplace && *common.mergeLists != listsAppend {
+		return nil, withExitCode(exitConfigError, fmt.Errorf("unsupported -merge-lists %q, expected %q or %q", *common.mergeLists, listsReplace, listsAppend))
+	}
+
+	var absPaths []string
+	for _, configPath := range common.configFiles() {
+		logrus.Debugf("Configuration file path: %s", configPath)
+
+		// Resolve the relative path to an absolute path, URLs are used as they are
+		absPath := configPath
+		var err error
+		if !isURL(absPath) {
+			absPath, err = filepath.Abs(absPath)
+			if err != nil {
+				return nil, withExitCode(exitConfigError, fmt.Errorf("failed to resolve the configuration file path: %w", err))
+			}
+			logrus.Debugf("Resolved configuration file path: %s", absPath)
+		}
+		absPaths = append(absPaths, absPath)
+	}
+
+	config, err := readConfigurations(absPaths, *common.mergeLists == listsAppend)
+	if err != nil {
+		return nil, withExitCode(exitConfigError, fmt.Errorf("failed to parse configuration: %w", err))
+	}
+	return config, nil
+}
+
+// prepareCache resolves the cache path and creates the cache directory, if the cache is used
+func (config *Configuration) prepareCache() error {
+	if !hasURL(config.inputs()) || !config.Cache.Enabled {
+		return nil
+	}
+	logrus.Debugf("Cache enabled with path: %s", config.Cache.Path)
+
+	// resolve the cache path to an absolute path
+	absCachePath, err := filepath.Abs(config.Cache.Path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve the cache path: %w", err)
+	}
+	logrus.Debugf("Resolved cache path: %s", absCachePath)
+	config.Cache.Path = absCachePath
+
+	// create the cache directory, if it doesn't exist
+	if _, err := os.Stat(config.Cache.Path); os.IsNotExist(err) {
+		logrus.Debugf("Creating cache directory: %s", config.Cache.Path)
+		if err := os.MkdirAll(config.Cache.Path, 0755); err != nil {
+			return fmt.Errorf("failed to create cache directory: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to check cache directory: %w", err)
+	}
+	return nil
+}
+
+// runTrim trims the inputs and writes the output
+func runTrim(args []string, stdout io.Writer) error {
+	flags, common := newFlagSet("trim")
+	dryRun := flags.Bool("dry-run", false, "Print a summary of the trimming instead of writing the output")
+	diff := flags.Bool("diff", false, "Print a unified diff between the input and the trimmed output")
+	watch := flags.Bool("watch", false, "Trim again whenever one of the input files changes")
+	check := flags.Bool("check", false, "Fail with a diff if the output is not up to date, instead of writing it")
+	summary := flags.Bool("summary", false, "Log the sizes and the numbers of the kept and dropped keys after trimming")
+	stream := flags.Bool("stream", false, "Trim the documents of a single file or stdin input one at a time, using less memory for big inputs")
+	strictParse := flags.Bool("strict-parse", false, "Fail on duplicate keys in the input, like the strictParse option")
+	inverse := flags.Bool("inverse", false, "Write the values the rules drop instead of the ones they keep, like the inverse option")
+	noCache := flags.Bool("no-cache", false, "Download the inputs without the cache, even if the configuration enables it")
+	// Kept for backward compatibility, from before the list-paths and version commands
+	listPaths := flags.Bool("list-paths", false, "Print the paths of all the values in the input, like the list-paths command")
+	printVersion := flags.Bool("version", false, "Print the version information, like the version command")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if *printVersion {
+		return runVersion(nil, stdout)
+	}
+	if *listPaths {
+		return listPathsWith(common, stdout)
+	}
+
+	config, err := common.loadConfiguration(false)
+	if err != nil {
+		return err
+	}
+	if *strictParse {
+		config.StrictParse = true
+	}
+	if *inverse {
+		config.Inverse = true
+	}
+	if *noCache {
+		config.Cache.Enabled = false
+	}
+	if err := config.prepareCache(); err != nil {
+		return err
+	}
+	downloader, err := newDownloader(config.HTTP)
+	if err != nil {
+		return withExitCode(exitConfigError, fmt.Errorf("failed to create the HTTP client: %w", err))
+	}
+	downloader.maxInputSize = config.MaxInputSize
+
+	// Replace the placeholders of the outputs with the values of the first input
+	input := config.inputs()[0]
+	config.Output = expandOutputPath(config.Output, input)
+	for i := range config.Profiles {
+		config.Profiles[i].Output = expandOutputPath(config.Profiles[i].Output, input)
+	}
+
+	// resolve the output path to an absolute path
+	if config.Output != "" && !isStdout(config.Output) {
+		absOutputPath, err := filepath.Abs(config.Output)
+		if err != nil {
+			return fmt.Errorf("failed to resolve the output file path: %w", err)
+		}
+		logrus.Debugf("Resolved output file path: %s", absOutputPath)
+		config.Output = absOutputPath
+	}
+
+	if err := config.resolveProfileOutputs(); err != nil {
+		return err
+	}
+
+	if config.OutputDir != "" {
+		absOutputDir, err := filepath.Abs(config.OutputDir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve the output directory: %w", err)
+		}
+		logrus.Debugf("Resolved output directory: %s", absOutputDir)
+		config.OutputDir = absOutputDir
+	}
+
+	// Start tracking the input files before the first run, so that no change is missed
+	var watcher *fileWatcher
+	if *watch {
+		files := config.watchedFiles()
+		if len(files) == 0 {
+			return withExitCode(exitConfigError, fmt.Errorf("watch mode needs at least one file input"))
+		}
+		watcher = newFileWatcher(files)
+	}
+
+	if *summary && config.OutputDir != "" {
+		return withExitCode(exitConfigError, fmt.Errorf("-summary can't be used with outputDir"))
+	}
+
+	if *check && *watch {
+		return withExitCode(exitConfigError, fmt.Errorf("-check can't be used with -watch"))
+	}
+
+	if *stream {
+		if *dryRun || *diff || *check || *summary || *watch {
+			return withExitCode(exitConfigError, fmt.Errorf("-stream can't be used with -dry-run, -diff, -check, -summary or -watch"))
+		}
+		if err := config.checkStreaming(); err != nil {
+			return withExitCode(exitConfigError, err)
+		}
+	}
+
+	// SIGINT cancels the downloads and the trimming in progress, and stops watching
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *stream {
+		return streamInput(ctx, config, stdout)
+	}
+
+	options := runOptions{dryRun: *dryRun, diff: *diff, summary: *summary, check: *check}
+	if err := trimInputs(ctx, config, downloader, options, stdout); err != nil {
+		return err
+	}
+
+	if watcher != nil {
+		logrus.Infof("Watching %s for changes", strings.Join(watcher.files, ", "))
+		watcher.watch(ctx, watchInterval, func() {
+			logrus.Infof("Input changed, trimming again")
+			if err := trimInputs(ctx, config, downloader, options, stdout); err != nil {
+				logrus.Error(err)
+			}
+		})
+		logrus.Infof("Stopped watching")
+	}
+	return nil
+}
+
+// runListPaths prints the paths of all the values in the inputs
+func runListPaths(args []string, stdout io.Writer) error {
+	flags, common := newFlagSet("list-paths")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	return listPathsWith(common, stdout)
+}
+
+// listPathsWith prints the paths of the inputs of the configuration given by the flags.
+// It only needs the inputs, as it's used before writing the rules.
+func listPathsWith(common commonFlags, stdout io.Writer) error {
+	config, err := common.loadConfiguration(true)
+	if err != nil {
+		return err
+	}
+	if err := config.prepareCache(); err != nil {
+		return err
+	}
+	downloader, err := newDownloader(config.HTTP)
+	if err != nil {
+		return withExitCode(exitConfigError, fmt.Errorf("failed to create the HTTP client: %w", err))
+	}
+	downloader.maxInputSize = config.MaxInputSize
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return printPaths(ctx, config, downloader, stdout)
+}
+
+// runValidate checks the configuration, without reading the inputs
+func runValidate(args []string, stdout io.Writer) error {
+	flags, common := newFlagSet("validate")
+	sample := flags.String("sample", "", "Path to a sample input file every include rule has to match something in")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	config, err := common.loadConfiguration(false)
+	if err != nil {
+		return err
+	}
+	if *sample != "" {
+		if err := checkSample(config, *sample, stdout); err != nil {
+			return err
+		}
+	}
+	if !common.usesConfigFile() {
+		fmt.Fprintln(stdout, "Configuration is valid: command line settings")
+		return nil
+	}
+	fmt.Fprintf(stdout, "Configuration is valid: %s\n", strings.Join(common.configFiles(), ", "))
+	return nil
+}
+
+// checkSample checks every include rule of the configuration matches something in the sample input file,
+// printing the rules that matched nothing
+func checkSample(config *Configuration, sample string, stdout io.Writer) error {
+	content, err := os.ReadFile(sample)
+	if err != nil {
+		return withExitCode(exitConfigError, fmt.Errorf("failed to read sample file: %w", err))
+	}
+	unmatched, err := config.UnmatchedRules(content)
+	if err != nil {
+		return withExitCode(exitConfigError, fmt.Errorf("failed to validate the rules against %s: %w", sample, err))
+	}
+	for _, rule := range unmatched {
+		fmt.Fprintf(stdout, "Rule matched nothing in document %d: %s\n", rule.Document, rule.Path)
+	}
+	if len(unmatched) > 0 {
+		return withExitCode(exitConfigError, fmt.Errorf("%d rules matched nothing in the sample %s", len(unmatched), sample))
+	}
+	return nil
+}
+
+// runCache runs the cache operations, only "clear" for now
+func runCache(args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "clear" {
+		return withExitCode(exitConfigError, fmt.Errorf("unknown cache operation, usage: yamltrimmer cache clear [flags]"))
+	}
+
+	flags, common := newFlagSet("cache clear")
+	all := flags.Bool("all", false, "Delete all the files in the cache directory, not only the ones of the inputs")
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+
+	config, err := common.loadConfiguration(true)
+	if err != nil {
+		return err
+	}
+	if config.Cache.Path == "" {
+		return withExitCode(exitConfigError, fmt.Errorf("no cache path is configured and the cache is not enabled"))
+	}
+
+	var urls []string
+	for _, input := range config.inputs() {
+		if isURL(input) {
+			urls = append(urls, input)
+		}
+	}
+	removed, err := clearCache(config.Cache.Path, urls, *all)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Removed %d files from the cache: %s\n", removed, config.Cache.Path)
+	return nil
+}
+
+// runVersion prints the version information
+func runVersion(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("version", flag.ContinueOnError)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, versionString())
+	return nil
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aliok/yamltrimmer/pkg/trimmer"
+	"github.com/sirupsen/logrus"
+)
+
+// writeTestConfig writes a configuration trimming a file input to a file output, and returns its path
+func writeTestConfig(t *testing.T) (configPath, outputPath string) {
+	t.Helper()
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "input.yaml")
+	outputPath = filepath.Join(dir, "output.yaml")
+	configPath = filepath.Join(dir, "config.yaml")
+
+	if err := os.WriteFile(inputPath, []byte("database:\n  host: localhost\n  port: 5432\ncache:\n  enabled: true\n"), 0644); err != nil {
+		t.Fatalf("failed to write input file: %v", err)
+	}
+	config := "input: " + inputPath + "\noutput: " + outputPath + "\ninclude:\n  - key: database.host\n"
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return configPath, outputPath
+}
+
+func Test_runCommand(t *testing.T) {
+	configPath, outputPath := writeTestConfig(t)
+
+	tests := []struct {
+		name           string
+		args           []string
+		expectedStdout string
+		expectedOutput string
+		errorMessage   string
+	}{
+		{
+			name:           "trim",
+			args:           []string{"trim", "-config", configPath},
+			expectedOutput: "database:\n  host: localhost\n",
+		},
+		{
+			name:           "trim by default",
+			args:           []string{"-config", configPath},
+			expectedOutput: "database:\n  host: localhost\n",
+		},
+		{
+			name:           "trim streaming",
+			args:           []string{"trim", "-stream", "-config", configPath},
+			expectedOutput: "database:\n  host: localhost\n",
+		},
+		{
+			name:           "trim inverse",
+			args:           []string{"trim", "-inverse", "-config", configPath},
+			expectedOutput: "database:\n  port: 5432\ncache:\n  enabled: true\n",
+		},
+		{
+			name:         "streaming with diff",
+			args:         []string{"trim", "-stream", "-diff", "-config", configPath},
+			errorMessage: "-stream can't be used with -dry-run, -diff, -check, -summary or -watch",
+		},
+		{
+			name:           "list-paths",
+			args:           []string{"list-paths", "-config", configPath},
+			expectedStdout: "database.host\ndatabase.port\ncache.enabled\n",
+		},
+		{
+			name:           "validate",
+			args:           []string{"validate", "-config", configPath},
+			expectedStdout: "Configuration is valid: " + configPath + "\n",
+		},
+		{
+			name:           "version",
+			args:           []string{"version"},
+			expectedStdout: versionString() + "\n",
+		},
+		{
+			name:           "version flag",
+			args:           []string{"-version"},
+			expectedStdout: versionString() + "\n",
+		},
+		{
+			name:         "unsupported list merge",
+			args:         []string{"validate", "-config", configPath, "-merge-lists", "prepend"},
+			errorMessage: `unsupported -merge-lists "prepend", expected "replace" or "append"`,
+		},
+		{
+			name:         "unknown command",
+			args:         []string{"frobnicate"},
+			errorMessage: `unknown command "frobnicate"`,
+		},
+		{
+			name:         "unknown flag",
+			args:         []string{"validate", "-dry-run"},
+			errorMessage: "flag provided but not defined: -dry-run",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(outputPath)
+
+			var stdout bytes.Buffer
+			err := runCommand(tt.args, &stdout)
+			if tt.errorMessage != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMessage) {
+					t.Errorf("expected error containing %q, got: %v", tt.errorMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to run command: %v", err)
+			}
+
+			if stdout.String() != tt.expectedStdout {
+				t.Errorf("unexpected stdout:\nGot:\n%s\nExpected:\n%s", stdout.String(), tt.expectedStdout)
+			}
+			if tt.expectedOutput != "" {
+				output, err := os.ReadFile(outputPath)
+				if err != nil {
+					t.Fatalf("failed to read output file: %v", err)
+				}
+				if string(output) != tt.expectedOutput {
+					t.Errorf("unexpected output:\nGot:\n%s\nExpected:\n%s", string(output), tt.expectedOutput)
+				}
+			}
+		})
+	}
+}
+
+func Test_runTrim_noCache(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, "database:\n  host: localhost\n  port: 5432\n")
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	outputPath := filepath.Join(dir, "output.yaml")
+	configPath := filepath.Join(dir, "config.yaml")
+	config := "input: " + server.URL + "/input.yaml\noutput: " + outputPath + "\ncache:\n  enabled: true\n  path: " + cacheDir + "\ninclude:\n  - key: database.host\n"
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	// The input is downloaded every time, and nothing is cached
+	var stdout bytes.Buffer
+	for i := 0; i < 2; i++ {
+		if err := runCommand([]string{"trim", "-no-cache", "-config", configPath}, &stdout); err != nil {
+			t.Fatalf("failed to run command: %v", err)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+	if _, err := os.Stat(cacheDir); !os.IsNotExist(err) {
+		t.Errorf("expected no cache directory, got: %v", err)
+	}
+	output, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("failed to read output file: %v", err)
+	}
+	if expected := "database:\n  host: localhost\n"; string(output) != expected {
+		t.Errorf("unexpected output: %q, expected %q", output, expected)
+	}
+
+	// The configuration file isn't changed, the cache is used without the flag
+	if err := runCommand([]string{"trim", "-config", configPath}, &stdout); err != nil {
+		t.Fatalf("failed to run command: %v", err)
+	}
+	if entries, err := os.ReadDir(cacheDir); err != nil || len(entries) == 0 {
+		t.Errorf("expected the input to be cached: %v, %v", entries, err)
+	}
+	content, err := os.ReadFile(configPath)
+	if err != nil || string(content) != config {
+		t.Errorf("expected the configuration file to be unchanged: %q, %v", content, err)
+	}
+}
+
+func Test_loadConfiguration_inline(t *testing.T) {
+	configPath, outputPath := writeTestConfig(t)
+	inputPath := filepath.Join(filepath.Dir(configPath), "input.yaml")
+	overridePath := filepath.Join(filepath.Dir(configPath), "override.yaml")
+	if err := os.WriteFile(overridePath, []byte("include:\n  - key: cache\n"), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	tests := []struct {
+		name            string
+		args            []string
+		expectedInput   string
+		expectedOutput  string
+		expectedInclude []trimmer.IncludeItem
+	}{
+		{
+			name:            "without a configuration file",
+			args:            []string{"-input", inputPath, "-output", "-", "-include", "database.host", "-include", "cache"},
+			expectedInput:   inputPath,
+			expectedOutput:  "-",
+			expectedInclude: []trimmer.IncludeItem{{Key: "database.host"}, {Key: "cache"}},
+		},
+		{
+			name:            "overriding the configuration file",
+			args:            []string{"-config", configPath, "-include", "cache"},
+			expectedInput:   inputPath,
+			expectedOutput:  outputPath,
+			expectedInclude: []trimmer.IncludeItem{{Key: "cache"}},
+		},
+		{
+			name:            "merged configuration files",
+			args:            []string{"-config", configPath, "-config", overridePath, "-merge-lists", "append"},
+			expectedInput:   inputPath,
+			expectedOutput:  outputPath,
+			expectedInclude: []trimmer.IncludeItem{{Key: "database.host"}, {Key: "cache"}},
+		},
+		{
+			name:            "configuration file only",
+			args:            []string{"-config", configPath},
+			expectedInput:   inputPath,
+			expectedOutput:  outputPath,
+			expectedInclude: []trimmer.IncludeItem{{Key: "database.host"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags, common := newFlagSet("trim")
+			if err := parseFlags(flags, tt.args); err != nil {
+				t.Fatalf("failed to parse flags: %v", err)
+			}
+			config, err := common.loadConfiguration(false)
+			if err != nil {
+				t.Fatalf("failed to load configuration: %v", err)
+			}
+			if config.Input != tt.expectedInput || config.Output != tt.expectedOutput {
+				t.Errorf("unexpected input and output: %q, %q", config.Input, config.Output)
+			}
+			if !reflect.DeepEqual(config.Include, tt.expectedInclude) {
+				t.Errorf("unexpected include rules: %+v", config.Include)
+			}
+		})
+	}
+
+	// the inline settings are enough to trim
+	var stdout bytes.Buffer
+	if err := runCommand([]string{"-input", inputPath, "-output", "-", "-include", "database.host", "-include", "cache"}, &stdout); err != nil {
+		t.Fatalf("failed to run command: %v", err)
+	}
+	if expected := "database:\n  host: localhost\ncache:\n  enabled: true\n"; stdout.String() != expected {
+		t.Errorf("unexpected stdout:\n%s", stdout.String())
+	}
+}
+
+func Test_runValidate_invalid(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte("input: input.yaml\ninclude:\n  - key: foo\n"), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	if err := runValidate([]string{"-config", configPath}, &stdout); err == nil || !strings.Contains(err.Error(), "output: output is required") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_runValidate_sample(t *testing.T) {
+	configPath, _ := writeTestConfig(t)
+	samplePath := filepath.Join(t.TempDir(), "sample.yaml")
+	if err := os.WriteFile(samplePath, []byte("database:\n  port: 5432\n"), 0644); err != nil {
+		t.Fatalf("failed to write sample file: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	err := runValidate([]string{"-config", configPath, "-sample", samplePath}, &stdout)
+	if err == nil || !strings.Contains(err.Error(), "1 rules matched nothing in the sample") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if expected := "Rule matched nothing in document 0: database.host\n"; stdout.String() != expected {
+		t.Errorf("unexpected stdout: %q, expected %q", stdout.String(), expected)
+	}
+
+	// the input of the test configuration has all the keys
+	stdout.Reset()
+	inputPath := filepath.Join(filepath.Dir(configPath), "input.yaml")
+	if err := runValidate([]string{"-config", configPath, "-sample", inputPath}, &stdout); err != nil {
+		t.Errorf("failed to validate: %v", err)
+	}
+	if expected := "Configuration is valid: " + configPath + "\n"; stdout.String() != expected {
+		t.Errorf("unexpected stdout: %q, expected %q", stdout.String(), expected)
+	}
+}
+
+func Test_runCache_clear(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	if err := os.Mkdir(cacheDir, 0755); err != nil {
+		t.Fatalf("failed to create cache directory: %v", err)
+	}
+	url := "https://example.com/input.yaml"
+	for _, name := range []string{generateFileName(url, ""), generateFileName(url, "etag"), "other"} {
+		if err := os.WriteFile(filepath.Join(cacheDir, name), []byte("foo: bar\n"), 0644); err != nil {
+			t.Fatalf("failed to write cached file: %v", err)
+		}
+	}
+
+	configPath := filepath.Join(dir, "config.yaml")
+	config := "input: " + url + "\noutput: output.yaml\ncache:\n  enabled: true\n  path: " + cacheDir + "\n"
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	if err := runCommand([]string{"cache", "clear", "-config", configPath}, &stdout); err != nil {
+		t.Fatalf("failed to clear cache: %v", err)
+	}
+	expected := "Removed 2 files from the cache: " + cacheDir + "\n"
+	if stdout.String() != expected {
+		t.Errorf("unexpected stdout: %q, expected %q", stdout.String(), expected)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "other")); err != nil {
+		t.Errorf("expected the other file to be kept: %v", err)
+	}
+}
+
+func Test_parseLogLevel(t *testing.T) {
+	tests := []struct {
+		level    string
+		verbose  bool
+		expected logrus.Level
+	}{
+		{level: "debug", expected: logrus.DebugLevel},
+		{level: "info", expected: logrus.InfoLevel},
+		{level: "warn", expected: logrus.WarnLevel},
+		{level: "error", expected: logrus.ErrorLevel},
+		{level: "info", verbose: true, expected: logrus.DebugLevel},
+	}
+	for _, tt := range tests {
+		got, err := parseLogLevel(tt.level, tt.verbose)
+		if err != nil {
+			t.Fatalf("failed to parse log level %q: %v", tt.level, err)
+		}
+		if got != tt.expected {
+			t.Errorf("parseLogLevel(%q, %t) = %s, expected %s", tt.level, tt.verbose, got, tt.expected)
+		}
+	}
+
+	if _, err := parseLogLevel("trace", false); err == nil || !strings.Contains(err.Error(), `unsupported log level "trace"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around the changes
+const diffContext = 3
+
+// diffOp is a single line of an edit script: ' ' for an unchanged line, '-' for a removed and '+' for an added line
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// splitLines splits the content into lines, without the line endings
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// diffLines computes the shortest edit script between the lines using the Myers algorithm
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+
+	// trace[d] holds the furthest x reached on each diagonal k in [-d, d] with d edits, indexed by k+d
+	var trace [][]int
+	var prev []int
+	for d := 0; ; d++ {
+		cur := make([]int, 2*d+1)
+		done := false
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if d == 0 {
+				x = 0
+			} else if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+				// insertion, coming down from diagonal k+1
+				x = prev[k+1+d-1]
+			} else {
+				// deletion, coming right from diagonal k-1
+				x = prev[k-1+d-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			cur[k+d] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+		trace = append(trace, cur)
+		if done {
+			break
+		}
+		prev = cur
+	}
+
+	// Walk back through the trace to build the edit script in reverse
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := prev[prevK+d-1]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			ops = append(ops, diffOp{'+', b[prevY]})
+		} else {
+			ops = append(ops, diffOp{'-', a[prevX]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, diffOp{' ', a[x-1]})
+		x--
+		y--
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// hunkRange formats the range of a hunk header, an empty range refers to the line before it
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// unifiedDiff returns a line-based unified diff between the two contents, or an empty string if they are equal
+func unifiedDiff(fromName, toName string, from, to []byte) string {
+	ops := diffLines(splitLines(string(from)), splitLines(string(to)))
+
+	var out strings.Builder
+	i := 0
+	for i < len(ops) {
+		// Find the next change
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		// The hunk starts with the context before the change and ends at the first long enough unchanged run
+		start := max(i-diffContext, 0)
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			unchanged := end
+			for unchanged < len(ops) && ops[unchanged].kind == ' ' {
+				unchanged++
+			}
+			if unchanged == len(ops) || unchanged-end > 2*diffContext {
+				end = min(end+diffContext, len(ops))
+				break
+			}
+			end = unchanged
+		}
+
+		// The line numbers of the hunk start are the lines before it plus one
+		fromLine, toLine := 1, 1
+		for _, op := range ops[:start] {
+			if op.kind != '+' {
+				fromLine++
+			}
+			if op.kind != '-' {
+				toLine++
+			}
+		}
+		fromCount, toCount := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				fromCount++
+			}
+			if op.kind != '-' {
+				toCount++
+			}
+		}
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(fromLine, fromCount), hunkRange(toLine, toCount))
+		for _, op := range ops[start:end] {
+			fmt.Fprintf(&out, "%c%s\n", op.kind, op.line)
+		}
+		i = end
+	}
+	return out.String()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_unifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     string
+		to       string
+		expected string
+	}{
+		{
+			name:     "equal",
+			from:     "a: 1\nb: 2\n",
+			to:       "a: 1\nb: 2\n",
+			expected: "",
+		},
+		{
+			name: "removed keys",
+			from: "cache:\n  enabled: true\ndatabase:\n  host: localhost\n  port: 5432\nstatus: ready\n",
+			to:   "database:\n  host: localhost\n",
+			expected: strings.Join([]string{
+				"--- input",
+				"+++ output",
+				"@@ -1,6 +1,2 @@",
+				"-cache:",
+				"-  enabled: true",
+				" database:",
+				"   host: localhost",
+				"-  port: 5432",
+				"-status: ready",
+				"",
+			}, "\n"),
+		},
+		{
+			name: "separate hunks",
+			from: "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n",
+			to:   "x\nb\nc\nd\ne\nf\ng\nh\ni\ny\n",
+			expected: strings.Join([]string{
+				"--- input",
+				"+++ output",
+				"@@ -1,4 +1,4 @@",
+				"-a",
+				"+x",
+				" b",
+				" c",
+				" d",
+				"@@ -7,4 +7,4 @@",
+				" g",
+				" h",
+				" i",
+				"-j",
+				"+y",
+				"",
+			}, "\n"),
+		},
+		{
+			name: "everything removed",
+			from: "a\nb\n",
+			to:   "",
+			expected: strings.Join([]string{
+				"--- input",
+				"+++ output",
+				"@@ -1,2 +0,0 @@",
+				"-a",
+				"-b",
+				"",
+			}, "\n"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unifiedDiff("input", "output", []byte(tt.from), []byte(tt.to))
+			if got != tt.expected {
+				t.Errorf("unexpected diff:\nGot:\n%s\nExpected:\n%s", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,906 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mustNewDownloader creates a downloader, failing the test if that's not possible
+func mustNewDownloader(t *testing.T, config HTTPConfig) *downloader {
+	t.Helper()
+	d, err := newDownloader(config)
+	if err != nil {
+		t.Fatalf("failed to create downloader: %v", err)
+	}
+	return d
+}
+
+// useFakeClock replaces the clock used by the cache logic until the end of the test
+func useFakeClock(t *testing.T, fakeNow time.Time) {
+	t.Helper()
+	originalNow := now
+	now = func() time.Time { return fakeNow }
+	t.Cleanup(func() { now = originalNow })
+}
+
+func Test_checkCacheAndDownload_ttl(t *testing.T) {
+	// a server that doesn't send ETags
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("foo: bar\n"))
+	}))
+	defer server.Close()
+
+	ttl := time.Hour
+	tests := []struct {
+		name             string
+		elapsed          time.Duration
+		expectedRequests int
+	}{
+		{
+			name:             "fresh cache",
+			elapsed:          30 * time.Minute,
+			expectedRequests: 0,
+		},
+		{
+			name:             "stale cache",
+			elapsed:          2 * time.Hour,
+			expectedRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = 0
+			cacheDir := t.TempDir()
+			localFilePath := filepath.Join(cacheDir, generateFileName(server.URL, ""))
+
+			// populate the cache
+			if err := os.WriteFile(localFilePath, []byte("foo: cached\n"), 0644); err != nil {
+				t.Fatalf("failed to write cached file: %v", err)
+			}
+			stat, err := os.Stat(localFilePath)
+			if err != nil {
+				t.Fatalf("failed to stat cached file: %v", err)
+			}
+			useFakeClock(t, stat.ModTime().Add(tt.elapsed))
+
+			d := mustNewDownloader(t, HTTPConfig{})
+			if _, err := d.checkCacheAndDownload(context.Background(), server.URL, localFilePath, CacheConfig{TTL: ttl}, ""); err != nil {
+				t.Fatalf("failed to check cache and download: %v", err)
+			}
+
+			if requests != tt.expectedRequests {
+				t.Errorf("expected %d requests, got %d", tt.expectedRequests, requests)
+			}
+
+			content, err := os.ReadFile(localFilePath)
+			if err != nil {
+				t.Fatalf("failed to read cached file: %v", err)
+			}
+			expectedContent := "foo: cached\n"
+			if tt.expectedRequests > 0 {
+				expectedContent = "foo: bar\n"
+			}
+			if string(content) != expectedContent {
+				t.Errorf("unexpected cached content: %q, expected %q", string(content), expectedContent)
+			}
+		})
+	}
+}
+
+func Test_checkCacheAndDownload_cacheControl(t *testing.T) {
+	requests := 0
+	cacheControl := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Write([]byte("foo: bar\n"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name             string
+		cacheControl     string
+		ttl              time.Duration
+		elapsed          time.Duration
+		expectedRequests int
+		expectedCached   bool
+	}{
+		{
+			name:             "no-store",
+			cacheControl:     "no-store",
+			ttl:              time.Hour,
+			expectedRequests: 2,
+		},
+		{
+			name:             "fresh by max-age",
+			cacheControl:     "public, max-age=60",
+			elapsed:          30 * time.Second,
+			expectedRequests: 1,
+			expectedCached:   true,
+		},
+		{
+			name:             "stale by max-age",
+			cacheControl:     "max-age=60",
+			elapsed:          2 * time.Minute,
+			expectedRequests: 2,
+			expectedCached:   true,
+		},
+		{
+			name:             "max-age over the TTL",
+			cacheControl:     "max-age=60",
+			ttl:              time.Hour,
+			elapsed:          2 * time.Minute,
+			expectedRequests: 2,
+			expectedCached:   true,
+		},
+		{
+			name:             "no-cache over the TTL",
+			cacheControl:     "no-cache",
+			ttl:              time.Hour,
+			expectedRequests: 2,
+			expectedCached:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = 0
+			cacheControl = tt.cacheControl
+			localFilePath := filepath.Join(t.TempDir(), generateFileName(server.URL, ""))
+			start := time.Now()
+			useFakeClock(t, start)
+
+			// two downloads, the second one after the elapsed time
+			d := mustNewDownloader(t, HTTPConfig{})
+			for i, elapsed := range []time.Duration{0, tt.elapsed} {
+				useFakeClock(t, start.Add(elapsed))
+				result, err := d.checkCacheAndDownload(context.Background(), server.URL, localFilePath, CacheConfig{TTL: tt.ttl}, "")
+				if err != nil {
+					t.Fatalf("failed to check cache and download: %v", err)
+				}
+				content := result.content
+				if !tt.expectedCached && string(content) != "foo: bar\n" {
+					t.Errorf("download %d: unexpected content: %q", i, string(content))
+				}
+				if tt.expectedCached && content != nil {
+					t.Errorf("download %d: expected the content to be cached, got: %q", i, string(content))
+				}
+			}
+
+			if requests != tt.expectedRequests {
+				t.Errorf("expected %d requests, got %d", tt.expectedRequests, requests)
+			}
+			if _, err := os.Stat(localFilePath); (err == nil) != tt.expectedCached {
+				t.Errorf("unexpected cached file state, expected cached: %t, got: %v", tt.expectedCached, err)
+			}
+		})
+	}
+}
+
+func Test_checkCacheAndDownload_result(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("foo: bar\n"))
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	localFilePath := filepath.Join(cacheDir, generateFileName(server.URL, ""))
+	d := mustNewDownloader(t, HTTPConfig{})
+
+	// a 200 response is a miss, the 304 response of the next download is a hit, and a fresh cached file is a hit without a request
+	expected := []cacheResult{
+		{Status: cacheMiss, Source: sourceDownload},
+		{Status: cacheHit, Source: sourceNotModified},
+		{Status: cacheHit, Source: sourceFresh},
+	}
+	caches := []CacheConfig{{}, {}, {TTL: time.Hour}}
+	for i := range expected {
+		result, err := d.checkCacheAndDownload(context.Background(), server.URL, localFilePath, caches[i], "")
+		if err != nil {
+			t.Fatalf("failed to check cache and download: %v", err)
+		}
+		if result.Status != expected[i].Status || result.Source != expected[i].Source {
+			t.Errorf("download %d: unexpected result %s/%s, expected %s/%s", i, result.Status, result.Source, expected[i].Status, expected[i].Source)
+		}
+		d.recordCacheResult(server.URL, result)
+	}
+
+	// the report has the last result of every URL input
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+	if err := writeCacheReport(reportPath, []string{server.URL, "input.yaml"}, d); err != nil {
+		t.Fatalf("failed to write cache report: %v", err)
+	}
+	report, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("failed to read cache report: %v", err)
+	}
+	expectedReport := "[\n  {\n    \"url\": \"" + server.URL + "\",\n    \"status\": \"hit\",\n    \"source\": \"fresh\"\n  }\n]\n"
+	if string(report) != expectedReport {
+		t.Errorf("unexpected report:\n%s\nexpected:\n%s", report, expectedReport)
+	}
+}
+
+func Test_parseCacheControl(t *testing.T) {
+	seconds := func(n int) *time.Duration {
+		d := time.Duration(n) * time.Second
+		return &d
+	}
+	tests := []struct {
+		values   []string
+		expected cacheControl
+	}{
+		{values: nil, expected: cacheControl{}},
+		{values: []string{"no-store"}, expected: cacheControl{noStore: true}},
+		{values: []string{"Max-Age=300"}, expected: cacheControl{maxAge: seconds(300)}},
+		{values: []string{`max-age="10"`, "must-revalidate"}, expected: cacheControl{maxAge: seconds(10)}},
+		{values: []string{"max-age=300, no-cache"}, expected: cacheControl{maxAge: seconds(0)}},
+		{values: []string{"max-age=soon"}, expected: cacheControl{}},
+	}
+	for _, tt := range tests {
+		got := parseCacheControl(tt.values)
+		if got.noStore != tt.expected.noStore || (got.maxAge == nil) != (tt.expected.maxAge == nil) ||
+			(got.maxAge != nil && *got.maxAge != *tt.expected.maxAge) {
+			t.Errorf("parseCacheControl(%q) = %+v, expected %+v", tt.values, got, tt.expected)
+		}
+	}
+}
+
+func Test_checkCacheAndDownload_atomic(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v2"`)
+		w.Write([]byte("foo: bar\n"))
+	}))
+	defer server.Close()
+
+	for _, compress := range []bool{false, true} {
+		cacheDir := t.TempDir()
+		localFilePath := filepath.Join(cacheDir, generateFileName(server.URL, ""))
+		if err := os.WriteFile(localFilePath, []byte("foo: cached\n"), 0644); err != nil {
+			t.Fatalf("failed to write cached file: %v", err)
+		}
+		// A link to the earlier file keeps its content if the file is replaced, but not if it's rewritten in place
+		linkPath := filepath.Join(t.TempDir(), "earlier.yaml")
+		if err := os.Link(localFilePath, linkPath); err != nil {
+			t.Skipf("hard links are not supported: %v", err)
+		}
+
+		d := mustNewDownloader(t, HTTPConfig{})
+		if _, err := d.checkCacheAndDownload(context.Background(), server.URL, localFilePath, CacheConfig{Compress: compress}, ""); err != nil {
+			t.Fatalf("failed to check cache and download: %v", err)
+		}
+
+		if earlier, err := os.ReadFile(linkPath); err != nil || string(earlier) != "foo: cached\n" {
+			t.Errorf("expected the cached file to be replaced, not rewritten: %q, %v", earlier, err)
+		}
+		if content, err := readCachedFile(localFilePath); err != nil || string(content) != "foo: bar\n" {
+			t.Errorf("unexpected cached content: %q, %v", content, err)
+		}
+		if matches, _ := filepath.Glob(filepath.Join(cacheDir, ".*.tmp")); len(matches) > 0 {
+			t.Errorf("unexpected temporary files: %v", matches)
+		}
+	}
+}
+
+func Test_checkCacheAndDownload_lastModified(t *testing.T) {
+	lastModified := "Wed, 21 Oct 2015 07:28:00 GMT"
+
+	// a server that doesn't send ETags, but sends Last-Modified
+	var statuses []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			t.Errorf("unexpected If-None-Match header: %s", r.Header.Get("If-None-Match"))
+		}
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			statuses = append(statuses, http.StatusNotModified)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		statuses = append(statuses, http.StatusOK)
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write([]byte("foo: bar\n"))
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	localFilePath := filepath.Join(cacheDir, generateFileName(server.URL, ""))
+
+	// first download fills the cache, second one is not modified
+	d := mustNewDownloader(t, HTTPConfig{})
+	for i := 0; i < 2; i++ {
+		if _, err := d.checkCacheAndDownload(context.Background(), server.URL, localFilePath, CacheConfig{}, ""); err != nil {
+			t.Fatalf("failed to check cache and download: %v", err)
+		}
+	}
+
+	if len(statuses) != 2 || statuses[0] != http.StatusOK || statuses[1] != http.StatusNotModified {
+		t.Errorf("unexpected response statuses: %v", statuses)
+	}
+
+	if validators := storedValidators(localFilePath); validators.LastModified != lastModified || validators.ETag != "" {
+		t.Errorf("unexpected stored validators: %+v", validators)
+	}
+
+	content, err := os.ReadFile(localFilePath)
+	if err != nil {
+		t.Fatalf("failed to read cached file: %v", err)
+	}
+	if string(content) != "foo: bar\n" {
+		t.Errorf("unexpected cached content: %q", string(content))
+	}
+}
+
+func Test_checkCacheAndDownload_compress(t *testing.T) {
+	body := []byte(strings.Repeat("key: some value that repeats\n", 100))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	localFilePath := filepath.Join(cacheDir, generateFileName(server.URL, ""))
+
+	d := mustNewDownloader(t, HTTPConfig{})
+	if _, err := d.checkCacheAndDownload(context.Background(), server.URL, localFilePath, CacheConfig{Compress: true}, ""); err != nil {
+		t.Fatalf("failed to check cache and download: %v", err)
+	}
+
+	stat, err := os.Stat(localFilePath)
+	if err != nil {
+		t.Fatalf("failed to stat cached file: %v", err)
+	}
+	if stat.Size() >= int64(len(body)) {
+		t.Errorf("cached file is not smaller than the body: %d >= %d bytes", stat.Size(), len(body))
+	}
+
+	content, err := readCachedFile(localFilePath)
+	if err != nil {
+		t.Fatalf("failed to read cached file: %v", err)
+	}
+	if !bytes.Equal(content, body) {
+		t.Errorf("unexpected cached content: %q", string(content))
+	}
+
+	if validators := storedValidators(localFilePath); validators.ETag != `"v1"` {
+		t.Errorf("unexpected stored validators: %+v", validators)
+	}
+}
+
+func Test_checkCacheAndDownload_checksum(t *testing.T) {
+	body := "key: value\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	sum := sha256.Sum256([]byte(body))
+	checksum := hex.EncodeToString(sum[:])
+	d := mustNewDownloader(t, HTTPConfig{})
+
+	// A matching download is cached
+	cacheDir := t.TempDir()
+	localFilePath := filepath.Join(cacheDir, generateFileName(server.URL, ""))
+	if _, err := d.checkCacheAndDownload(context.Background(), server.URL, localFilePath, CacheConfig{}, strings.ToUpper(checksum)); err != nil {
+		t.Fatalf("failed to check cache and download: %v", err)
+	}
+	if content, err := os.ReadFile(localFilePath); err != nil || string(content) != body {
+		t.Errorf("unexpected cached content: %q, %v", string(content), err)
+	}
+
+	// A mismatching download fails and leaves the cached file as it is
+	if err := os.WriteFile(localFilePath, []byte("old: value\n"), 0644); err != nil {
+		t.Fatalf("failed to write cached file: %v", err)
+	}
+	mismatching := strings.Repeat("0", 64)
+	_, err := d.checkCacheAndDownload(context.Background(), server.URL, localFilePath, CacheConfig{}, mismatching)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch: expected sha256 "+mismatching+", got "+checksum) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if content, err := os.ReadFile(localFilePath); err != nil || string(content) != "old: value\n" {
+		t.Errorf("the cached file is replaced: %q, %v", string(content), err)
+	}
+
+	// Without the cache, the download is verified too
+	config := &Configuration{Input: server.URL, SHA256: mismatching}
+	if _, err := readInput(context.Background(), server.URL, config, d); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	config.SHA256 = checksum
+	if content, err := readInput(context.Background(), server.URL, config, d); err != nil || string(content) != body {
+		t.Errorf("unexpected content: %q, %v", string(content), err)
+	}
+}
+
+func Test_readCacheValidators(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected cacheValidators
+	}{
+		{
+			name:     "keyed format",
+			content:  "etag: '\"abc\"'\nlastModified: Wed, 21 Oct 2015 07:28:00 GMT\n",
+			expected: cacheValidators{ETag: `"abc"`, LastModified: "Wed, 21 Oct 2015 07:28:00 GMT"},
+		},
+		{
+			name:     "legacy raw ETag",
+			content:  `"abc"`,
+			expected: cacheValidators{ETag: `"abc"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "validators.etag")
+			if err := os.WriteFile(filePath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("failed to write validators file: %v", err)
+			}
+
+			if got := readCacheValidators(filePath); got != tt.expected {
+				t.Errorf("unexpected validators: %+v, expected %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_downloadFile_timeout(t *testing.T) {
+	// a server that is slower than the configured timeout
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+			w.Write([]byte("foo: bar\n"))
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	d := mustNewDownloader(t, HTTPConfig{Timeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	_, err := d.downloadFile(context.Background(), server.URL)
+	if err == nil {
+		t.Fatalf("expected a timeout error, got none")
+	}
+
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("expected a timeout error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("download took too long to time out: %s", elapsed)
+	}
+}
+
+func Test_downloadFile_canceled(t *testing.T) {
+	// a server that only responds after the download is canceled
+	started := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		select {
+		case <-time.After(5 * time.Second):
+			w.Write([]byte("foo: bar\n"))
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	d := mustNewDownloader(t, HTTPConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err := d.downloadFile(ctx, server.URL)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("download took too long to be canceled: %s", elapsed)
+	}
+}
+
+func Test_newHTTPClient_defaultTimeout(t *testing.T) {
+	client, err := newHTTPClient(HTTPConfig{})
+	if err != nil {
+		t.Fatalf("failed to create HTTP client: %v", err)
+	}
+	if client.Timeout != defaultTimeout {
+		t.Errorf("unexpected default timeout: %s", client.Timeout)
+	}
+}
+
+func Test_newTransport_proxy(t *testing.T) {
+	transport, err := newTransport(HTTPConfig{Proxy: "http://proxy.example.com:3128"})
+	if err != nil {
+		t.Fatalf("failed to create transport: %v", err)
+	}
+
+	req, err := http.NewRequest("GET", "https://example.com/input.yaml", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	proxyURL, err := transport.Proxy(req)
+	if err != nil {
+		t.Fatalf("failed to get proxy URL: %v", err)
+	}
+	if proxyURL == nil || proxyURL.String() != "http://proxy.example.com:3128" {
+		t.Errorf("unexpected proxy URL: %v", proxyURL)
+	}
+}
+
+func Test_downloadFile_tls(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("foo: bar\n"))
+	}))
+	defer server.Close()
+
+	caCertPath := filepath.Join(t.TempDir(), "ca.pem")
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caCertPath, caCert, 0644); err != nil {
+		t.Fatalf("failed to write CA certificate: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		config      HTTPConfig
+		expectError bool
+	}{
+		{name: "untrusted certificate", config: HTTPConfig{}, expectError: true},
+		{name: "CA certificate", config: HTTPConfig{CACertPath: caCertPath}},
+		{name: "skip verification", config: HTTPConfig{InsecureSkipVerify: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := mustNewDownloader(t, tt.config)
+			content, err := d.downloadFile(context.Background(), server.URL)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected an error for the untrusted certificate")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to download file: %v", err)
+			}
+			if string(content) != "foo: bar\n" {
+				t.Errorf("unexpected content: %q", string(content))
+			}
+		})
+	}
+}
+
+func Test_newDownloader_invalidCACert(t *testing.T) {
+	caCertPath := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caCertPath, []byte("not a certificate"), 0644); err != nil {
+		t.Fatalf("failed to write CA certificate: %v", err)
+	}
+	if _, err := newDownloader(HTTPConfig{CACertPath: caCertPath}); err == nil || !strings.Contains(err.Error(), "no PEM certificates found") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_downloadFile_headers(t *testing.T) {
+	t.Setenv("YAMLTRIMMER_TEST_TOKEN", "secret")
+
+	var receivedHeaders http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedHeaders = r.Header
+		w.Write([]byte("foo: bar\n"))
+	}))
+	defer server.Close()
+
+	d := mustNewDownloader(t, HTTPConfig{
+		Headers: map[string]string{
+			"Authorization": "Bearer ${YAMLTRIMMER_TEST_TOKEN}",
+			"X-API-Key":     "key",
+		},
+	})
+
+	if _, err := d.downloadFile(context.Background(), server.URL); err != nil {
+		t.Fatalf("failed to download file: %v", err)
+	}
+
+	if got := receivedHeaders.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("unexpected Authorization header: %q", got)
+	}
+	if got := receivedHeaders.Get("X-API-Key"); got != "key" {
+		t.Errorf("unexpected X-API-Key header: %q", got)
+	}
+}
+
+func Test_downloadFile_basicAuth(t *testing.T) {
+	t.Setenv("YAMLTRIMMER_TEST_PASSWORD", "secret")
+
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		w.Write([]byte("foo: bar\n"))
+	}))
+	defer server.Close()
+
+	d := mustNewDownloader(t, HTTPConfig{Username: "user", Password: "${YAMLTRIMMER_TEST_PASSWORD}"})
+	if _, err := d.downloadFile(context.Background(), server.URL); err != nil {
+		t.Fatalf("failed to download file: %v", err)
+	}
+	cacheDir := t.TempDir()
+	localFilePath := filepath.Join(cacheDir, generateFileName(server.URL, ""))
+	if _, err := d.checkCacheAndDownload(context.Background(), server.URL, localFilePath, CacheConfig{}, ""); err != nil {
+		t.Fatalf("failed to check cache and download: %v", err)
+	}
+
+	// The credentials can be in the URL too
+	userinfoURL := strings.Replace(server.URL, "http://", "http://user:secret@", 1)
+	if _, err := mustNewDownloader(t, HTTPConfig{}).downloadFile(context.Background(), userinfoURL); err != nil {
+		t.Fatalf("failed to download file: %v", err)
+	}
+
+	expected := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	if len(authorizations) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(authorizations))
+	}
+	for i, got := range authorizations {
+		if got != expected {
+			t.Errorf("unexpected Authorization header of request %d: %q", i, got)
+		}
+	}
+}
+
+func Test_downloadFile_followRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old.yaml" {
+			http.Redirect(w, r, "/new.yaml", http.StatusFound)
+			return
+		}
+		w.Write([]byte("foo: bar\n"))
+	}))
+	defer server.Close()
+
+	follow, noFollow := true, false
+	tests := []struct {
+		name            string
+		followRedirects *bool
+		errorMessage    string
+	}{
+		{name: "default", followRedirects: nil},
+		{name: "enabled", followRedirects: &follow},
+		{name: "disabled", followRedirects: &noFollow, errorMessage: "unexpected status code: 302"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := mustNewDownloader(t, HTTPConfig{FollowRedirects: tt.followRedirects})
+
+			content, err := d.downloadFile(context.Background(), server.URL+"/old.yaml")
+			cacheDir := t.TempDir()
+			localFilePath := filepath.Join(cacheDir, generateFileName(server.URL, ""))
+			_, cacheErr := d.checkCacheAndDownload(context.Background(), server.URL+"/old.yaml", localFilePath, CacheConfig{}, "")
+
+			if tt.errorMessage != "" {
+				for _, err := range []error{err, cacheErr} {
+					if err == nil || !strings.Contains(err.Error(), tt.errorMessage) {
+						t.Errorf("expected error containing %q, got: %v", tt.errorMessage, err)
+					}
+				}
+				return
+			}
+			if err != nil || string(content) != "foo: bar\n" {
+				t.Errorf("unexpected download: %q, %v", string(content), err)
+			}
+			if cacheErr != nil {
+				t.Errorf("failed to check cache and download: %v", cacheErr)
+			}
+		})
+	}
+}
+
+func Test_downloadFile_gzipEncoding(t *testing.T) {
+	body := "foo: bar\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// sent even though the request doesn't accept it, like some servers do
+		w.Header().Set("Content-Encoding", "gzip")
+		gzipWriter := gzip.NewWriter(w)
+		gzipWriter.Write([]byte(body))
+		gzipWriter.Close()
+	}))
+	defer server.Close()
+
+	// the custom header stops the transport from asking for and decompressing gzip itself
+	d := mustNewDownloader(t, HTTPConfig{Headers: map[string]string{"Accept-Encoding": "gzip"}})
+	content, err := d.downloadFile(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("failed to download file: %v", err)
+	}
+	if string(content) != body {
+		t.Errorf("unexpected content: %q", content)
+	}
+
+	cacheDir := t.TempDir()
+	localFilePath := filepath.Join(cacheDir, generateFileName(server.URL, ""))
+	if _, err := d.checkCacheAndDownload(context.Background(), server.URL, localFilePath, CacheConfig{}, ""); err != nil {
+		t.Fatalf("failed to download file: %v", err)
+	}
+	if cached, err := os.ReadFile(localFilePath); err != nil || string(cached) != body {
+		t.Errorf("unexpected cached content: %q, %v", cached, err)
+	}
+}
+
+func Test_downloadFile_maxInputSize(t *testing.T) {
+	body := strings.Repeat("foo: bar\n", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chunked":
+			// without a Content-Length, the size is only known by reading
+			w.Write([]byte(body[:len(body)/2]))
+			w.(http.Flusher).Flush()
+			w.Write([]byte(body[len(body)/2:]))
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			gzipWriter := gzip.NewWriter(w)
+			gzipWriter.Write([]byte(body))
+			gzipWriter.Close()
+		default:
+			w.Write([]byte(body))
+		}
+	}))
+	defer server.Close()
+
+	d := mustNewDownloader(t, HTTPConfig{Headers: map[string]string{"Accept-Encoding": "gzip"}})
+	d.maxInputSize = 512
+	for _, path := range []string{"/", "/chunked", "/gzip"} {
+		if _, err := d.downloadFile(context.Background(), server.URL+path); err == nil || !strings.Contains(err.Error(), "larger than the maximum input size of 512 bytes") {
+			t.Errorf("%s: unexpected error: %v", path, err)
+		}
+
+		localFilePath := filepath.Join(t.TempDir(), generateFileName(server.URL+path, ""))
+		if _, err := d.checkCacheAndDownload(context.Background(), server.URL+path, localFilePath, CacheConfig{}, ""); err == nil || !strings.Contains(err.Error(), "larger than the maximum input size of 512 bytes") {
+			t.Errorf("%s: unexpected error: %v", path, err)
+		}
+		if _, err := os.Stat(localFilePath); !os.IsNotExist(err) {
+			t.Errorf("%s: expected the oversized download not to be cached: %v", path, err)
+		}
+	}
+
+	// within the limit
+	d.maxInputSize = ByteSize(len(body))
+	if content, err := d.downloadFile(context.Background(), server.URL+"/chunked"); err != nil || string(content) != body {
+		t.Errorf("unexpected download: %d bytes, %v", len(content), err)
+	}
+
+	// the files are limited too
+	inputPath := filepath.Join(t.TempDir(), "input.yaml")
+	if err := os.WriteFile(inputPath, []byte(body), 0644); err != nil {
+		t.Fatalf("failed to write input file: %v", err)
+	}
+	config := &Configuration{MaxInputSize: 512}
+	if _, err := readInput(context.Background(), inputPath, config, d); err == nil || !strings.Contains(err.Error(), "larger than the maximum input size of 512 bytes") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_checkURL(t *testing.T) {
+	config := HTTPConfig{AllowedHosts: []string{"config.example.com", "*.cdn.example.com"}, AllowedSchemes: []string{"https"}}
+
+	tests := []struct {
+		url          string
+		errorMessage string
+	}{
+		{url: "https://config.example.com/values.yaml"},
+		{url: "https://EU.cdn.example.com:8443/values.yaml"},
+		{url: "https://example.com/values.yaml", errorMessage: "http.allowedHosts"},
+		{url: "https://169.254.169.254/latest/meta-data", errorMessage: "http.allowedHosts"},
+		{url: "http://config.example.com/values.yaml", errorMessage: "http.allowedSchemes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := config.checkURL(tt.url)
+			if tt.errorMessage == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.errorMessage != "" && (err == nil || !strings.Contains(err.Error(), tt.errorMessage)) {
+				t.Errorf("expected error containing %q, got: %v", tt.errorMessage, err)
+			}
+		})
+	}
+}
+
+func Test_downloadFile_disallowedRedirect(t *testing.T) {
+	server := httptest.NewServer(http.RedirectHandler("http://169.254.169.254/latest/meta-data", http.StatusFound))
+	defer server.Close()
+
+	d := mustNewDownloader(t, HTTPConfig{AllowedHosts: []string{"127.0.0.1"}})
+	if _, err := d.downloadFile(context.Background(), server.URL); err == nil || !strings.Contains(err.Error(), "http.allowedHosts") {
+		t.Errorf("expected the redirect to be rejected, got: %v", err)
+	}
+}
+
+func Test_downloadFile_retries(t *testing.T) {
+	tests := []struct {
+		name             string
+		failures         int
+		failureStatus    int
+		retries          int
+		expectError      bool
+		expectedRequests int
+	}{
+		{
+			name:             "succeeds after two server errors",
+			failures:         2,
+			failureStatus:    http.StatusServiceUnavailable,
+			retries:          3,
+			expectError:      false,
+			expectedRequests: 3,
+		},
+		{
+			name:             "gives up after the configured retries",
+			failures:         5,
+			failureStatus:    http.StatusInternalServerError,
+			retries:          2,
+			expectError:      true,
+			expectedRequests: 3,
+		},
+		{
+			name:             "client errors are not retried",
+			failures:         1,
+			failureStatus:    http.StatusNotFound,
+			retries:          3,
+			expectError:      true,
+			expectedRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests <= tt.failures {
+					w.WriteHeader(tt.failureStatus)
+					return
+				}
+				w.Write([]byte("foo: bar\n"))
+			}))
+			defer server.Close()
+
+			d := mustNewDownloader(t, HTTPConfig{Retries: tt.retries, RetryBackoff: time.Millisecond})
+			content, err := d.downloadFile(context.Background(), server.URL)
+			if tt.expectError && err == nil {
+				t.Errorf("expected an error, got none")
+			} else if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			} else if !tt.expectError && string(content) != "foo: bar\n" {
+				t.Errorf("unexpected content: %q", string(content))
+			}
+
+			if requests != tt.expectedRequests {
+				t.Errorf("expected %d requests, got %d", tt.expectedRequests, requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"flag"
+)
+
+// The exit codes of the failure categories, so that scripts can tell the failures apart
+const (
+	exitFailure       = 1
+	exitConfigError   = 2
+	exitDownloadError = 3
+	exitParseError    = 4
+	exitWriteError    = 5
+	exitOutdated      = 6
+)
+
+// exitError is an error with the exit code of its category, the message is the one of the wrapped error
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// withExitCode marks an error with the exit code of its category, a nil error stays nil
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// exitCode returns the exit code of the category of an error, or the generic one for the errors without a category
+func exitCode(err error) int {
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return exitFailure
+}
+
+// parseFlags parses the flags of a command, the invalid flags are configuration errors
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	return withExitCode(exitConfigError, flags.Parse(args))
+}
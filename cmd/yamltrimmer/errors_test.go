@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_exitCode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "input.yaml")
+	invalidPath := filepath.Join(dir, "invalid.yaml")
+	if err := os.WriteFile(inputPath, []byte("foo: bar\n"), 0644); err != nil {
+		t.Fatalf("failed to write input file: %v", err)
+	}
+	if err := os.WriteFile(invalidPath, []byte("foo: [bar\n"), 0644); err != nil {
+		t.Fatalf("failed to write input file: %v", err)
+	}
+
+	// writeConfig writes a configuration trimming the input to the output, and returns its path
+	writeConfig := func(name, input, output string) string {
+		configPath := filepath.Join(dir, name+".yaml")
+		config := fmt.Sprintf("input: %s\noutput: %s\ninclude:\n  - key: foo\n", input, output)
+		if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+			t.Fatalf("failed to write config file: %v", err)
+		}
+		return configPath
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected int
+	}{
+		{
+			name:     "unknown flag",
+			args:     []string{"trim", "-frobnicate"},
+			expected: exitConfigError,
+		},
+		{
+			name:     "missing configuration",
+			args:     []string{"trim", "-config", filepath.Join(dir, "missing.yaml")},
+			expected: exitConfigError,
+		},
+		{
+			name:     "download error",
+			args:     []string{"trim", "-config", writeConfig("download", server.URL+"/input.yaml", filepath.Join(dir, "output.yaml"))},
+			expected: exitDownloadError,
+		},
+		{
+			name:     "parse error",
+			args:     []string{"trim", "-config", writeConfig("parse", invalidPath, filepath.Join(dir, "output.yaml"))},
+			expected: exitParseError,
+		},
+		{
+			name:     "write error",
+			args:     []string{"trim", "-config", writeConfig("write", inputPath, filepath.Join(dir, "missing", "output.yaml"))},
+			expected: exitWriteError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := runCommand(tt.args, &stdout)
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			if code := exitCode(err); code != tt.expected {
+				t.Errorf("unexpected exit code %d for error: %v, expected %d", code, err, tt.expected)
+			}
+		})
+	}
+
+	if code := exitCode(errors.New("failure")); code != exitFailure {
+		t.Errorf("unexpected exit code for an error without a category: %d", code)
+	}
+	if err := runCommand([]string{"trim", "-h"}, &bytes.Buffer{}); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("expected the help error, got: %v", err)
+	}
+}
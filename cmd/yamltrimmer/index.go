@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// indexFileName is the file in the cache directory with the validators and the metadata of all the cached files
+const indexFileName = "index.json"
+
+// indexLockFileName is locked while the index is read or updated, so that the processes sharing the cache don't lose updates.
+// The index itself can't be locked, as it's replaced on every update.
+const indexLockFileName = "index.lock"
+
+// indexEntry is what the index stores about a cached file
+type indexEntry struct {
+	URL string `json:"url"`
+	cacheValidators
+	Downloaded time.Time `json:"downloaded"`
+
+	// LastUsed is the last time the cached file was downloaded or used from the cache, the recency the eviction goes by
+	LastUsed time.Time `json:"lastUsed"`
+
+	// Expires is the end of the freshness window given by the Cache-Control of the server, nil if it gave none
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// cacheIndex maps the names of the cached files, which have the hash of their URLs, to their entries
+type cacheIndex map[string]indexEntry
+
+// lockCacheIndex takes the lock of the index of the cache directory, waiting for the other holders to release it.
+// The returned function releases the lock.
+func lockCacheIndex(cachePath string) (func(), error) {
+	lockFile, err := os.OpenFile(filepath.Join(cachePath, indexLockFileName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the cache index lock: %w", err)
+	}
+	if err := lockExclusive(lockFile); err != nil {
+		lockFile.Close()
+		return nil, fmt.Errorf("failed to lock the cache index: %w", err)
+	}
+	return func() {
+		if err := unlock(lockFile); err != nil {
+			logrus.Debugf("Failed to unlock the cache index: %v", err)
+		}
+		lockFile.Close()
+	}, nil
+}
+
+// readCacheIndex reads the index of the cache directory, a missing index is an empty one
+func readCacheIndex(cachePath string) (cacheIndex, error) {
+	release, err := lockCacheIndex(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return readCacheIndexFile(cachePath), nil
+}
+
+// readCacheIndexFile reads the index without locking it.
+// A corrupt index is treated as an empty one, as it only makes the cached files download again.
+func readCacheIndexFile(cachePath string) cacheIndex {
+	index := cacheIndex{}
+	data, err := os.ReadFile(filepath.Join(cachePath, indexFileName))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.Warnf("Failed to read the cache index, ignoring it: %v", err)
+		}
+		return index
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		logrus.Warnf("Failed to parse the cache index, ignoring it: %v", err)
+		return cacheIndex{}
+	}
+	return index
+}
+
+// updateCacheIndex changes the index of the cache directory with the update function and writes it back, holding the lock all along
+func updateCacheIndex(cachePath string, update func(index cacheIndex)) error {
+	release, err := lockCacheIndex(cachePath)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	index := readCacheIndexFile(cachePath)
+	update(index)
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal the cache index: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(cachePath, indexFileName), data, 0644); err != nil {
+		return fmt.Errorf("failed to write the cache index: %w", err)
+	}
+	return nil
+}
+
+// storedValidators returns the validators of a cached file from the index
+func storedValidators(localFilePath string) cacheValidators {
+	return storedEntry(localFilePath).cacheValidators
+}
+
+// storedEntry returns the index entry of a cached file.
+// The files cached before the index have their validators in a file next to them, with the ".etag" extension.
+func storedEntry(localFilePath string) indexEntry {
+	index, err := readCacheIndex(filepath.Dir(localFilePath))
+	if err != nil {
+		logrus.Debugf("Failed to read the cache index: %v", err)
+	} else if entry, ok := index[filepath.Base(localFilePath)]; ok {
+		return entry
+	}
+	return indexEntry{cacheValidators: readCacheValidators(localFilePath + ".etag")}
+}
+
+// storeValidators records the validators and the freshness window of a downloaded file in the index,
+// replacing its legacy validators file if it has one
+func storeValidators(url, localFilePath string, validators cacheValidators, expires *time.Time) error {
+	err := updateCacheIndex(filepath.Dir(localFilePath), func(index cacheIndex) {
+		index[filepath.Base(localFilePath)] = indexEntry{URL: url, cacheValidators: validators, Downloaded: now(), LastUsed: now(), Expires: expires}
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(localFilePath + ".etag"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete the legacy validators file: %w", err)
+	}
+	return nil
+}
+
+// markUsed records in the index that a cached file is used now.
+// The files cached before the index have no entry, their recency stays the modification time of their files.
+func markUsed(localFilePath string) error {
+	name := filepath.Base(localFilePath)
+	return updateCacheIndex(filepath.Dir(localFilePath), func(index cacheIndex) {
+		if entry, ok := index[name]; ok {
+			entry.LastUsed = now()
+			index[name] = entry
+		}
+	})
+}
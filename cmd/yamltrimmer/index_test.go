@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_cacheIndex(t *testing.T) {
+	fakeNow := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	useFakeClock(t, fakeNow)
+
+	// a server with a different ETag for every path
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := fmt.Sprintf(`"%s-v1"`, filepath.Base(r.URL.Path))
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte("foo: bar\n"))
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	urls := []string{server.URL + "/a.yaml", server.URL + "/b.yaml", server.URL + "/c.yaml"}
+
+	// the downloads update the index at the same time
+	d := mustNewDownloader(t, HTTPConfig{})
+	var wg sync.WaitGroup
+	for _, url := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			localFilePath := filepath.Join(cacheDir, generateFileName(url, ""))
+			if _, err := d.checkCacheAndDownload(context.Background(), url, localFilePath, CacheConfig{}, ""); err != nil {
+				t.Errorf("failed to check cache and download %s: %v", url, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	index, err := readCacheIndex(cacheDir)
+	if err != nil {
+		t.Fatalf("failed to read cache index: %v", err)
+	}
+	if len(index) != len(urls) {
+		t.Errorf("expected %d index entries, got %d: %+v", len(urls), len(index), index)
+	}
+	for _, url := range urls {
+		entry, ok := index[generateFileName(url, "")]
+		expectedETag := fmt.Sprintf(`"%s-v1"`, filepath.Base(url))
+		if !ok || entry.URL != url || entry.ETag != expectedETag || !entry.Downloaded.Equal(fakeNow) {
+			t.Errorf("unexpected index entry of %s: %+v", url, entry)
+		}
+		if validators := storedValidators(filepath.Join(cacheDir, generateFileName(url, ""))); validators.ETag != expectedETag {
+			t.Errorf("unexpected stored validators of %s: %+v", url, validators)
+		}
+	}
+
+	// no validators files are written next to the cached files anymore
+	for _, url := range urls {
+		if _, err := os.Stat(filepath.Join(cacheDir, generateFileName(url, "etag"))); !os.IsNotExist(err) {
+			t.Errorf("unexpected validators file of %s: %v", url, err)
+		}
+	}
+}
+
+func Test_cacheIndex_legacyValidators(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Get("If-None-Match"))
+		w.Header().Set("ETag", `"v2"`)
+		w.Write([]byte("foo: baz\n"))
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	localFilePath := filepath.Join(cacheDir, generateFileName(server.URL, ""))
+	etagFilePath := filepath.Join(cacheDir, generateFileName(server.URL, "etag"))
+	if err := os.WriteFile(localFilePath, []byte("foo: bar\n"), 0644); err != nil {
+		t.Fatalf("failed to write cached file: %v", err)
+	}
+	if err := os.WriteFile(etagFilePath, []byte(`"v1"`), 0644); err != nil {
+		t.Fatalf("failed to write validators file: %v", err)
+	}
+
+	// the validators file of an earlier version is used, then replaced by the index
+	d := mustNewDownloader(t, HTTPConfig{})
+	if _, err := d.checkCacheAndDownload(context.Background(), server.URL, localFilePath, CacheConfig{}, ""); err != nil {
+		t.Fatalf("failed to check cache and download: %v", err)
+	}
+	if len(requests) != 1 || requests[0] != `"v1"` {
+		t.Errorf("expected the legacy ETag to be sent, got: %v", requests)
+	}
+	if _, err := os.Stat(etagFilePath); !os.IsNotExist(err) {
+		t.Errorf("expected the legacy validators file to be deleted: %v", err)
+	}
+	if validators := storedValidators(localFilePath); validators.ETag != `"v2"` {
+		t.Errorf("unexpected stored validators: %+v", validators)
+	}
+}
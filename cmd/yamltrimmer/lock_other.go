@@ -0,0 +1,15 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// lockExclusive does nothing where advisory locks are not supported, the processes sharing a cache may then lose the updates of each other
+func lockExclusive(file *os.File) error {
+	return nil
+}
+
+// unlock does nothing where advisory locks are not supported
+func unlock(file *os.File) error {
+	return nil
+}
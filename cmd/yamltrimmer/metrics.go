@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// runMetrics are the sizes of a run written to the metrics file
+type runMetrics struct {
+	inputBytes  int
+	outputBytes int
+}
+
+// writeMetrics writes the metrics of a run to the file, one "name value" line per metric.
+// The cache hit metric is 1 when all the cached URL inputs were cache hits, and is only written when there are any.
+func writeMetrics(path string, metrics runMetrics, inputs []string, downloader *downloader) error {
+	var content strings.Builder
+	fmt.Fprintf(&content, "yamltrimmer_input_bytes %d\n", metrics.inputBytes)
+	fmt.Fprintf(&content, "yamltrimmer_output_bytes %d\n", metrics.outputBytes)
+	fmt.Fprintf(&content, "yamltrimmer_last_run_timestamp %d\n", now().Unix())
+
+	downloader.mutex.Lock()
+	cached, hit := false, true
+	for _, input := range inputs {
+		if result, ok := downloader.cacheResults[input]; ok {
+			cached = true
+			hit = hit && result.Status == cacheHit
+		}
+	}
+	downloader.mutex.Unlock()
+	if cached {
+		value := 0
+		if hit {
+			value = 1
+		}
+		fmt.Fprintf(&content, "yamltrimmer_cache_hit %d\n", value)
+	}
+
+	// The file is replaced atomically, so that a scrape never reads it half written
+	if err := writeFileAtomic(path, []byte(content.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aliok/yamltrimmer/pkg/trimmer"
+)
+
+func Test_writeMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("name: remote\nkind: A\n"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	metricsPath := filepath.Join(dir, "yamltrimmer.prom")
+	config := &Configuration{Input: server.URL, Output: filepath.Join(dir, "output.yaml"), MetricsFile: metricsPath}
+	config.Cache = CacheConfig{Enabled: true, Path: filepath.Join(dir, "cache")}
+	config.Include = []trimmer.IncludeItem{{Key: "name"}}
+	if err := os.Mkdir(config.Cache.Path, 0755); err != nil {
+		t.Fatalf("failed to create cache directory: %v", err)
+	}
+	useFakeClock(t, time.Unix(1700000000, 0))
+	downloader := mustNewDownloader(t, config.HTTP)
+
+	// the first run downloads the input, the second one finds it not modified
+	for _, expectedHit := range []string{"0", "1"} {
+		var stdout bytes.Buffer
+		if err := trimInputs(context.Background(), config, downloader, runOptions{}, &stdout); err != nil {
+			t.Fatalf("failed to trim inputs: %v", err)
+		}
+
+		metrics, err := os.ReadFile(metricsPath)
+		if err != nil {
+			t.Fatalf("failed to read metrics file: %v", err)
+		}
+		expected := "yamltrimmer_input_bytes 21\n" +
+			"yamltrimmer_output_bytes 13\n" +
+			"yamltrimmer_last_run_timestamp 1700000000\n" +
+			"yamltrimmer_cache_hit " + expectedHit + "\n"
+		if string(metrics) != expected {
+			t.Errorf("unexpected metrics:\n%s\nexpected:\n%s", metrics, expected)
+		}
+	}
+
+	// without cached inputs, there is no cache hit metric
+	inputPath := filepath.Join(dir, "input.yaml")
+	if err := os.WriteFile(inputPath, []byte("name: local\n"), 0644); err != nil {
+		t.Fatalf("failed to write input file: %v", err)
+	}
+	config.Input = inputPath
+	var stdout bytes.Buffer
+	if err := trimInputs(context.Background(), config, mustNewDownloader(t, config.HTTP), runOptions{dryRun: true}, &stdout); err != nil {
+		t.Fatalf("failed to trim inputs: %v", err)
+	}
+	metrics, err := os.ReadFile(metricsPath)
+	if err != nil {
+		t.Fatalf("failed to read metrics file: %v", err)
+	}
+	expected := "yamltrimmer_input_bytes 12\nyamltrimmer_output_bytes 12\nyamltrimmer_last_run_timestamp 1700000000\n"
+	if string(metrics) != expected {
+		t.Errorf("unexpected metrics:\n%s\nexpected:\n%s", metrics, expected)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/aliok/yamltrimmer/pkg/trimmer"
+	"github.com/sirupsen/logrus"
+)
+
+// Profile is a set of rules with its own output, applied to the inputs shared by all the profiles
+type Profile struct {
+	Name         string                `yaml:"name,omitempty"`
+	Output       string                `yaml:"output"`
+	OutputFormat string                `yaml:"outputFormat,omitempty"`
+	Include      []trimmer.IncludeItem `yaml:"include,omitempty"`
+	Exclude      []trimmer.ExcludeItem `yaml:"exclude,omitempty"`
+}
+
+// name returns the name of the profile for the logs, or its output if it has no name
+func (profile Profile) name() string {
+	if profile.Name != "" {
+		return profile.Name
+	}
+	return profile.Output
+}
+
+// validateProfiles checks the profiles, the output and the rules of the configuration are in the profiles then
+func (config *Configuration) validateProfiles() error {
+	if config.Output != "" || config.OutputDir != "" {
+		return fmt.Errorf("profiles: output and outputDir can't be used together with profiles")
+	}
+	if len(config.Include) > 0 || len(config.Exclude) > 0 {
+		return fmt.Errorf("profiles: include and exclude rules can't be used together with profiles, move them into the profiles")
+	}
+
+	outputs := map[string]int{}
+	for i := range config.Profiles {
+		profile := &config.Profiles[i]
+		field := fmt.Sprintf("profiles[%d]", i)
+		if profile.Output == "" {
+			return fmt.Errorf("%s.output: output is required, use \"-\" for stdout", field)
+		}
+		if j, ok := outputs[profile.Output]; ok && !isStdout(profile.Output) {
+			return fmt.Errorf("%s.output: %s is already the output of profiles[%d]", field, profile.Output, j)
+		}
+		outputs[profile.Output] = i
+		if len(profile.Include) == 0 && len(profile.Exclude) == 0 {
+			return fmt.Errorf("%s.include: at least one include or exclude rule is required", field)
+		}
+		if err := validateOutputFormat(field+".outputFormat", profile.Output, &profile.OutputFormat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// profileConfiguration returns the configuration to trim the inputs with for a profile.
+// The options other than the rules and the output are shared by all the profiles.
+func (config *Configuration) profileConfiguration(profile Profile) *Configuration {
+	profileConfig := *config
+	profileConfig.Profiles = nil
+	profileConfig.Output = profile.Output
+	profileConfig.OutputFormat = profile.OutputFormat
+	profileConfig.Include = profile.Include
+	profileConfig.Paths = nil
+	profileConfig.Exclude = profile.Exclude
+	return &profileConfig
+}
+
+// resolveProfileOutputs resolves the outputs of the profiles to absolute paths
+func (config *Configuration) resolveProfileOutputs() error {
+	for i := range config.Profiles {
+		output := config.Profiles[i].Output
+		if isStdout(output) {
+			continue
+		}
+		absOutputPath, err := filepath.Abs(output)
+		if err != nil {
+			return fmt.Errorf("failed to resolve the output file path of profile %q: %w", config.Profiles[i].name(), err)
+		}
+		config.Profiles[i].Output = absOutputPath
+	}
+	return nil
+}
+
+// trimProfiles trims the input data read once with the rules of every profile, and writes each result to the output of the profile
+func trimProfiles(ctx context.Context, config *Configuration, content []byte, options runOptions, stdout io.Writer) error {
+	for _, profile := range config.Profiles {
+		logrus.Debugf("Trimming input data for profile %q", profile.name())
+		if err := trimContent(ctx, config.profileConfiguration(profile), content, options, stdout); err != nil {
+			return fmt.Errorf("profile %q: %w", profile.name(), err)
+		}
+	}
+	return nil
+}
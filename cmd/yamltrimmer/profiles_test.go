@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func Test_runTrim_profiles(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprint(w, "database:\n  host: localhost\n  port: 5432\ncache:\n  enabled: true\n")
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	databasePath := filepath.Join(dir, "database.yaml")
+	cachePath := filepath.Join(dir, "cache.json")
+	configPath := filepath.Join(dir, "config.yaml")
+	config := "input: " + server.URL + "/input.yaml\n" +
+		"profiles:\n" +
+		"  - name: database\n    output: " + databasePath + "\n    include:\n      - key: database.host\n" +
+		"  - output: " + cachePath + "\n    include:\n      - key: cache\n"
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	if err := runTrim([]string{"-config", configPath}, &stdout); err != nil {
+		t.Fatalf("failed to trim: %v", err)
+	}
+
+	if requests.Load() != 1 {
+		t.Errorf("expected the input to be downloaded once, got %d requests", requests.Load())
+	}
+	for path, expected := range map[string]string{
+		databasePath: "database:\n  host: localhost\n",
+		cachePath:    "{\n  \"cache\": {\n    \"enabled\": true\n  }\n}\n",
+	} {
+		output, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read output file: %v", err)
+		}
+		if string(output) != expected {
+			t.Errorf("unexpected output in %s:\nGot:\n%s\nExpected:\n%s", path, string(output), expected)
+		}
+	}
+}
+
+func Test_validateProfiles(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       string
+		errorMessage string
+	}{
+		{
+			name:         "output with profiles",
+			config:       "input: input.yaml\noutput: output.yaml\nprofiles:\n  - output: a.yaml\n    include:\n      - key: foo\n",
+			errorMessage: "profiles: output and outputDir can't be used together with profiles",
+		},
+		{
+			name:         "rules with profiles",
+			config:       "input: input.yaml\ninclude:\n  - key: foo\nprofiles:\n  - output: a.yaml\n    include:\n      - key: foo\n",
+			errorMessage: "profiles: include and exclude rules can't be used together with profiles",
+		},
+		{
+			name:         "missing output",
+			config:       "input: input.yaml\nprofiles:\n  - include:\n      - key: foo\n",
+			errorMessage: "profiles[0].output: output is required",
+		},
+		{
+			name:         "missing rules",
+			config:       "input: input.yaml\nprofiles:\n  - output: a.yaml\n",
+			errorMessage: "profiles[0].include: at least one include or exclude rule is required",
+		},
+		{
+			name:         "same output",
+			config:       "input: input.yaml\nprofiles:\n  - output: a.yaml\n    include:\n      - key: foo\n  - output: a.yaml\n    include:\n      - key: bar\n",
+			errorMessage: "profiles[1].output: a.yaml is already the output of profiles[0]",
+		},
+		{
+			name:         "unsupported output format",
+			config:       "input: input.yaml\nprofiles:\n  - output: a.yaml\n    outputFormat: toml\n    include:\n      - key: foo\n",
+			errorMessage: `profiles[0].outputFormat: unsupported format "toml"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.config), 0644); err != nil {
+				t.Fatalf("failed to write config file: %v", err)
+			}
+
+			_, err := parseConfiguration(configPath)
+			if err == nil || !strings.Contains(err.Error(), tt.errorMessage) {
+				t.Errorf("expected error containing %q, got: %v", tt.errorMessage, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aliok/yamltrimmer/pkg/trimmer"
+	"gopkg.in/yaml.v3"
+)
+
+// topLevelKeys returns the top-level keys of each document in the YAML content.
+// Documents that are not mappings have no keys.
+func topLevelKeys(content []byte) ([][]string, error) {
+	var keys [][]string
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var document yaml.Node
+		if err := decoder.Decode(&document); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse YAML: %w", err)
+		}
+
+		var documentKeys []string
+		if len(document.Content) > 0 && document.Content[0].Kind == yaml.MappingNode {
+			mapping := document.Content[0]
+			for i := 0; i < len(mapping.Content); i += 2 {
+				documentKeys = append(documentKeys, mapping.Content[i].Value)
+			}
+		}
+		keys = append(keys, documentKeys)
+	}
+	return keys, nil
+}
+
+// printDryRunSummary prints which top-level keys of the input are kept and dropped in the trimmed output,
+// and the size of the trimmed output
+func printDryRunSummary(w io.Writer, content, trimmedContent []byte) error {
+	inputKeys, err := topLevelKeys(content)
+	if err != nil {
+		return fmt.Errorf("failed to read the input keys: %w", err)
+	}
+	outputKeys, err := topLevelKeys(trimmedContent)
+	if err != nil {
+		return fmt.Errorf("failed to read the output keys: %w", err)
+	}
+
+	// Documents are matched by position, empty documents may have been dropped from the output
+	for i, documentKeys := range inputKeys {
+		kept := map[string]bool{}
+		if i < len(outputKeys) {
+			for _, key := range outputKeys[i] {
+				kept[key] = true
+			}
+		}
+
+		var keptKeys, droppedKeys []string
+		for _, key := range documentKeys {
+			if kept[key] {
+				keptKeys = append(keptKeys, key)
+			} else {
+				droppedKeys = append(droppedKeys, key)
+			}
+		}
+
+		if len(inputKeys) > 1 {
+			fmt.Fprintf(w, "Document %d:\n", i)
+		}
+		fmt.Fprintf(w, "Kept keys: %s\n", strings.Join(keptKeys, ", "))
+		fmt.Fprintf(w, "Dropped keys: %s\n", strings.Join(droppedKeys, ", "))
+	}
+	fmt.Fprintf(w, "Output size: %d bytes\n", len(trimmedContent))
+	return nil
+}
+
+// formatSummary describes how much of the input is kept in a single line
+func formatSummary(summary trimmer.Summary) string {
+	return fmt.Sprintf("Input: %d bytes, output: %d bytes, %.1f%% smaller. Kept %d keys, dropped %d keys",
+		summary.InputSize, summary.OutputSize, summary.Reduction(), summary.KeptKeys, summary.DroppedKeys())
+}
+
+// writeResult writes the trimmed content to the output, or only prints a summary in dry-run mode
+func writeResult(config *Configuration, content, trimmedContent []byte, dryRun bool, stdout io.Writer) error {
+	if dryRun {
+		return printDryRunSummary(stdout, content, trimmedContent)
+	}
+	return writeOutput(config.Output, trimmedContent, config.compressesOutput(), stdout)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aliok/yamltrimmer/pkg/trimmer"
+)
+
+func Test_writeResult_dryRun(t *testing.T) {
+	content := []byte("cache:\n  enabled: true\ndatabase:\n  host: localhost\nstatus: ready\n")
+	trimmedContent := []byte("database:\n  host: localhost\n")
+
+	config := &Configuration{Output: filepath.Join(t.TempDir(), "output.yaml")}
+
+	var stdout bytes.Buffer
+	if err := writeResult(config, content, trimmedContent, true, &stdout); err != nil {
+		t.Fatalf("failed to write result: %v", err)
+	}
+
+	if _, err := os.Stat(config.Output); !os.IsNotExist(err) {
+		t.Errorf("expected the output file not to be written, got: %v", err)
+	}
+
+	expected := "Kept keys: database\nDropped keys: cache, status\nOutput size: 28 bytes\n"
+	if stdout.String() != expected {
+		t.Errorf("unexpected summary:\nGot:\n%s\nExpected:\n%s", stdout.String(), expected)
+	}
+}
+
+func Test_printDryRunSummary_multipleDocuments(t *testing.T) {
+	content := []byte("name: first\nkind: A\n---\nname: second\nkind: B\n")
+	trimmedContent := []byte("name: first\n---\nkind: B\n")
+
+	var stdout bytes.Buffer
+	if err := printDryRunSummary(&stdout, content, trimmedContent); err != nil {
+		t.Fatalf("failed to print summary: %v", err)
+	}
+
+	expected := "Document 0:\nKept keys: name\nDropped keys: kind\nDocument 1:\nKept keys: kind\nDropped keys: name\nOutput size: 24 bytes\n"
+	if stdout.String() != expected {
+		t.Errorf("unexpected summary:\nGot:\n%s\nExpected:\n%s", stdout.String(), expected)
+	}
+}
+
+func Test_formatSummary(t *testing.T) {
+	summary := trimmer.Summary{InputSize: 200, OutputSize: 50, InputKeys: 12, KeptKeys: 3}
+	expected := "Input: 200 bytes, output: 50 bytes, 75.0% smaller. Kept 3 keys, dropped 9 keys"
+	if got := formatSummary(summary); got != expected {
+		t.Errorf("unexpected summary:\nGot:\n%s\nExpected:\n%s", got, expected)
+	}
+}
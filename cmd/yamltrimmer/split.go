@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/aliok/yamltrimmer/pkg/trimmer"
+	"github.com/sirupsen/logrus"
+)
+
+// unsafeFileNameChars are the characters replaced in the names of the output files
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// documentPaths returns the paths of the files the documents are written to in the output directory.
+// A document is named by its name field, or by its position if it has none. Colliding names get a numeric suffix.
+func documentPaths(outputDir string, documents []trimmer.Document) []string {
+	used := map[string]bool{}
+	paths := make([]string, 0, len(documents))
+	for i, document := range documents {
+		name := unsafeFileNameChars.ReplaceAllString(document.Name, "-")
+		if name == "" || name == "." || name == ".." {
+			name = fmt.Sprintf("document-%d", i)
+		}
+
+		candidate := name
+		for suffix := 1; used[candidate]; suffix++ {
+			candidate = fmt.Sprintf("%s-%d", name, suffix)
+		}
+		used[candidate] = true
+		paths = append(paths, filepath.Join(outputDir, candidate+"."+document.Format))
+	}
+	return paths
+}
+
+// writeDocuments writes every trimmed document to its own file in the output directory,
+// or only prints the paths of the files in dry-run mode
+func writeDocuments(outputDir string, documents []trimmer.Document, dryRun bool, stdout io.Writer) error {
+	paths := documentPaths(outputDir, documents)
+	if dryRun {
+		for i, path := range paths {
+			fmt.Fprintf(stdout, "Would write %s: %d bytes\n", path, len(documents[i].Content))
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	for i, path := range paths {
+		if err := writeFileAtomic(path, documents[i].Content, 0644); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+		logrus.Debugf("Output written successfully: %s", path)
+	}
+	return nil
+}
+
+// joinDocuments concatenates the trimmed documents like a single output would have them
+func joinDocuments(documents []trimmer.Document) []byte {
+	var content []byte
+	for i, document := range documents {
+		if i > 0 && document.Format == trimmer.FormatYAML {
+			content = append(content, []byte("---\n")...)
+		}
+		content = append(content, document.Content...)
+	}
+	return content
+}
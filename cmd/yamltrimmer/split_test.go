@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aliok/yamltrimmer/pkg/trimmer"
+)
+
+func Test_trimInputsToDir(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "input.yaml")
+	outputDir := filepath.Join(dir, "out")
+	input := `kind: Service
+metadata:
+  name: web
+  namespace: default
+---
+kind: Deployment
+metadata:
+  name: web
+---
+kind: ConfigMap
+metadata:
+  name: settings/v1
+---
+kind: Secret
+`
+	if err := os.WriteFile(inputPath, []byte(input), 0644); err != nil {
+		t.Fatalf("failed to write input file: %v", err)
+	}
+
+	config := &Configuration{Input: inputPath, OutputDir: outputDir, OutputName: "metadata.name"}
+	config.Include = []trimmer.IncludeItem{{Key: "kind"}}
+	var stdout bytes.Buffer
+	if err := trimInputs(context.Background(), config, mustNewDownloader(t, config.HTTP), runOptions{}, &stdout); err != nil {
+		t.Fatalf("failed to trim inputs: %v", err)
+	}
+
+	expected := map[string]string{
+		"web.yaml":         "kind: Service\n",
+		"web-1.yaml":       "kind: Deployment\n",
+		"settings-v1.yaml": "kind: ConfigMap\n",
+		"document-3.yaml":  "kind: Secret\n",
+	}
+	files, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatalf("failed to read output directory: %v", err)
+	}
+	if len(files) != len(expected) {
+		t.Errorf("expected %d files, got %d", len(expected), len(files))
+	}
+	for name, expectedContent := range expected {
+		content, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err != nil {
+			t.Errorf("failed to read output file: %v", err)
+			continue
+		}
+		if string(content) != expectedContent {
+			t.Errorf("unexpected content of %s: %q, expected %q", name, string(content), expectedContent)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import "fmt"
+
+// The build information, set at build time with
+// go build -ldflags "-X main.version=v1.0.0 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version = "dev"
+	commit  = "unknown"
+	date    = "unknown"
+)
+
+// versionString returns the build information printed by the -version flag
+func versionString() string {
+	return fmt.Sprintf("yamltrimmer %s (commit %s, built %s)", version, commit, date)
+}
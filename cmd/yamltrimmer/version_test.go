@@ -0,0 +1,14 @@
+package main
+
+import "testing"
+
+func Test_versionString(t *testing.T) {
+	if version == "" || commit == "" || date == "" {
+		t.Errorf("version variables must have defaults: version=%q commit=%q date=%q", version, commit, date)
+	}
+
+	expected := "yamltrimmer dev (commit unknown, built unknown)"
+	if got := versionString(); got != expected {
+		t.Errorf("unexpected version string: %q, expected %q", got, expected)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// watchInterval is how often the watched files are checked for changes
+const watchInterval = 500 * time.Millisecond
+
+// watchedFiles returns the inputs of the configuration that are local files
+func (config *Configuration) watchedFiles() []string {
+	var files []string
+	for _, input := range config.inputs() {
+		if !isStdin(input) && isFile(input) {
+			files = append(files, input)
+		}
+	}
+	return files
+}
+
+// fileWatcher polls files for changes of their modification times.
+// Polling works the same on every platform, without the need for file system notifications.
+type fileWatcher struct {
+	files    []string
+	modTimes map[string]time.Time
+}
+
+// newFileWatcher creates a watcher that reports the changes of the files made after it's created
+func newFileWatcher(files []string) *fileWatcher {
+	modTimes := map[string]time.Time{}
+	for _, file := range files {
+		modTimes[file] = modTime(file)
+	}
+	return &fileWatcher{files: files, modTimes: modTimes}
+}
+
+// watch calls onChange every time one of the files changes, until the context is done
+func (w *fileWatcher) watch(ctx context.Context, interval time.Duration, onChange func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed := false
+		for _, file := range w.files {
+			if current := modTime(file); !current.Equal(w.modTimes[file]) {
+				logrus.Debugf("File changed: %s", file)
+				w.modTimes[file] = current
+				changed = true
+			}
+		}
+		if changed {
+			onChange()
+		}
+	}
+}
+
+// modTime returns the modification time of the file, or the zero time if the file can't be read,
+// for example while an editor replaces it
+func modTime(file string) time.Time {
+	stat, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}
+	}
+	return stat.ModTime()
+}
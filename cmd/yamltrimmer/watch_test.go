@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aliok/yamltrimmer/pkg/trimmer"
+)
+
+func Test_fileWatcher(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "input.yaml")
+	outputPath := filepath.Join(dir, "output.yaml")
+	if err := os.WriteFile(inputPath, []byte("name: first\nkind: A\n"), 0644); err != nil {
+		t.Fatalf("failed to write input file: %v", err)
+	}
+
+	config := &Configuration{Input: inputPath, Output: outputPath}
+	config.Include = []trimmer.IncludeItem{{Key: "name"}}
+	downloader := mustNewDownloader(t, config.HTTP)
+	var stdout bytes.Buffer
+	if err := trimInputs(context.Background(), config, downloader, runOptions{}, &stdout); err != nil {
+		t.Fatalf("failed to trim inputs: %v", err)
+	}
+
+	watcher := newFileWatcher(config.watchedFiles())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watcher.watch(ctx, 10*time.Millisecond, func() {
+			if err := trimInputs(context.Background(), config, downloader, runOptions{}, &stdout); err != nil {
+				t.Errorf("failed to trim inputs: %v", err)
+			}
+		})
+	}()
+
+	// Change the input, with a modification time that surely differs from the previous one
+	if err := os.WriteFile(inputPath, []byte("name: second\nkind: B\n"), 0644); err != nil {
+		t.Fatalf("failed to write input file: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(inputPath, later, later); err != nil {
+		t.Fatalf("failed to change the modification time: %v", err)
+	}
+
+	expected := "name: second\n"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		output, err := os.ReadFile(outputPath)
+		if err == nil && string(output) == expected {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("output was not updated, got:\n%s\nExpected:\n%s", string(output), expected)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+}
@@ -1,365 +1,966 @@
 package main
 
 import (
-	"bytes"
-	"crypto/md5"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"net/http"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/aliok/yamltrimmer/pkg/trimmer"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 )
 
 type CacheConfig struct {
-	Enabled bool   `yaml:"enabled,omitempty"`
-	Path    string `yaml:"path,omitempty"`
+	Enabled bool          `yaml:"enabled,omitempty"`
+	Path    string        `yaml:"path,omitempty"`
+	TTL     time.Duration `yaml:"ttl,omitempty"`
+
+	// Compress stores the cached files compressed with gzip
+	Compress bool `yaml:"compress,omitempty"`
+
+	// MaxSize limits the size of the cache directory, the least recently used files are deleted beyond it
+	MaxSize ByteSize `yaml:"maxSize,omitempty"`
+
+	// Report is the path of a JSON file listing whether each URL input was a cache hit or miss
+	Report string `yaml:"report,omitempty"`
 }
 
-type IncludeConfigItem struct {
-	Key     string              `yaml:"key"`
-	Include []IncludeConfigItem `yaml:"include,omitempty"`
+type HTTPConfig struct {
+	Timeout      time.Duration     `yaml:"timeout,omitempty"`
+	Headers      map[string]string `yaml:"headers,omitempty"`
+	Retries      int               `yaml:"retries,omitempty"`
+	RetryBackoff time.Duration     `yaml:"retryBackoff,omitempty"`
+
+	// Concurrency is the number of inputs downloaded at the same time
+	Concurrency int `yaml:"concurrency,omitempty"`
+
+	// FollowRedirects is whether the redirects are followed, true if not set
+	FollowRedirects *bool `yaml:"followRedirects,omitempty"`
+
+	// Username and Password are sent with basic auth, environment variables like "${PASSWORD}" in them are expanded
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+
+	// AllowedHosts and AllowedSchemes limit the URLs that are downloaded, any URL is allowed if not set.
+	// The hosts can be glob patterns like "*.example.com".
+	AllowedHosts   []string `yaml:"allowedHosts,omitempty"`
+	AllowedSchemes []string `yaml:"allowedSchemes,omitempty"`
+
+	// Proxy is the URL of the proxy used for the downloads, instead of the one in the environment
+	Proxy              string `yaml:"proxy,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify,omitempty"`
+	CACertPath         string `yaml:"caCertPath,omitempty"`
 }
 
+// configVersion is the version of the configuration format, the only one supported
+const configVersion = "1"
+
 type Configuration struct {
-	Input   string              `yaml:"input"`
-	Output  string              `yaml:"output"`
-	Cache   CacheConfig         `yaml:"cache,omitempty"`
-	Include []IncludeConfigItem `yaml:"include"`
+	// Version is the version of the configuration format, the current one if it's not set
+	Version string `yaml:"version,omitempty"`
+
+	Input  string      `yaml:"input,omitempty"`
+	Inputs []string    `yaml:"inputs,omitempty"`
+	Output string      `yaml:"output,omitempty"`
+	Cache  CacheConfig `yaml:"cache,omitempty"`
+	HTTP   HTTPConfig  `yaml:"http,omitempty"`
+
+	// OutputDir splits the output into a file per document in the directory, instead of writing a single output.
+	// The files are named by the value at the dotted path OutputName in each input document.
+	OutputDir  string `yaml:"outputDir,omitempty"`
+	OutputName string `yaml:"outputName,omitempty"`
+
+	// SHA256 is the expected checksum of the downloaded input, a mismatching download is an error
+	SHA256 string `yaml:"sha256,omitempty"`
+
+	// CompressOutput writes the output compressed with gzip, which is the default for an output file ending in .gz.
+	// The files of the output directory are not compressed.
+	CompressOutput bool `yaml:"compressOutput,omitempty"`
+
+	// MetricsFile is the path of a file the metrics of every run are written to in the Prometheus text format,
+	// like for the textfile collector of the node exporter. It isn't written in the streaming mode.
+	MetricsFile string `yaml:"metricsFile,omitempty"`
+
+	// RecursiveInputs reads the YAML files in the nested directories of the input directories too
+	RecursiveInputs bool `yaml:"recursiveInputs,omitempty"`
+
+	// MaxInputSize limits the size of every input, the larger downloads, files and stdin fail without being read whole.
+	// The streaming mode doesn't read the input whole, so it isn't limited.
+	MaxInputSize ByteSize `yaml:"maxInputSize,omitempty"`
+
+	// Profiles trim the inputs, read only once, with several sets of rules each written to its own output
+	Profiles []Profile `yaml:"profiles,omitempty"`
+
+	// The trimming rules and options live next to the input and output settings in the configuration file
+	trimmer.Configuration `yaml:",inline"`
 }
 
+// parseConfiguration reads the configuration file and validates it for trimming
 func parseConfiguration(filePath string) (*Configuration, error) {
-	// Open the YAML file
-	file, err := os.Open(filePath)
+	config, err := readConfiguration(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("error opening file: %w", err)
+		return nil, err
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return config, nil
+}
+
+// readConfiguration reads the configuration file without validating it
+func readConfiguration(filePath string) (*Configuration, error) {
+	return readConfigurations([]string{filePath}, false)
+}
+
+// The merge policies of the lists of the configuration files
+const (
+	listsReplace = "replace"
+	listsAppend  = "append"
+)
+
+// readConfigurations reads the configuration files and merges them in order, without validating the result.
+// The mappings are merged deeply, and the other values of the later files replace the ones of the earlier files.
+// The lists, like the include rules, are replaced too, or appended to the earlier ones with appendLists.
+func readConfigurations(filePaths []string, appendLists bool) (*Configuration, error) {
+	var merged *yaml.Node
+	for _, filePath := range filePaths {
+		node, err := readConfigurationNode(filePath)
+		if err != nil {
+			// The file is named when there are several of them
+			if len(filePaths) > 1 {
+				err = fmt.Errorf("%s: %w", filePath, err)
+			}
+			return nil, err
+		}
+		if node != nil {
+			merged = mergeConfigurationNodes(merged, node, appendLists)
+		}
 	}
-	defer file.Close()
 
-	// TODO: doesn't handle missing fields and defaults
 	// Decode the YAML into the Configuration struct
 	var config Configuration
-	decoder := yaml.NewDecoder(file)
-	if err := decoder.Decode(&config); err != nil {
-		return nil, fmt.Errorf("error parsing YAML: %w", err)
+	if merged != nil {
+		if err := merged.Decode(&config); err != nil {
+			return nil, fmt.Errorf("error parsing YAML: %w", err)
+		}
+	}
+
+	if err := config.expandEnv(); err != nil {
+		return nil, err
 	}
 
 	return &config, nil
 }
 
-// isURL checks if a string is a valid URL
-func isURL(str string) bool {
-	// Simple check for URL (could be more comprehensive)
-	return strings.HasPrefix(str, "http://") || strings.HasPrefix(str, "https://")
+// readConfigurationNode reads and parses a configuration file, it returns nil for an empty file
+func readConfigurationNode(filePath string) (*yaml.Node, error) {
+	content, err := readConfigurationFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("error parsing YAML: %w", err)
+	}
+	if len(document.Content) == 0 {
+		return nil, nil
+	}
+	return document.Content[0], nil
 }
 
-// isFile checks if a string is a valid file path
-func isFile(str string) bool {
-	// Check if the input string is a valid file path
-	_, err := os.Stat(str)
-	return err == nil && !isURL(str)
+// mergeConfigurationNodes merges the override configuration into the base one, both nil or parsed YAML values
+func mergeConfigurationNodes(base, override *yaml.Node, appendLists bool) *yaml.Node {
+	switch {
+	case base == nil:
+		return override
+	case base.Kind == yaml.MappingNode && override.Kind == yaml.MappingNode:
+		merged := *base
+		merged.Content = append([]*yaml.Node{}, base.Content...)
+		for i := 0; i+1 < len(override.Content); i += 2 {
+			key, value := override.Content[i], override.Content[i+1]
+			found := false
+			for j := 0; j+1 < len(merged.Content); j += 2 {
+				if merged.Content[j].Value == key.Value {
+					merged.Content[j+1] = mergeConfigurationNodes(merged.Content[j+1], value, appendLists)
+					found = true
+					break
+				}
+			}
+			if !found {
+				merged.Content = append(merged.Content, key, value)
+			}
+		}
+		return &merged
+	case base.Kind == yaml.SequenceNode && override.Kind == yaml.SequenceNode && appendLists:
+		merged := *override
+		merged.Content = append(append([]*yaml.Node{}, base.Content...), override.Content...)
+		return &merged
+	default:
+		return override
+	}
 }
 
-func downloadFile(url string) ([]byte, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("error downloading file: %w", err)
+// readConfigurationFile reads the configuration from a local file or downloads it from a URL.
+// The HTTP settings are part of the configuration, so the download uses the default ones.
+func readConfigurationFile(filePath string) ([]byte, error) {
+	if !isURL(filePath) {
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("error opening file: %w", err)
+		}
+		return content, nil
 	}
-	defer resp.Body.Close()
 
-	// Read the body of the response
-	fileData, err := io.ReadAll(resp.Body)
+	downloader, err := newDownloader(HTTPConfig{})
 	if err != nil {
-		return nil, fmt.Errorf("error reading file body: %w", err)
+		return nil, fmt.Errorf("failed to create the HTTP client: %w", err)
 	}
-
-	return fileData, nil
+	content, err := downloader.downloadFile(context.Background(), filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download the configuration: %w", err)
+	}
+	return content, nil
 }
 
-func checkCacheAndDownload(url, localFilePath, etagFilePath string) error {
-	// Read the stored ETag from the file (if it exists)
-	var storedEtag string
-	if etagFile, err := os.ReadFile(etagFilePath); err == nil {
-		storedEtag = string(etagFile)
+// expandEnv expands the ${VAR} and $VAR references in the paths and URLs of the configuration.
+// Undefined variables expand to an empty string, or are an error in strict mode.
+func (config *Configuration) expandEnv() error {
+	var err error
+	if config.Input, err = expandEnv("input", config.Input, config.Strict); err != nil {
+		return err
+	}
+	for i := range config.Inputs {
+		if config.Inputs[i], err = expandEnv(fmt.Sprintf("inputs[%d]", i), config.Inputs[i], config.Strict); err != nil {
+			return err
+		}
+	}
+	if config.Output, err = expandEnv("output", config.Output, config.Strict); err != nil {
+		return err
+	}
+	if config.OutputDir, err = expandEnv("outputDir", config.OutputDir, config.Strict); err != nil {
+		return err
+	}
+	for i := range config.Profiles {
+		if config.Profiles[i].Output, err = expandEnv(fmt.Sprintf("profiles[%d].output", i), config.Profiles[i].Output, config.Strict); err != nil {
+			return err
+		}
+	}
+	if config.Cache.Path, err = expandEnv("cache.path", config.Cache.Path, config.Strict); err != nil {
+		return err
 	}
+	if config.Cache.Report, err = expandEnv("cache.report", config.Cache.Report, config.Strict); err != nil {
+		return err
+	}
+	if config.MetricsFile, err = expandEnv("metricsFile", config.MetricsFile, config.Strict); err != nil {
+		return err
+	}
+	return nil
+}
 
-	// Create a new HTTP request with the stored ETag
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create HTTP request: %w", err)
+// expandEnv expands the environment variable references in the value of the given field
+func expandEnv(field, value string, strict bool) (string, error) {
+	var undefined []string
+	expanded := os.Expand(value, func(name string) string {
+		variable, ok := os.LookupEnv(name)
+		if !ok {
+			undefined = append(undefined, name)
+		}
+		return variable
+	})
+	if strict && len(undefined) > 0 {
+		return "", fmt.Errorf("%s: undefined environment variables: %s", field, strings.Join(undefined, ", "))
 	}
+	return expanded, nil
+}
 
-	if storedEtag != "" {
-		req.Header.Set("If-None-Match", storedEtag)
+// validate checks the required fields of the configuration and fills in the defaults of the missing ones
+func (config *Configuration) validate() error {
+	// The other fields may mean something else in another version, so it is checked first
+	if config.Version != "" && config.Version != configVersion {
+		return fmt.Errorf("version: unsupported version %q, expected %q", config.Version, configVersion)
+	}
+	if err := config.validateInputs(); err != nil {
+		return err
 	}
 
-	// Make the HTTP request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to make HTTP request: %w", err)
+	if len(config.Profiles) > 0 {
+		return config.validateProfiles()
 	}
-	defer resp.Body.Close()
 
-	// Check the response status
-	if resp.StatusCode == http.StatusNotModified {
-		logrus.Debug("Resource not modified. Skipping download.")
-		return nil
+	if config.Output == "" && config.OutputDir == "" {
+		return fmt.Errorf("output: output is required, use \"-\" for stdout")
+	}
+	if config.Output != "" && config.OutputDir != "" {
+		return fmt.Errorf("outputDir: output and outputDir can't be used together")
 	}
+	if len(config.Include) == 0 && len(config.Paths) == 0 && len(config.Exclude) == 0 {
+		return fmt.Errorf("include: at least one include or exclude rule, or a path, is required")
+	}
+	return validateOutputFormat("outputFormat", config.Output, &config.OutputFormat)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+// validateOutputFormat checks the output format, it follows the extension of the output file if it is not set
+func validateOutputFormat(field, output string, format *string) error {
+	if *format != "" && *format != trimmer.FormatYAML && *format != trimmer.FormatJSON {
+		return fmt.Errorf("%s: unsupported format %q", field, *format)
 	}
 
-	// Get the new ETag from the response headers
-	newEtag := resp.Header.Get("ETag")
-	if newEtag == "" {
-		logrus.Debug("No ETag found in response. Proceeding to download.")
+	if *format == "" {
+		// The extension of a compressed output is the one before .gz, like in output.yaml.gz
+		switch strings.ToLower(filepath.Ext(strings.TrimSuffix(strings.ToLower(output), ".gz"))) {
+		case ".json":
+			*format = trimmer.FormatJSON
+		case ".yaml", ".yml":
+			*format = trimmer.FormatYAML
+		}
 	}
 
-	// Write the content to the local file
-	localFile, err := os.Create(localFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to create local file: %w", err)
+	return nil
+}
+
+// validateInputs checks the fields needed to read the inputs and fills in the defaults of the missing ones
+func (config *Configuration) validateInputs() error {
+	if config.Input == "" && len(config.Inputs) == 0 && !isStdin("") {
+		return fmt.Errorf("input: no input is given and nothing is piped into stdin")
+	}
+	for i, input := range config.Inputs {
+		if input == "" {
+			return fmt.Errorf("inputs[%d]: input is empty", i)
+		}
+	}
+	if config.InputFormat != "" && config.InputFormat != trimmer.FormatYAML && config.InputFormat != trimmer.FormatJSON {
+		return fmt.Errorf("inputFormat: unsupported format %q", config.InputFormat)
 	}
-	defer localFile.Close()
 
-	if _, err = io.Copy(localFile, resp.Body); err != nil {
-		return fmt.Errorf("failed to write content to local file: %w", err)
+	if config.SHA256 != "" {
+		if len(config.inputs()) > 1 {
+			return fmt.Errorf("sha256: only supported with a single input")
+		}
+		if _, err := hex.DecodeString(config.SHA256); err != nil || len(config.SHA256) != 2*sha256.Size {
+			return fmt.Errorf("sha256: must be %d hexadecimal characters, got %q", 2*sha256.Size, config.SHA256)
+		}
 	}
 
-	logrus.Debug("File downloaded successfully:", localFilePath)
+	if config.Cache.TTL < 0 {
+		return fmt.Errorf("cache.ttl: must not be negative, got %s", config.Cache.TTL)
+	}
+	if config.Cache.Enabled && config.Cache.Path == "" {
+		logrus.Debugf("Cache enabled but no path specified. Going to use the default cache path.")
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("cache.path: failed to get user home directory for the default cache path: %w", err)
+		}
+		config.Cache.Path = filepath.Join(homeDir, ".yamltrimmer-cache")
+	}
 
-	// Save the new ETag to the ETag file
-	if newEtag != "" {
-		if err := os.WriteFile(etagFilePath, []byte(newEtag), 0644); err != nil {
-			return fmt.Errorf("failed to write ETag to file: %w", err)
+	if config.HTTP.Timeout < 0 {
+		return fmt.Errorf("http.timeout: must not be negative, got %s", config.HTTP.Timeout)
+	}
+	if config.HTTP.Retries < 0 {
+		return fmt.Errorf("http.retries: must not be negative, got %d", config.HTTP.Retries)
+	}
+	if config.HTTP.RetryBackoff < 0 {
+		return fmt.Errorf("http.retryBackoff: must not be negative, got %s", config.HTTP.RetryBackoff)
+	}
+	if config.HTTP.Concurrency < 0 {
+		return fmt.Errorf("http.concurrency: must not be negative, got %d", config.HTTP.Concurrency)
+	}
+	for _, input := range config.inputs() {
+		if isURL(input) {
+			if err := config.HTTP.checkURL(input); err != nil {
+				return err
+			}
 		}
-		logrus.Debug("ETag updated:", newEtag)
 	}
 
 	return nil
 }
 
-func generateFileName(url, extension string) string {
-	hash := fmt.Sprintf("%x", md5.Sum([]byte(url)))
-	if extension == "" {
-		return hash
-	}
-	return fmt.Sprintf("%s.%s", hash, extension)
+// isURL checks if a string is a valid URL
+func isURL(str string) bool {
+	// Simple check for URL (could be more comprehensive)
+	return strings.HasPrefix(str, "http://") || strings.HasPrefix(str, "https://")
 }
 
-func filterByRules(rules []IncludeConfigItem, inputNode, outputNode *yaml.Node) {
-	if inputNode.Kind != yaml.MappingNode {
-		logrus.Fatalf("Input node is not a mapping node")
+// isStdin checks if the input should be read from stdin:
+// either "-" is given explicitly, or no input is given and there is data piped into stdin
+func isStdin(str string) bool {
+	if str == "-" {
+		return true
 	}
+	if str != "" {
+		return false
+	}
+	stat, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	// stdin is not a terminal, so something is piped into it
+	return stat.Mode()&os.ModeCharDevice == 0
+}
 
-	// Create an output node as a mapping node
-	outputNode.Kind = yaml.MappingNode
-	outputNode.Style = inputNode.Style
-
-	// Iterate over the rules
-	for _, rule := range rules {
-		// Find the corresponding key in the input YAML
-		for i := 0; i < len(inputNode.Content); i += 2 {
-			keyNode := inputNode.Content[i]
-			valueNode := inputNode.Content[i+1]
+// isFile checks if a string is a valid file path
+func isFile(str string) bool {
+	// Check if the input string is a valid file path
+	_, err := os.Stat(str)
+	return err == nil && !isURL(str)
+}
 
-			if keyNode.Value == rule.Key {
-				// Add the key to the output
-				outputNode.Content = append(outputNode.Content, keyNode)
+// isStdout checks if the output should be written to stdout
+func isStdout(str string) bool {
+	return str == "-"
+}
 
-				// If there are nested rules, process the value node recursively
-				if len(rule.Include) > 0 {
-					var nestedOutputNode yaml.Node
-					filterByRules(rule.Include, valueNode, &nestedOutputNode)
-					outputNode.Content = append(outputNode.Content, &nestedOutputNode)
-				} else {
-					// Otherwise, copy the value node directly
-					outputNode.Content = append(outputNode.Content, valueNode)
-				}
-				break
-			}
+// writeOutput writes the content to the output file, or to stdout if the output is "-".
+// The content is compressed with gzip if compress is set.
+func writeOutput(output string, content []byte, compress bool, stdout io.Writer) error {
+	if isStdout(output) {
+		if err := writeContent(stdout, content, compress); err != nil {
+			return fmt.Errorf("failed to write to stdout: %w", err)
 		}
+		return nil
 	}
+	return writeFileAtomicWith(output, 0644, func(writer io.Writer) error {
+		return writeContent(writer, content, compress)
+	})
 }
 
-func trim(input []byte, rules []IncludeConfigItem) ([]byte, error) {
-	// Parse the input YAML into a yaml.Node
-	var root yaml.Node
-	if err := yaml.Unmarshal(input, &root); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal input YAML: %w", err)
-	}
-	logrus.Debugf("Parsed input YAML successfully")
+// The placeholders of the output paths
+const (
+	placeholderDate     = "{date}"
+	placeholderHash     = "{hash}"
+	placeholderBasename = "{basename}"
+)
 
-	// get the first node
-	if len(root.Content) == 0 {
-		return nil, fmt.Errorf("no content in the input YAML")
-	}
+// outputDateFormat is the format of the {date} placeholder, a UTC timestamp that is safe in file names and sorts in time order
+const outputDateFormat = "20060102T150405Z"
 
-	// TODO: handle multiple documents later
-	if len(root.Content) > 1 {
-		logrus.Fatalf("Multiple documents in the input YAML. This is not supported yet.")
+// expandOutputPath replaces the placeholders in an output path: {date} with the current time,
+// {hash} with the hash of the input used in the names of the cached files, and {basename} with the name of the input without its extension
+func expandOutputPath(output, input string) string {
+	if !strings.Contains(output, "{") {
+		return output
 	}
-	root = *root.Content[0]
+	return strings.NewReplacer(
+		placeholderDate, now().UTC().Format(outputDateFormat),
+		placeholderHash, urlHash(input),
+		placeholderBasename, inputBasename(input),
+	).Replace(output)
+}
 
-	// Apply trimming rules recursively
-	var outputNode yaml.Node
-	filterByRules(rules, &root, &outputNode)
-	logrus.Debugf("Trimmed input YAML successfully")
+// inputBasename returns the name of an input without its extension, like "values" for "https://example.com/charts/values.yaml"
+func inputBasename(input string) string {
+	switch {
+	case input == "" || input == "-":
+		return "stdin"
+	case isURL(input):
+		if slug, _ := urlSlug(input); slug != "" {
+			return slug
+		}
+		return "input"
+	default:
+		base := filepath.Base(input)
+		return strings.TrimSuffix(base, filepath.Ext(base))
+	}
+}
 
-	// Marshal the filtered data back into YAML format
-	var output bytes.Buffer
-	encoder := yaml.NewEncoder(&output)
-	encoder.SetIndent(2)
-	if err := encoder.Encode(&outputNode); err != nil {
-		return nil, fmt.Errorf("failed to marshal output YAML: %w", err)
+// writeContent writes the content to the writer, compressed with gzip if compress is set
+func writeContent(writer io.Writer, content []byte, compress bool) error {
+	if !compress {
+		_, err := writer.Write(content)
+		return err
+	}
+	gzipWriter := gzip.NewWriter(writer)
+	if _, err := gzipWriter.Write(content); err != nil {
+		return err
 	}
-	logrus.Debugf("Marshalled output YAML successfully")
+	return gzipWriter.Close()
+}
 
-	return output.Bytes(), nil
+// compressesOutput checks if the output is written compressed with gzip
+func (config *Configuration) compressesOutput() bool {
+	return config.CompressOutput || strings.EqualFold(filepath.Ext(config.Output), ".gz")
 }
 
-func main() {
-	// Define a flag for the configuration file path
-	configPath := flag.String("config", "config.yaml", "Path to the configuration file")
-	verbose := flag.Bool("verbose", false, "Enable verbose logging")
-	flag.Parse()
+// writeFileAtomic writes the file through a temporary file in the same directory renamed over it,
+// so that the readers of the file never see it partially written
+func writeFileAtomic(path string, content []byte, perm os.FileMode) error {
+	return writeFileAtomicWith(path, perm, func(writer io.Writer) error {
+		_, err := writer.Write(content)
+		return err
+	})
+}
 
-	if *verbose {
-		logrus.SetLevel(logrus.DebugLevel)
-		logrus.Debug("Verbose logging enabled")
-		logrus.Debugf("Configuration file path: %s", *configPath)
+// writeFileAtomicWith is like writeFileAtomic, but the content is written by the given function
+func writeFileAtomicWith(path string, perm os.FileMode, write func(writer io.Writer) error) error {
+	tempFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
 	}
+	// Removing fails once the file is renamed, which is fine
+	defer os.Remove(tempFile.Name())
 
-	// Resolve the relative path to an absolute path
-	absPath, err := filepath.Abs(*configPath)
-	if err != nil {
-		logrus.Fatalf("Failed to resolve the configuration file path: %v", err)
+	if err := write(tempFile); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	// The temporary files are created only readable by the owner
+	if err := os.Chmod(tempFile.Name(), perm); err != nil {
+		return err
 	}
-	logrus.Debugf("Resolved configuration file path: %s", absPath)
+	return os.Rename(tempFile.Name(), path)
+}
 
-	// Call the function to parse the configuration
-	config, err := parseConfiguration(absPath)
-	if err != nil {
-		logrus.Fatalf("Failed to parse configuration: %v", err)
+// inputs returns all the inputs of the configuration, the single input first
+func (config *Configuration) inputs() []string {
+	inputs := config.Inputs
+	if config.Input != "" || len(config.Inputs) == 0 {
+		inputs = append([]string{config.Input}, config.Inputs...)
 	}
-	logrus.Debugf("Parsed configuration: %+v", *config)
 
-	// see if we're using a cache
-	if isURL(config.Input) && config.Cache.Enabled {
-		logrus.Debugf("Cache enabled with path: %s", config.Cache.Path)
-		if config.Cache.Path == "" {
-			logrus.Debugf("Cache enabled but no path specified. Going to use the default cache path.")
-			homeDir, err := os.UserHomeDir()
-			if err != nil {
-				logrus.Fatalf("Failed to get user home directory: %v", err)
-			}
-			config.Cache.Path = filepath.Join(homeDir, ".yamltrimmer-cache")
+	// The input directories are replaced with their YAML files, a directory without any is kept to fail when it's read
+	var expanded []string
+	for _, input := range inputs {
+		if stat, err := os.Stat(input); isURL(input) || err != nil || !stat.IsDir() {
+			expanded = append(expanded, input)
+			continue
+		}
+		files := yamlFiles(input, config.RecursiveInputs)
+		if len(files) == 0 {
+			files = []string{input}
 		}
+		expanded = append(expanded, files...)
+	}
+	return expanded
+}
 
-		// resolve the cache path to an absolute path
-		absCachePath, err := filepath.Abs(config.Cache.Path)
+// yamlFiles returns the paths of the files with the ".yaml" and ".yml" extensions in the directory, sorted by path.
+// The nested directories are searched too if recursive, the directories that can't be read are skipped.
+func yamlFiles(dir string, recursive bool) []string {
+	var files []string
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
 		if err != nil {
-			logrus.Fatalf("Failed to resolve the cache path: %v", err)
+			logrus.Debugf("Skipping %s: %v", path, err)
+			return nil
 		}
-		logrus.Debugf("Resolved cache path: %s", absCachePath)
-		config.Cache.Path = absCachePath
-
-		// create the cache directory, if it doesn't exist
-		if _, err := os.Stat(config.Cache.Path); os.IsNotExist(err) {
-			logrus.Debugf("Creating cache directory: %s", config.Cache.Path)
-			err := os.MkdirAll(config.Cache.Path, 0755)
-			if err != nil {
-				logrus.Fatalf("Failed to create cache directory: %v", err)
+		if entry.IsDir() {
+			if path != dir && !recursive {
+				return filepath.SkipDir
 			}
-		} else if err != nil {
-			logrus.Fatalf("Failed to check cache directory: %v", err)
+			return nil
+		}
+		if extension := strings.ToLower(filepath.Ext(path)); extension == ".yaml" || extension == ".yml" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
+
+// hasURL checks if any of the inputs is a URL
+func hasURL(inputs []string) bool {
+	for _, input := range inputs {
+		if isURL(input) {
+			return true
 		}
 	}
+	return false
+}
 
-	// resolve the output path to an absolute path
-	absOutputPath, err := filepath.Abs(config.Output)
-	if err != nil {
-		logrus.Fatalf("Failed to resolve the output file path: %v", err)
+// inputFormat returns the configured input format.
+// If none is configured, the inputs are JSON when all of them have the ".json" extension,
+// otherwise the format is left empty for the trimmer to detect from the content.
+func (config *Configuration) inputFormat() string {
+	if config.InputFormat != "" {
+		return config.InputFormat
+	}
+	for _, input := range config.inputs() {
+		if !strings.EqualFold(filepath.Ext(input), ".json") {
+			return ""
+		}
 	}
-	logrus.Debugf("Resolved output file path: %s", absOutputPath)
-	config.Output = absOutputPath
+	return trimmer.FormatJSON
+}
 
-	content := []byte{}
+// readInputs reads all the inputs and concatenates them as a multi-document YAML,
+// or as a stream of JSON values when the inputs are JSON.
+// The inputs are read concurrently, at most as many at a time as the configured concurrency.
+func readInputs(ctx context.Context, config *Configuration, downloader *downloader) ([]byte, error) {
+	separator := "\n---\n"
+	if config.inputFormat() == trimmer.FormatJSON {
+		separator = "\n"
+	}
 
-	if isURL(config.Input) {
-		logrus.Debugf("Input is a URL: %s", config.Input)
+	inputs := config.inputs()
+	contents := make([][]byte, len(inputs))
+	errs := make([]error, len(inputs))
 
-		if config.Cache.Enabled {
-			logrus.Debugf("Going to try to read the input file from cache")
+	concurrency := config.HTTP.Concurrency
+	if concurrency == 0 {
+		concurrency = defaultConcurrency
+	}
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			contents[i], errs[i] = readInput(ctx, input, config, downloader)
+		}()
+	}
+	wg.Wait()
 
-			localFileName := generateFileName(config.Input, "")
-			etagFileName := generateFileName(config.Input, "etag")
+	// The report covers the inputs read before a failure too
+	if config.Cache.Enabled && config.Cache.Report != "" && hasURL(inputs) {
+		if err := writeCacheReport(config.Cache.Report, inputs, downloader); err != nil {
+			return nil, err
+		}
+	}
 
-			localFilePath := filepath.Join(config.Cache.Path, localFileName)
-			etagFilePath := filepath.Join(config.Cache.Path, etagFileName)
+	// Evict the old cache entries only after all the inputs are read, so that no input is deleted before it's read
+	if config.Cache.Enabled && config.Cache.MaxSize > 0 && hasURL(inputs) {
+		if err := evictCache(config.Cache.Path, config.Cache.MaxSize); err != nil {
+			return nil, err
+		}
+	}
 
-			logrus.Debugf("Local file path: %s", localFilePath)
-			logrus.Debugf("ETag file path: %s", etagFilePath)
+	var content []byte
+	for i := range inputs {
+		// Report the error of the first failed input, like reading them one by one would
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
 
-			logrus.Debugf("Checking and downloading file: %s", config.Input)
-			if err := checkCacheAndDownload(config.Input, localFilePath, etagFilePath); err != nil {
-				logrus.Fatalf("Failed to download file: %v", err)
-			}
+		if i > 0 {
+			content = append(content, []byte(separator)...)
+		}
+		content = append(content, contents[i]...)
+	}
+	return content, nil
+}
+
+// readInput reads a single input from stdin, a URL or a file.
+// The cache is only used for URLs.
+func readInput(ctx context.Context, input string, config *Configuration, downloader *downloader) ([]byte, error) {
+	// The reads can't be interrupted, so the context is checked before each of them
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if isStdin(input) {
+		logrus.Debugf("Input is stdin")
+		// Read all of stdin, the cache is not used for stdin
+		content, err := readAllLimited(os.Stdin, config.MaxInputSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read input from stdin: %w", err)
+		}
+		return content, nil
+	} else if isURL(input) {
+		logrus.Debugf("Input is a URL: %s", input)
 
-			// Read the input file
-			content, err = os.ReadFile(localFilePath)
+		if !config.Cache.Enabled {
+			logrus.Debugf("Going to download the input file")
+			content, err := downloader.downloadFile(ctx, input)
 			if err != nil {
-				logrus.Fatalf("Failed to read input file from cache: %v", err)
+				return nil, fmt.Errorf("failed to download input file: %w", err)
 			}
-		} else {
-			logrus.Debugf("Going to download the input file")
-			if content, err = downloadFile(config.Input); err != nil {
-				logrus.Fatalf("Failed to download input file: %v", err)
+			if err := verifyChecksum(content, config.SHA256); err != nil {
+				return nil, fmt.Errorf("failed to verify input file: %w", err)
 			}
+			return content, nil
 		}
-	} else if isFile(config.Input) {
-		logrus.Debugf("Input is a file: %s", config.Input)
+
+		logrus.Debugf("Going to try to read the input file from cache")
+
+		localFilePath := filepath.Join(config.Cache.Path, generateFileName(input, ""))
+		logrus.Debugf("Local file path: %s", localFilePath)
+
+		if err := migrateLegacyCacheFiles(config.Cache.Path, input); err != nil {
+			return nil, err
+		}
+
+		logrus.Debugf("Checking and downloading file: %s", input)
+		result, err := downloader.checkCacheAndDownload(ctx, input, localFilePath, config.Cache, config.SHA256)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download file: %w", err)
+		}
+		logrus.Infof("Cache %s for %s: %s", result.Status, input, result.Source)
+		downloader.recordCacheResult(input, result)
+		// The content is not in the cache when the server doesn't allow storing it
+		if result.content != nil {
+			return result.content, nil
+		}
+		// A failed update only makes the file look older to the eviction, it's not worth failing the input
+		if err := markUsed(localFilePath); err != nil {
+			logrus.Debugf("Failed to record the use of the cached file: %v", err)
+		}
+
+		// Read the input file, the cached file is verified too as the expected checksum may have changed
+		content, err := readCachedFile(localFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read input file from cache: %w", err)
+		}
+		if err := verifyChecksum(content, config.SHA256); err != nil {
+			return nil, fmt.Errorf("failed to verify input file from cache: %w", err)
+		}
+		return content, nil
+	} else if stat, err := os.Stat(input); err == nil && stat.IsDir() {
+		return nil, fmt.Errorf("input directory %s has no .yaml or .yml files", input)
+	} else if isFile(input) {
+		logrus.Debugf("Input is a file: %s", input)
 		// Read the input file
-		if content, err = os.ReadFile(config.Input); err != nil {
-			logrus.Fatalf("Failed to read input file: %v", err)
+		file, err := os.Open(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read input file: %w", err)
 		}
-	} else {
-		logrus.Fatalf("Invalid input: not a URL or a valid file path")
+		defer file.Close()
+		content, err := readAllLimited(file, config.MaxInputSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read input file: %w", err)
+		}
+		return content, nil
+	}
+
+	return nil, fmt.Errorf("invalid input %q: not a URL, a valid file path or stdin", input)
+}
+
+func main() {
+	// Logs always go to stderr, so that they don't mix with the output written to stdout
+	logrus.SetOutput(os.Stderr)
+
+	if err := runCommand(os.Args[1:], os.Stdout); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		logrus.Error(err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// runOptions are the options given on the command line that change what is done with the trimmed output
+type runOptions struct {
+	dryRun  bool
+	diff    bool
+	summary bool
+	check   bool
+
+	// metrics collects the sizes of the run for the metrics file, nil if there is no metrics file
+	metrics *runMetrics
+}
+
+// printPaths reads the inputs and prints the paths of all the values in them, one per line
+func printPaths(ctx context.Context, config *Configuration, downloader *downloader, stdout io.Writer) error {
+	content, err := readInputs(ctx, config, downloader)
+	if err != nil {
+		return withExitCode(exitDownloadError, fmt.Errorf("failed to read input: %w", err))
+	}
+
+	config.InputFormat = config.inputFormat()
+	paths, err := config.ListPaths(content)
+	if err != nil {
+		return withExitCode(exitParseError, fmt.Errorf("failed to list the paths of the input: %w", err))
+	}
+	for _, path := range paths {
+		fmt.Fprintln(stdout, path)
+	}
+	return nil
+}
+
+// trimInputs reads the inputs, trims them and writes the result to the output
+func trimInputs(ctx context.Context, config *Configuration, downloader *downloader, options runOptions, stdout io.Writer) error {
+	// Read all the inputs into a single multi-document YAML
+	content, err := readInputs(ctx, config, downloader)
+	if err != nil {
+		return withExitCode(exitDownloadError, fmt.Errorf("failed to read input: %w", err))
 	}
 
 	logrus.Debugf("Done reading input data: %d bytes", len(content))
-	if len(content) == 0 {
-		logrus.Fatalf("Input data is empty")
-	} else if len(content) < 100 {
+	if len(content) < 100 {
 		logrus.Debugf("Input data: %s", string(content))
 	} else {
 		logrus.Debugf("Input data (first 100 bytes): %s", string(content)[:100])
 	}
 
 	// Trim the input data
+	config.InputFormat = config.inputFormat()
+	if config.MetricsFile != "" {
+		options.metrics = &runMetrics{inputBytes: len(content)}
+	}
+	if len(config.Profiles) > 0 {
+		err = trimProfiles(ctx, config, content, options, stdout)
+	} else {
+		err = trimContent(ctx, config, content, options, stdout)
+	}
+	if err != nil {
+		return err
+	}
+
+	if options.metrics != nil {
+		if err := writeMetrics(config.MetricsFile, *options.metrics, config.inputs(), downloader); err != nil {
+			return withExitCode(exitWriteError, err)
+		}
+	}
+	return nil
+}
+
+// checkStreaming checks if the configuration can be trimmed in the streaming mode,
+// which supports a single file or stdin input written to a single output
+func (config *Configuration) checkStreaming() error {
+	inputs := config.inputs()
+	if len(inputs) != 1 || isURL(inputs[0]) {
+		return fmt.Errorf("-stream needs a single file or stdin input")
+	}
+	if config.OutputDir != "" || len(config.Profiles) > 0 {
+		return fmt.Errorf("-stream can't be used with outputDir or profiles")
+	}
+	return nil
+}
+
+// streamInput trims the documents of the single input one at a time, and writes them to the output as they are trimmed
+func streamInput(ctx context.Context, config *Configuration, stdout io.Writer) error {
+	reader := io.Reader(os.Stdin)
+	if input := config.inputs()[0]; !isStdin(input) {
+		file, err := os.Open(input)
+		if err != nil {
+			return withExitCode(exitDownloadError, fmt.Errorf("failed to read input: %w", err))
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	config.InputFormat = config.inputFormat()
+	var trimErr error
+	trim := func(writer io.Writer) error {
+		if !config.compressesOutput() {
+			trimErr = config.TrimStreamContext(ctx, reader, writer)
+			return trimErr
+		}
+		gzipWriter := gzip.NewWriter(writer)
+		if trimErr = config.TrimStreamContext(ctx, reader, gzipWriter); trimErr != nil {
+			return trimErr
+		}
+		return gzipWriter.Close()
+	}
+	var err error
+	if isStdout(config.Output) {
+		err = trim(stdout)
+	} else {
+		err = writeFileAtomicWith(config.Output, 0644, trim)
+	}
+	if trimErr != nil {
+		return withExitCode(exitParseError, fmt.Errorf("failed to trim input data: %w", trimErr))
+	}
+	if err != nil {
+		return withExitCode(exitWriteError, fmt.Errorf("failed to write output file: %w", err))
+	}
+	logrus.Debugf("Output written successfully: %s", config.Output)
+	return nil
+}
+
+// trimContent trims the input data and writes the result to the output
+func trimContent(ctx context.Context, config *Configuration, content []byte, options runOptions, stdout io.Writer) error {
+	if config.OutputDir != "" {
+		return trimInputsToDir(ctx, config, content, options, stdout)
+	}
 	var trimmedContent []byte
-	if trimmedContent, err = trim(content, config.Include); err != nil {
-		logrus.Fatalf("Failed to trim input data: %v", err)
+	var err error
+	if options.summary {
+		var summary trimmer.Summary
+		trimmedContent, summary, err = config.TrimWithSummaryContext(ctx, content)
+		if err == nil {
+			logrus.Info(formatSummary(summary))
+		}
+	} else {
+		trimmedContent, err = config.TrimContext(ctx, content)
+	}
+	if err != nil {
+		return withExitCode(exitParseError, fmt.Errorf("failed to trim input data: %w", err))
 	}
 
 	logrus.Debugf("Done trimming input data: %d bytes", len(trimmedContent))
+	if options.metrics != nil {
+		options.metrics.outputBytes += len(trimmedContent)
+	}
 	if len(trimmedContent) == 0 {
-		logrus.Fatalf("Trimmed data is empty")
+		return withExitCode(exitParseError, fmt.Errorf("trimmed data is empty"))
 	} else if len(trimmedContent) < 100 {
 		logrus.Debugf("Trimmed data: %s", string(trimmedContent))
 	} else {
 		logrus.Debugf("Trimmed data (first 100 bytes): %s", string(trimmedContent)[:100])
 	}
 
+	if options.diff {
+		fmt.Fprint(stdout, unifiedDiff("input", "output", content, trimmedContent))
+	}
+
+	if options.check {
+		upToDate, err := checkOutput(config.Output, trimmedContent, stdout)
+		if err != nil {
+			return err
+		}
+		return outdatedError(upToDate, config.Output)
+	}
+
 	// Write the trimmed data to the output file
-	if err := os.WriteFile(config.Output, trimmedContent, 0644); err != nil {
-		logrus.Fatalf("Failed to write output file: %v", err)
+	if err := writeResult(config, content, trimmedContent, options.dryRun, stdout); err != nil {
+		return withExitCode(exitWriteError, fmt.Errorf("failed to write output file: %w", err))
+	}
+	if options.dryRun {
+		logrus.Debugf("Dry run, the output is not written: %s", config.Output)
+	} else {
+		logrus.Debugf("Output written successfully: %s", config.Output)
+	}
+	return nil
+}
+
+// trimInputsToDir trims the input data and writes every trimmed document to its own file in the output directory
+func trimInputsToDir(ctx context.Context, config *Configuration, content []byte, options runOptions, stdout io.Writer) error {
+	documents, err := config.TrimDocumentsContext(ctx, content, config.OutputName)
+	if err != nil {
+		return withExitCode(exitParseError, fmt.Errorf("failed to trim input data: %w", err))
+	}
+	logrus.Debugf("Done trimming input data: %d documents", len(documents))
+	if options.metrics != nil {
+		for _, document := range documents {
+			options.metrics.outputBytes += len(document.Content)
+		}
+	}
+
+	if options.diff {
+		fmt.Fprint(stdout, unifiedDiff("input", "output", content, joinDocuments(documents)))
+	}
+	if options.check {
+		upToDate, err := checkDocuments(config.OutputDir, documents, stdout)
+		if err != nil {
+			return err
+		}
+		return outdatedError(upToDate, config.OutputDir)
+	}
+	if options.dryRun {
+		if err := printDryRunSummary(stdout, content, joinDocuments(documents)); err != nil {
+			return err
+		}
 	}
-	logrus.Debugf("Output file written successfully: %s", config.Output)
+	return withExitCode(exitWriteError, writeDocuments(config.OutputDir, documents, options.dryRun, stdout))
 }
@@ -2,161 +2,658 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"gopkg.in/yaml.v3"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/aliok/yamltrimmer/pkg/trimmer"
 )
 
-func Test_filterByRules(t *testing.T) {
+func Test_writeOutput(t *testing.T) {
+	content := []byte("database:\n  host: localhost\n")
+
+	// write to stdout
+	var stdout bytes.Buffer
+	if err := writeOutput("-", content, false, &stdout); err != nil {
+		t.Fatalf("failed to write output to stdout: %v", err)
+	}
+
+	// write to a file
+	outputPath := filepath.Join(t.TempDir(), "output.yaml")
+	if err := writeOutput(outputPath, content, false, &stdout); err != nil {
+		t.Fatalf("failed to write output to file: %v", err)
+	}
+	fileContent, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("failed to read output file: %v", err)
+	}
+
+	if !bytes.Equal(stdout.Bytes(), fileContent) {
+		t.Errorf("stdout output doesn't match file output:\nStdout:\n%s\nFile:\n%s", stdout.String(), string(fileContent))
+	}
+}
+
+func Test_writeOutput_compressed(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "input.yaml")
+	if err := os.WriteFile(inputPath, []byte("database:\n  host: localhost\n  port: 5432\n"), 0644); err != nil {
+		t.Fatalf("failed to write input file: %v", err)
+	}
+
 	tests := []struct {
-		name         string
-		rules        string
-		inputYAML    string
-		expectedYAML string
-		expectError  bool
+		name     string
+		output   string
+		compress bool
+		stream   bool
 	}{
 		{
-			name: "simple filtering",
-			inputYAML: `
-            cache:
-              enabled: true
-              path: /tmp
-            database:
-              host: localhost
-              port: 5432
-            `,
-			rules: `
-            include:
-              - key: cache`,
-			expectedYAML: `
-            cache:
-              enabled: true
-              path: /tmp
-            `,
-			expectError: false,
-		},
-		{
-			name: "nested filtering",
-			inputYAML: `
-            cache:
-              enabled: true
-            database:
-              host: localhost
-              port: 5432
-              credentials:
-                username: user
-                password: pass
-            `,
-			rules: `
-            include:
-              - key: database
-                include:
-                    - key: host
-                    - key: credentials
-                      include:
-                      - key: username    
-            `,
-			expectedYAML: `
-            database:
-              host: localhost
-              credentials:
-                username: user
-            `,
-			expectError: false,
-		},
-		{
-			name: "no matching keys",
-			rules: `
-            include:            
-              - key: nonexistent
-            `,
-			inputYAML: `
-            cache:
-              enabled: true
-            database:
-              host: localhost
-              port: 5432
-            `,
-			expectedYAML: `{}`,
-			expectError:  false,
+			name:   "output ending in .gz",
+			output: filepath.Join(dir, "output.yaml.gz"),
+		},
+		{
+			name:     "compressOutput",
+			output:   filepath.Join(dir, "output.yaml"),
+			compress: true,
+		},
+		{
+			name:   "streaming",
+			output: filepath.Join(dir, "stream.yaml.gz"),
+			stream: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			var inputNode yaml.Node
-			err := yaml.Unmarshal([]byte(unindent(tt.inputYAML)), &inputNode)
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			config := "input: " + inputPath + "\noutput: " + tt.output + "\ninclude:\n  - key: database.host\n"
+			if tt.compress {
+				config += "compressOutput: true\n"
+			}
+			if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+				t.Fatalf("failed to write config file: %v", err)
+			}
+
+			args := []string{"trim", "-config", configPath}
+			if tt.stream {
+				args = append(args, "-stream")
+			}
+			var stdout bytes.Buffer
+			if err := runCommand(args, &stdout); err != nil {
+				t.Fatalf("failed to run command: %v", err)
+			}
+
+			compressed, err := os.ReadFile(tt.output)
+			if err != nil {
+				t.Fatalf("failed to read output file: %v", err)
+			}
+			if !bytes.HasPrefix(compressed, gzipMagic) {
+				t.Fatalf("expected the output to be compressed, got: %q", compressed)
+			}
+			content, err := decompress(compressed)
 			if err != nil {
-				t.Fatalf("failed to unmarshal input YAML: %v", err)
+				t.Fatalf("failed to decompress output file: %v", err)
+			}
+			if expected := "database:\n  host: localhost\n"; string(content) != expected {
+				t.Errorf("unexpected output: %q, expected %q", content, expected)
+			}
+
+			// The output is written through a temporary file, nothing else is left in the directory
+			matches, err := filepath.Glob(filepath.Join(dir, ".*.tmp"))
+			if err != nil || len(matches) > 0 {
+				t.Errorf("unexpected temporary files: %v, %v", matches, err)
 			}
 
-			var outputNode yaml.Node
-			defer func() {
-				if r := recover(); r != nil && tt.expectError {
-					// Expected error via log.Fatalf
-					return
-				} else if r != nil {
-					t.Fatalf("unexpected panic: %v", r)
+			// The check mode compares the decompressed output
+			if !tt.stream {
+				if err := runCommand(append(args, "-check"), &stdout); err != nil {
+					t.Errorf("expected the compressed output to be up to date: %v", err)
 				}
-			}()
+			}
+		})
+	}
+}
+
+func Test_expandOutputPath(t *testing.T) {
+	useFakeClock(t, time.Date(2024, 1, 2, 15, 4, 5, 0, time.FixedZone("CET", 3600)))
+	url := "https://example.com/charts/values.yaml"
+
+	tests := []struct {
+		output   string
+		input    string
+		expected string
+	}{
+		{output: "output.yaml", input: url, expected: "output.yaml"},
+		{output: "archive/{basename}-{date}.yaml", input: url, expected: "archive/values-20240102T140405Z.yaml"},
+		{output: "archive/{hash}.yaml", input: url, expected: "archive/" + urlHash(url) + ".yaml"},
+		{output: "{basename}.trimmed.yaml", input: "/data/app.config.yaml", expected: "app.config.trimmed.yaml"},
+		{output: "{basename}.yaml", input: "", expected: "stdin.yaml"},
+		{output: "{unknown}.yaml", input: url, expected: "{unknown}.yaml"},
+	}
+	for _, tt := range tests {
+		if got := expandOutputPath(tt.output, tt.input); got != tt.expected {
+			t.Errorf("expandOutputPath(%q, %q) = %q, expected %q", tt.output, tt.input, got, tt.expected)
+		}
+	}
+	if name := generateFileName(url, ""); !strings.Contains(name, urlHash(url)) {
+		t.Errorf("expected the hash in the cached file name: %s", name)
+	}
+
+	// The placeholders are replaced in the final path of the output
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "input.yaml")
+	if err := os.WriteFile(inputPath, []byte("database:\n  host: localhost\n  port: 5432\n"), 0644); err != nil {
+		t.Fatalf("failed to write input file: %v", err)
+	}
+	output := filepath.Join(dir, "{basename}-{date}-{hash}.yaml")
+	var stdout bytes.Buffer
+	if err := runCommand([]string{"-input", inputPath, "-output", output, "-include", "database.host"}, &stdout); err != nil {
+		t.Fatalf("failed to run command: %v", err)
+	}
+	outputPath := filepath.Join(dir, "input-20240102T140405Z-"+urlHash(inputPath)+".yaml")
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("failed to read output file: %v", err)
+	}
+	if expected := "database:\n  host: localhost\n"; string(content) != expected {
+		t.Errorf("unexpected output: %q, expected %q", content, expected)
+	}
+}
+
+func Test_writeFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	outputPath := filepath.Join(dir, "output.yaml")
+	if err := os.WriteFile(outputPath, []byte("old: content that is longer than the new one\n"), 0600); err != nil {
+		t.Fatalf("failed to write output file: %v", err)
+	}
+
+	content := []byte("database:\n  host: localhost\n")
+	if err := writeFileAtomic(outputPath, content, 0644); err != nil {
+		t.Fatalf("failed to write output file: %v", err)
+	}
+
+	fileContent, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("failed to read output file: %v", err)
+	}
+	if !bytes.Equal(fileContent, content) {
+		t.Errorf("unexpected file content:\n%s", fileContent)
+	}
+	if stat, err := os.Stat(outputPath); err != nil || stat.Mode().Perm() != 0644 {
+		t.Errorf("unexpected file mode: %v, %v", stat.Mode(), err)
+	}
+
+	// a failing write leaves nothing behind either
+	if err := writeFileAtomic(filepath.Join(dir, "missing", "output.yaml"), content, 0644); err == nil {
+		t.Errorf("expected an error writing into a missing directory")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read output directory: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "output.yaml" {
+		t.Errorf("expected only the output file to be left, got: %v", entries)
+	}
+}
+
+func Test_parseConfiguration_ttl(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	config := "input: https://example.com/input.yaml\noutput: output.yaml\ncache:\n  enabled: true\n  ttl: 1h30m\ninclude:\n  - key: foo\n"
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	parsed, err := parseConfiguration(configPath)
+	if err != nil {
+		t.Fatalf("failed to parse configuration: %v", err)
+	}
+
+	if parsed.Cache.TTL != 90*time.Minute {
+		t.Errorf("unexpected TTL: %s", parsed.Cache.TTL)
+	}
+}
+
+func Test_parseConfiguration_version(t *testing.T) {
+	tests := []struct {
+		name         string
+		version      string
+		errorMessage string
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:    "supported",
+			version: "version: \"1\"\n",
+		},
+		{
+			name:    "supported as a number",
+			version: "version: 1\n",
+		},
+		{
+			name:         "unsupported",
+			version:      "version: \"2\"\n",
+			errorMessage: `invalid configuration: version: unsupported version "2", expected "1"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			config := tt.version + "input: https://example.com/input.yaml\noutput: output.yaml\ninclude:\n  - key: foo\n"
+			if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+				t.Fatalf("failed to write config file: %v", err)
+			}
 
-			config, err := parseRules(unindent(tt.rules))
+			_, err := parseConfiguration(configPath)
+			if tt.errorMessage != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMessage) {
+					t.Errorf("expected error containing %q, got: %v", tt.errorMessage, err)
+				}
+				return
+			}
 			if err != nil {
-				t.Fatalf("failed to parse rules: %v", err)
+				t.Errorf("failed to parse configuration: %v", err)
 			}
+		})
+	}
+}
+
+func Test_parseConfiguration_env(t *testing.T) {
+	t.Setenv("YAMLTRIMMER_HOST", "example.com")
+	t.Setenv("YAMLTRIMMER_OUT", "/tmp/out")
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	config := "input: https://${YAMLTRIMMER_HOST}/input.yaml\noutput: $YAMLTRIMMER_OUT/output.yaml\ncache:\n  enabled: true\n  path: ${YAMLTRIMMER_OUT}/cache\ninclude:\n  - key: foo\n"
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	parsed, err := parseConfiguration(configPath)
+	if err != nil {
+		t.Fatalf("failed to parse configuration: %v", err)
+	}
+
+	if parsed.Input != "https://example.com/input.yaml" {
+		t.Errorf("unexpected input: %s", parsed.Input)
+	}
+	if parsed.Output != "/tmp/out/output.yaml" {
+		t.Errorf("unexpected output: %s", parsed.Output)
+	}
+	if parsed.Cache.Path != "/tmp/out/cache" {
+		t.Errorf("unexpected cache path: %s", parsed.Cache.Path)
+	}
+}
+
+func Test_parseConfiguration_envStrict(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	config := "input: https://${YAMLTRIMMER_UNDEFINED}/input.yaml\noutput: output.yaml\nstrict: true\ninclude:\n  - key: foo\n"
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	_, err := parseConfiguration(configPath)
+	if err == nil || !strings.Contains(err.Error(), "input: undefined environment variables: YAMLTRIMMER_UNDEFINED") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_parseConfiguration_url(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/config.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "input: https://example.com/input.yaml\noutput: output.yaml\ninclude:\n  - key: foo\n")
+	}))
+	defer server.Close()
 
-			// Call the function under test
-			filterByRules(config.Include, inputNode.Content[0], &outputNode)
+	parsed, err := parseConfiguration(server.URL + "/config.yaml")
+	if err != nil {
+		t.Fatalf("failed to parse configuration: %v", err)
+	}
+	if parsed.Input != "https://example.com/input.yaml" || parsed.Output != "output.yaml" {
+		t.Errorf("unexpected configuration: %+v", parsed)
+	}
+	if len(parsed.Include) != 1 || parsed.Include[0].Key != "foo" {
+		t.Errorf("unexpected rules: %+v", parsed.Include)
+	}
+
+	if _, err := parseConfiguration(server.URL + "/missing.yaml"); err == nil || !strings.Contains(err.Error(), "unexpected status code: 404") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
 
-			// Marshal the output node to YAML for comparison
-			var outputBuffer bytes.Buffer
-			encoder := yaml.NewEncoder(&outputBuffer)
-			encoder.SetIndent(2)
-			err = encoder.Encode(&outputNode)
+func Test_readConfigurations(t *testing.T) {
+	dir := t.TempDir()
+	basePath := filepath.Join(dir, "base.yaml")
+	base := "output: output.yaml\ncache:\n  enabled: true\n  ttl: 1h\nhttp:\n  retries: 3\n  headers:\n    Accept: application/yaml\ninclude:\n  - key: database\n"
+	overridePath := filepath.Join(dir, "override.yaml")
+	override := "input: https://example.com/input.yaml\ncache:\n  ttl: 5m\nhttp:\n  headers:\n    Authorization: Bearer token\ninclude:\n  - key: cache\n"
+	emptyPath := filepath.Join(dir, "empty.yaml")
+	for path, content := range map[string]string{basePath: base, overridePath: override, emptyPath: ""} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write config file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name            string
+		appendLists     bool
+		expectedInclude []string
+	}{
+		{
+			name:            "lists replaced",
+			expectedInclude: []string{"cache"},
+		},
+		{
+			name:            "lists appended",
+			appendLists:     true,
+			expectedInclude: []string{"database", "cache"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := readConfigurations([]string{basePath, emptyPath, overridePath}, tt.appendLists)
 			if err != nil {
-				t.Fatalf("failed to marshal output YAML: %v", err)
+				t.Fatalf("failed to read configurations: %v", err)
 			}
 
-			// Compare the output
-			gotYAML := unindent(outputBuffer.String())
-			expectedYAML := unindent(tt.expectedYAML)
-			if gotYAML != expectedYAML {
-				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			if config.Input != "https://example.com/input.yaml" || config.Output != "output.yaml" {
+				t.Errorf("unexpected input and output: %q, %q", config.Input, config.Output)
+			}
+			if !config.Cache.Enabled || config.Cache.TTL != 5*time.Minute {
+				t.Errorf("unexpected cache settings: %+v", config.Cache)
+			}
+			expectedHeaders := map[string]string{"Accept": "application/yaml", "Authorization": "Bearer token"}
+			if config.HTTP.Retries != 3 || !reflect.DeepEqual(config.HTTP.Headers, expectedHeaders) {
+				t.Errorf("unexpected HTTP settings: %+v", config.HTTP)
+			}
+			var include []string
+			for _, rule := range config.Include {
+				include = append(include, rule.Key)
+			}
+			if !reflect.DeepEqual(include, tt.expectedInclude) {
+				t.Errorf("unexpected include rules: %v, expected %v", include, tt.expectedInclude)
 			}
 		})
 	}
+
+	if _, err := readConfigurations([]string{basePath, filepath.Join(dir, "missing.yaml")}, false); err == nil || !strings.Contains(err.Error(), "missing.yaml: error opening file") {
+		t.Errorf("unexpected error: %v", err)
+	}
 }
 
-func unindent(inputYAML string) string {
-	inputYAML = strings.TrimLeft(inputYAML, "\n")
+func Test_validate(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       string
+		errorMessage string
+	}{
+		{
+			name:         "missing output",
+			config:       "input: input.yaml\ninclude:\n  - key: foo\n",
+			errorMessage: "output: output is required",
+		},
+		{
+			name:         "missing rules",
+			config:       "input: input.yaml\noutput: output.yaml\n",
+			errorMessage: "include: at least one include or exclude rule, or a path, is required",
+		},
+		{
+			name:         "empty input in inputs",
+			config:       "inputs: [a.yaml, '']\noutput: output.yaml\ninclude:\n  - key: foo\n",
+			errorMessage: "inputs[1]: input is empty",
+		},
+		{
+			name:         "unsupported output format",
+			config:       "input: input.yaml\noutput: output.yaml\noutputFormat: toml\ninclude:\n  - key: foo\n",
+			errorMessage: `outputFormat: unsupported format "toml"`,
+		},
+		{
+			name:         "negative retries",
+			config:       "input: input.yaml\noutput: output.yaml\nhttp:\n  retries: -1\ninclude:\n  - key: foo\n",
+			errorMessage: "http.retries: must not be negative",
+		},
+		{
+			name:         "invalid checksum",
+			config:       "input: input.yaml\noutput: output.yaml\nsha256: abc\ninclude:\n  - key: foo\n",
+			errorMessage: `sha256: must be 64 hexadecimal characters, got "abc"`,
+		},
+		{
+			name:         "disallowed host",
+			config:       "input: http://169.254.169.254/latest/meta-data\noutput: output.yaml\nhttp:\n  allowedHosts: ['*.example.com']\ninclude:\n  - key: foo\n",
+			errorMessage: "http.allowedHosts: the host of http://169.254.169.254/latest/meta-data is not allowed, expected one of *.example.com",
+		},
+		{
+			name:         "disallowed scheme",
+			config:       "inputs: [https://example.com/a.yaml, http://example.com/b.yaml]\noutput: output.yaml\nhttp:\n  allowedSchemes: [https]\ninclude:\n  - key: foo\n",
+			errorMessage: "http.allowedSchemes: the scheme of http://example.com/b.yaml is not allowed, expected one of https",
+		},
+		{
+			name:         "negative TTL",
+			config:       "input: input.yaml\noutput: output.yaml\ncache:\n  ttl: -1h\nexclude:\n  - key: foo\n",
+			errorMessage: "cache.ttl: must not be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.config), 0644); err != nil {
+				t.Fatalf("failed to write config file: %v", err)
+			}
+
+			_, err := parseConfiguration(configPath)
+			if err == nil || !strings.Contains(err.Error(), tt.errorMessage) {
+				t.Errorf("expected error containing %q, got: %v", tt.errorMessage, err)
+			}
+		})
+	}
+}
 
-	// replace tabs with spaces
-	inputYAML = strings.ReplaceAll(inputYAML, "\t", "    ")
+func Test_validate_missingInput(t *testing.T) {
+	if isStdin("") {
+		t.Skip("stdin is piped, an empty input is valid")
+	}
+	config := &Configuration{Output: "output.yaml"}
+	config.Include = []trimmer.IncludeItem{{Key: "foo"}}
+	if err := config.validate(); err == nil || !strings.Contains(err.Error(), "input: no input is given") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
 
-	// get the indent level from the first line
-	indent := 0
-	for _, c := range inputYAML {
-		if c == ' ' {
-			indent++
-		} else {
-			break
+func Test_validate_defaults(t *testing.T) {
+	config := &Configuration{Input: "input.yaml", Output: "output.json", Cache: CacheConfig{Enabled: true}}
+	config.Include = []trimmer.IncludeItem{{Key: "foo"}}
+	if err := config.validate(); err != nil {
+		t.Fatalf("failed to validate configuration: %v", err)
+	}
+
+	if config.OutputFormat != trimmer.FormatJSON {
+		t.Errorf("unexpected output format: %q", config.OutputFormat)
+	}
+	if filepath.Base(config.Cache.Path) != ".yamltrimmer-cache" {
+		t.Errorf("unexpected cache path: %q", config.Cache.Path)
+	}
+}
+
+func Test_readInputs(t *testing.T) {
+	dir := t.TempDir()
+	basePath := filepath.Join(dir, "base.yaml")
+	overridesPath := filepath.Join(dir, "overrides.yaml")
+	if err := os.WriteFile(basePath, []byte("name: base\nkind: A"), 0644); err != nil {
+		t.Fatalf("failed to write base file: %v", err)
+	}
+	if err := os.WriteFile(overridesPath, []byte("---\nname: overrides\nkind: B\n"), 0644); err != nil {
+		t.Fatalf("failed to write overrides file: %v", err)
+	}
+
+	config := &Configuration{Inputs: []string{basePath, overridesPath}}
+	config.Include = []trimmer.IncludeItem{{Key: "name"}}
+
+	content, err := readInputs(context.Background(), config, mustNewDownloader(t, config.HTTP))
+	if err != nil {
+		t.Fatalf("failed to read inputs: %v", err)
+	}
+
+	trimmed, err := config.Trim(content)
+	if err != nil {
+		t.Fatalf("failed to trim inputs: %v", err)
+	}
+
+	expected := "name: base\n---\nname: overrides\n"
+	if string(trimmed) != expected {
+		t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", string(trimmed), expected)
+	}
+}
+
+func Test_readInputs_directory(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"b.yml":             "name: second\n",
+		"a.yaml":            "name: first\n",
+		"notes.txt":         "name: skipped\n",
+		"nested/c.yaml":     "name: nested\n",
+		"nested/deep/d.yml": "name: deep\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
 		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		recursive bool
+		expected  string
+	}{
+		{
+			name:     "top level files",
+			expected: "name: first\n---\nname: second\n",
+		},
+		{
+			name:      "recursive",
+			recursive: true,
+			expected:  "name: first\n---\nname: second\n---\nname: nested\n---\nname: deep\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Configuration{Input: dir, RecursiveInputs: tt.recursive}
+			config.Include = []trimmer.IncludeItem{{Key: "name"}}
+
+			content, err := readInputs(context.Background(), config, mustNewDownloader(t, config.HTTP))
+			if err != nil {
+				t.Fatalf("failed to read inputs: %v", err)
+			}
+			trimmed, err := config.Trim(content)
+			if err != nil {
+				t.Fatalf("failed to trim inputs: %v", err)
+			}
+			if string(trimmed) != tt.expected {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", string(trimmed), tt.expected)
+			}
+		})
+	}
+
+	// A directory without YAML files is an error
+	config := &Configuration{Input: t.TempDir()}
+	if _, err := readInputs(context.Background(), config, mustNewDownloader(t, config.HTTP)); err == nil || !strings.Contains(err.Error(), "has no .yaml or .yml files") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_readInputs_json(t *testing.T) {
+	dir := t.TempDir()
+	firstPath := filepath.Join(dir, "first.json")
+	secondPath := filepath.Join(dir, "second.json")
+	if err := os.WriteFile(firstPath, []byte(`{"name": "first", "kind": "A"}`), 0644); err != nil {
+		t.Fatalf("failed to write first file: %v", err)
+	}
+	if err := os.WriteFile(secondPath, []byte(`{"name": "second", "kind": "B"}`), 0644); err != nil {
+		t.Fatalf("failed to write second file: %v", err)
+	}
+
+	config := &Configuration{Inputs: []string{firstPath, secondPath}}
+	config.Include = []trimmer.IncludeItem{{Key: "name"}}
+	if format := config.inputFormat(); format != trimmer.FormatJSON {
+		t.Fatalf("unexpected input format: %q", format)
+	}
+
+	content, err := readInputs(context.Background(), config, mustNewDownloader(t, config.HTTP))
+	if err != nil {
+		t.Fatalf("failed to read inputs: %v", err)
+	}
+
+	trimmed, err := config.Trim(content)
+	if err != nil {
+		t.Fatalf("failed to trim inputs: %v", err)
 	}
 
-	// unindent the input YAML
-	lines := strings.Split(inputYAML, "\n")
-	for i, line := range lines {
-		lines[i] = line[indent:]
+	expected := "{\n  \"name\": \"first\"\n}\n{\n  \"name\": \"second\"\n}\n"
+	if string(trimmed) != expected {
+		t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", string(trimmed), expected)
 	}
-	return strings.TrimSpace(strings.Join(lines, "\n"))
 }
 
-func parseRules(rules string) (*Configuration, error) {
-	var config Configuration
-	decoder := yaml.NewDecoder(strings.NewReader(rules))
-	if err := decoder.Decode(&config); err != nil {
-		return nil, fmt.Errorf("error parsing YAML: %w", err)
+func Test_readInputs_concurrency(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	fetched := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		fetched[r.URL.Path] = true
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprintf(w, "name: %s\n", strings.TrimPrefix(r.URL.Path, "/"))
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	config := &Configuration{
+		Cache: CacheConfig{Enabled: true, Path: t.TempDir()},
+		HTTP:  HTTPConfig{Concurrency: 2},
+	}
+	var expected []string
+	for i := 0; i < 6; i++ {
+		config.Inputs = append(config.Inputs, fmt.Sprintf("%s/input-%d", server.URL, i))
+		expected = append(expected, fmt.Sprintf("name: input-%d\n", i))
+	}
+
+	content, err := readInputs(context.Background(), config, mustNewDownloader(t, config.HTTP))
+	if err != nil {
+		t.Fatalf("failed to read inputs: %v", err)
+	}
+
+	if len(fetched) != 6 {
+		t.Errorf("expected 6 inputs to be fetched, got %d", len(fetched))
+	}
+	if maxInFlight > 2 {
+		t.Errorf("expected at most 2 downloads at the same time, got %d", maxInFlight)
+	}
+	if string(content) != strings.Join(expected, "\n---\n") {
+		t.Errorf("unexpected content, the inputs are not in order:\n%s", string(content))
 	}
-	return &config, nil
 }
@@ -0,0 +1,56 @@
+package trimmer
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// checkBounds checks the min of the rules and their nested rules is not greater than their max
+func checkBounds(rules []IncludeItem) error {
+	for _, rule := range rules {
+		if rule.Min != nil && rule.Max != nil && *rule.Min > *rule.Max {
+			return fmt.Errorf("rule %q: min %v is greater than max %v", rule.name(), *rule.Min, *rule.Max)
+		}
+		if err := checkBounds(rule.nestedRules()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameBound checks if two rules have the same bound, or both have none
+func sameBound(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// inBounds checks if the value is a number within the min and the max of the rule, if it has any.
+// The values that are not numbers, including the quoted ones, are out of the bounds, or are an error in strict mode.
+func (f *filter) inBounds(rule IncludeItem, path string, valueNode *yaml.Node) (bool, error) {
+	if rule.Min == nil && rule.Max == nil {
+		return true, nil
+	}
+
+	scalarNode := valueNode
+	if scalarNode.Kind == yaml.AliasNode {
+		scalarNode = scalarNode.Alias
+	}
+	var number float64
+	if tag := scalarNode.ShortTag(); scalarNode.Kind != yaml.ScalarNode || (tag != "!!int" && tag != "!!float") || scalarNode.Decode(&number) != nil {
+		if f.config.Strict {
+			return false, fmt.Errorf("min and max of %q only apply to numbers at line %d, column %d", path, valueNode.Line, valueNode.Column)
+		}
+		logrus.Debugf("Skipping %q, it is not a number", path)
+		return false, nil
+	}
+
+	if (rule.Min != nil && number < *rule.Min) || (rule.Max != nil && number > *rule.Max) {
+		logrus.Debugf("Skipping %q, %v is out of the bounds", path, number)
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,148 @@
+package trimmer
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_bounds(t *testing.T) {
+	input := unindent(`
+    metrics:
+      requests: 1200
+      errors: 3
+      latency: 0.25
+      uptime: 99.9
+      name: api
+      quoted: "5000"
+      buckets: [1, 2]
+    nested:
+      first:
+        errors: 12
+      second:
+        errors: 0
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		strict       bool
+		expectedYAML string
+		errorMessage string
+	}{
+		{
+			name: "min",
+			rules: `
+            include:
+              - key: metrics.*
+                min: 100
+            `,
+			expectedYAML: `
+            metrics:
+              requests: 1200
+            `,
+		},
+		{
+			name: "max",
+			rules: `
+            include:
+              - key: metrics.*
+                max: 5
+            `,
+			expectedYAML: `
+            metrics:
+              errors: 3
+              latency: 0.25
+            `,
+		},
+		{
+			name: "min and max",
+			rules: `
+            include:
+              - key: metrics.*
+                min: 1
+                max: 100
+            `,
+			expectedYAML: `
+            metrics:
+              errors: 3
+              uptime: 99.9
+            `,
+		},
+		{
+			name: "bounds included",
+			rules: `
+            include:
+              - key: metrics.errors
+                min: 3
+                max: 3
+            `,
+			expectedYAML: `
+            metrics:
+              errors: 3
+            `,
+		},
+		{
+			name: "recursive",
+			rules: `
+            include:
+              - key: errors
+                recursive: true
+                min: 1
+            `,
+			expectedYAML: `
+            metrics:
+              errors: 3
+            nested:
+              first:
+                errors: 12
+            `,
+		},
+		{
+			name: "not a number in strict mode",
+			rules: `
+            include:
+              - key: metrics.name
+                min: 1
+            `,
+			strict:       true,
+			errorMessage: `min and max of "metrics.name" only apply to numbers at line 6, column 9`,
+		},
+		{
+			name: "min greater than max",
+			rules: `
+            include:
+              - key: metrics.errors
+                min: 10
+                max: 1
+            `,
+			errorMessage: `rule "errors": min 10 is greater than max 1`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+			config.Strict = tt.strict
+
+			output, err := config.Trim([]byte(input))
+			if tt.errorMessage != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMessage) {
+					t.Errorf("expected error containing %q, got: %v", tt.errorMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package trimmer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// detectFormat sniffs the format of the input.
+// The input is JSON if it starts like a JSON object or array and all of it is valid JSON,
+// so that YAML documents in flow style are still treated as YAML.
+func detectFormat(input []byte) string {
+	trimmed := bytes.TrimSpace(input)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return FormatYAML
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	for {
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err == io.EOF {
+			return FormatJSON
+		} else if err != nil {
+			return FormatYAML
+		}
+	}
+}
+
+// inputFormat returns the configured input format, or the format detected from the input if none is configured
+func (config *Configuration) inputFormat(input []byte) string {
+	if config.InputFormat != "" {
+		return config.InputFormat
+	}
+	format := detectFormat(input)
+	logrus.Debugf("Detected input format: %s", format)
+	return format
+}
+
+// decodeDocuments parses the documents of the input in the given format
+func decodeDocuments(input []byte, format string) ([]*yaml.Node, error) {
+	next, err := newDocumentDecoder(bytes.NewReader(input), format)
+	if err != nil {
+		return nil, err
+	}
+	var documents []*yaml.Node
+	for {
+		document, err := next()
+		if err == io.EOF {
+			return documents, nil
+		} else if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+}
+
+// The errors of the inputs without any content to trim
+var (
+	errEmptyInput          = fmt.Errorf("no content in the input YAML, the input is empty")
+	errCommentOnlyInput    = fmt.Errorf("no content in the input YAML, the input has only comments")
+	errEmptyDocumentsInput = fmt.Errorf("no content in the input YAML, the input has only empty documents")
+)
+
+// decodeContent parses the documents of the input like decodeDocuments,
+// but fails if none of the documents has content, with an error telling why
+func decodeContent(input []byte, format string) ([]*yaml.Node, error) {
+	// The whitespace only input is checked first, as the YAML parser fails on the tabs
+	if len(bytes.TrimSpace(input)) == 0 {
+		return nil, errEmptyInput
+	}
+	documents, err := decodeDocuments(input, format)
+	if err != nil {
+		return nil, err
+	}
+	for _, document := range documents {
+		if !isEmptyDocument(document) {
+			return documents, nil
+		}
+	}
+	return nil, noContentError(true, len(documents))
+}
+
+// noContentError returns the error of an input without content,
+// given whether it has any characters other than whitespace and the number of its empty documents
+func noContentError(text bool, documents int) error {
+	switch {
+	case !text:
+		return errEmptyInput
+	case documents == 0:
+		return errCommentOnlyInput
+	default:
+		return errEmptyDocumentsInput
+	}
+}
+
+// textReader is a reader recording whether it has read any characters other than whitespace
+type textReader struct {
+	reader io.Reader
+	text   bool
+}
+
+func (r *textReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if !r.text && len(bytes.TrimSpace(p[:n])) > 0 {
+		r.text = true
+	}
+	return n, err
+}
+
+// newDocumentDecoder returns a function parsing the next document of the input in the given format into a document node.
+// The function returns io.EOF after the last document.
+func newDocumentDecoder(reader io.Reader, format string) (func() (*yaml.Node, error), error) {
+	switch format {
+	case FormatYAML:
+		return yamlDocumentDecoder(reader), nil
+	case FormatJSON:
+		return jsonDocumentDecoder(reader), nil
+	default:
+		return nil, fmt.Errorf("unsupported input format: %q", format)
+	}
+}
+
+// yamlDocumentDecoder parses the YAML documents of the reader one by one into document nodes
+func yamlDocumentDecoder(reader io.Reader) func() (*yaml.Node, error) {
+	decoder := yaml.NewDecoder(reader)
+	return func() (*yaml.Node, error) {
+		var document yaml.Node
+		if err := decoder.Decode(&document); err == io.EOF {
+			return nil, io.EOF
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal input YAML: %w", err)
+		}
+		resolveMergeKeys(&document)
+		return &document, nil
+	}
+}
+
+// scanDirectives returns the directive lines, like "%TAG ! tag:example.com,2000:", of every YAML document of the input.
+// The documents are counted like the decoder does, a "---" or a content line outside a document starts a new one
+// and a "..." ends the current one.
+func scanDirectives(input []byte) [][]string {
+	var directives [][]string
+	var pending []string
+	open := false
+	for _, line := range strings.Split(string(input), "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case strings.HasPrefix(line, "%") && !open:
+			pending = append(pending, strings.TrimRight(line, " \t"))
+		case isMarker(line, "---"):
+			directives = append(directives, pending)
+			pending = nil
+			open = true
+		case isMarker(line, "..."):
+			open = false
+		case !open && strings.TrimSpace(line) != "" && !strings.HasPrefix(strings.TrimSpace(line), "#"):
+			directives = append(directives, pending)
+			pending = nil
+			open = true
+		}
+	}
+	return directives
+}
+
+// isMarker returns true if the line is the document marker, optionally followed by content like in "--- foo"
+func isMarker(line, marker string) bool {
+	return line == marker || strings.HasPrefix(line, marker+" ") || strings.HasPrefix(line, marker+"\t")
+}
+
+// jsonDocumentDecoder parses the JSON values of the reader one by one into document nodes.
+// The values are parsed as YAML, as JSON is valid YAML, to keep the order of the keys.
+func jsonDocumentDecoder(reader io.Reader) func() (*yaml.Node, error) {
+	decoder := json.NewDecoder(reader)
+	return func() (*yaml.Node, error) {
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err == io.EOF {
+			return nil, io.EOF
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal input JSON: %w", err)
+		}
+
+		var document yaml.Node
+		if err := yaml.Unmarshal(value, &document); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal input JSON: %w", err)
+		}
+		resetStyle(&document)
+		return &document, nil
+	}
+}
+
+// resetStyle clears the flow and quoting styles parsed from the JSON syntax,
+// so that JSON input is written as block style YAML
+func resetStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetStyle(child)
+	}
+}
+
+// findDuplicateKeys returns the keys that appear more than once in a mapping under the node,
+// as paths with the lines they appear on
+func findDuplicateKeys(path string, node *yaml.Node) []string {
+	var duplicates []string
+	switch node.Kind {
+	case yaml.MappingNode:
+		lines := map[string][]int{}
+		var keys []string
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if _, ok := lines[key]; !ok {
+				keys = append(keys, key)
+			}
+			lines[key] = append(lines[key], node.Content[i].Line)
+		}
+		for _, key := range keys {
+			if len(lines[key]) > 1 {
+				duplicates = append(duplicates, fmt.Sprintf("%s (lines %s)", joinPath(path, key), joinLines(lines[key])))
+			}
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			duplicates = append(duplicates, findDuplicateKeys(joinPath(path, node.Content[i].Value), node.Content[i+1])...)
+		}
+	case yaml.SequenceNode:
+		for i, element := range node.Content {
+			duplicates = append(duplicates, findDuplicateKeys(fmt.Sprintf("%s[%d]", path, i), element)...)
+		}
+	}
+	return duplicates
+}
+
+// joinLines formats the line numbers like "2, 5"
+func joinLines(lines []int) string {
+	formatted := make([]string, 0, len(lines))
+	for _, line := range lines {
+		formatted = append(formatted, strconv.Itoa(line))
+	}
+	return strings.Join(formatted, ", ")
+}
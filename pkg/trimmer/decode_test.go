@@ -0,0 +1,162 @@
+package trimmer
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func Test_detectFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "YAML mapping", input: "a: 1\n", expected: FormatYAML},
+		{name: "JSON object", input: "{\"a\": 1}\n", expected: FormatJSON},
+		{name: "JSON array", input: "  [1, 2]", expected: FormatJSON},
+		{name: "stream of JSON values", input: "{\"a\": 1}\n{\"a\": 2}\n", expected: FormatJSON},
+		{name: "YAML flow mapping", input: "{a: 1}\n", expected: FormatYAML},
+		{name: "empty", input: "", expected: FormatYAML},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectFormat([]byte(tt.input)); got != tt.expected {
+				t.Errorf("detectFormat() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_trimJSON(t *testing.T) {
+	rules := `
+    include:
+      - key: database
+        include:
+          - key: host
+      - key: tags
+    `
+	inputYAML := `
+    cache:
+      enabled: true
+    database:
+      host: localhost
+      port: 5432
+    tags:
+      - primary
+      - eu
+    `
+	inputJSON := `
+    {
+      "cache": {"enabled": true},
+      "database": {"host": "localhost", "port": 5432},
+      "tags": ["primary", "eu"]
+    }
+    `
+
+	config, err := parseRules(unindent(rules))
+	if err != nil {
+		t.Fatalf("failed to parse rules: %v", err)
+	}
+
+	outputYAML, err := config.Trim([]byte(unindent(inputYAML)))
+	if err != nil {
+		t.Fatalf("failed to trim YAML: %v", err)
+	}
+	expectedYAML := unindent(`
+    database:
+      host: localhost
+    tags:
+      - primary
+      - eu
+    `)
+	if strings.TrimSpace(string(outputYAML)) != expectedYAML {
+		t.Errorf("unexpected YAML output:\nGot:\n%s\nExpected:\n%s", outputYAML, expectedYAML)
+	}
+
+	// The same rules apply to JSON, and the output is JSON too
+	outputJSON, err := config.Trim([]byte(unindent(inputJSON)))
+	if err != nil {
+		t.Fatalf("failed to trim JSON: %v", err)
+	}
+	expectedJSON := unindent(`
+    {
+      "database": {
+        "host": "localhost"
+      },
+      "tags": [
+        "primary",
+        "eu"
+      ]
+    }
+    `)
+	if strings.TrimSpace(string(outputJSON)) != expectedJSON {
+		t.Errorf("unexpected JSON output:\nGot:\n%s\nExpected:\n%s", outputJSON, expectedJSON)
+	}
+
+	// The output format can still be overridden
+	config.OutputFormat = FormatYAML
+	output, err := config.Trim([]byte(unindent(inputJSON)))
+	if err != nil {
+		t.Fatalf("failed to trim JSON: %v", err)
+	}
+	if string(output) != string(outputYAML) {
+		t.Errorf("unexpected output:\nGot:\n%s\nExpected:\n%s", output, outputYAML)
+	}
+}
+
+func Test_decodeJSON_stream(t *testing.T) {
+	config := &Configuration{Include: []IncludeItem{{Key: "name"}}}
+	output, err := config.Trim([]byte("{\"name\": \"a\", \"kind\": \"A\"}\n{\"name\": \"b\", \"kind\": \"B\"}\n"))
+	if err != nil {
+		t.Fatalf("failed to trim JSON: %v", err)
+	}
+	expected := "{\n  \"name\": \"a\"\n}\n{\n  \"name\": \"b\"\n}\n"
+	if string(output) != expected {
+		t.Errorf("unexpected output:\nGot:\n%s\nExpected:\n%s", output, expected)
+	}
+}
+
+func Test_strictParse(t *testing.T) {
+	input := []byte("name: first\ndatabase:\n  host: localhost\n  port: 5432\n  host: remote\nname: second\n")
+
+	config := Configuration{StrictParse: true}
+	_, err := config.Trim(input)
+	expected := "duplicate keys in input YAML document 0: name (lines 1, 6), database.host (lines 3, 5)"
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// without the option, the duplicate keys are kept
+	config.StrictParse = false
+	if _, err := config.Trim(input); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_emptyInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected error
+	}{
+		{name: "empty", input: "", expected: errEmptyInput},
+		{name: "whitespace only", input: "  \n\t\n", expected: errEmptyInput},
+		{name: "comments only", input: "# nothing here\n\n# yet\n", expected: errCommentOnlyInput},
+		{name: "empty documents", input: "---\n---\n...\n", expected: errEmptyDocumentsInput},
+		{name: "empty documents with comments", input: "# first\n---\n# second\n", expected: errEmptyDocumentsInput},
+	}
+
+	config := &Configuration{Include: []IncludeItem{{Key: "name"}}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := config.Trim([]byte(tt.input)); err != tt.expected {
+				t.Errorf("unexpected error: %v, expected %v", err, tt.expected)
+			}
+			// The streaming tells the same cases apart
+			if err := config.TrimStream(strings.NewReader(tt.input), io.Discard); err != tt.expected {
+				t.Errorf("unexpected streaming error: %v, expected %v", err, tt.expected)
+			}
+		})
+	}
+}
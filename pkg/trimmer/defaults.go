@@ -0,0 +1,122 @@
+package trimmer
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mergeRootDefaults merges the defaults into the root of a trimmed document, or into each mapping element of a sequence root
+func mergeRootDefaults(outputNode, defaults *yaml.Node) {
+	if outputNode.Kind != yaml.SequenceNode {
+		mergeDefaults(outputNode, defaults)
+		return
+	}
+	for _, element := range outputNode.Content {
+		if element.Kind == yaml.MappingNode {
+			mergeDefaults(element, defaults)
+		}
+	}
+}
+
+// mergeDefaults deep merges the default values into the output mapping.
+// The values of the output win, the mappings on both sides are merged recursively and other values,
+// including sequences, are not merged but kept as they are in the output.
+// The merged mappings are copies, so that the input nodes kept as they are in the output, and their aliases, are never changed.
+func mergeDefaults(outputNode, defaults *yaml.Node) {
+	for i := 0; i+1 < len(defaults.Content); i += 2 {
+		defaultKey := defaults.Content[i]
+		defaultValue := defaults.Content[i+1]
+
+		index := findValueIndex(outputNode, defaultKey.Value)
+		if index == -1 {
+			outputNode.Content = append(outputNode.Content, deepCopy(defaultKey), deepCopy(defaultValue))
+			continue
+		}
+		existing := outputNode.Content[index]
+		if existing.Kind == yaml.MappingNode && defaultValue.Kind == yaml.MappingNode {
+			merged := &yaml.Node{}
+			copyProperties(existing, merged)
+			merged.Content = append([]*yaml.Node{}, existing.Content...)
+			mergeDefaults(merged, defaultValue)
+			outputNode.Content[index] = merged
+		}
+	}
+}
+
+// findValueIndex returns the position of the value of the key in the mapping, or -1 if the key is not there
+func findValueIndex(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// deepCopy copies the node with all of its descendants,
+// so that the same defaults can be merged into multiple documents
+func deepCopy(node *yaml.Node) *yaml.Node {
+	copied := *node
+	copied.Content = nil
+	for _, child := range node.Content {
+		copied.Content = append(copied.Content, deepCopy(child))
+	}
+	return &copied
+}
+
+// checkRuleDefaults checks the rules with a default and their nested rules match a literal key, as a default needs a key to be emitted with
+func checkRuleDefaults(rules []IncludeItem) error {
+	for _, rule := range rules {
+		if rule.Default.Kind != 0 && !rule.isLiteral() {
+			return fmt.Errorf("rule %q: default can only be used with a literal key", rule.name())
+		}
+		if err := checkRuleDefaults(rule.nestedRules()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isLiteral checks if the rule matches a single literal key, not a pattern, a regular expression or a key at any depth
+func (rule IncludeItem) isLiteral() bool {
+	return rule.KeyRegex == "" && !rule.Recursive && !isPattern(rule.Key)
+}
+
+// hasKey checks if the mapping has the key, with any value
+func (f *filter) hasKey(mapping *yaml.Node, key string) bool {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if f.matchKey(key, mapping.Content[i].Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDefaults checks if any of the rules or their nested rules has a default
+func hasDefaults(rules []IncludeItem) bool {
+	for _, rule := range rules {
+		if rule.Default.Kind != 0 || hasDefaults(rule.Include) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultValue returns a copy of the default value of a rule matching no key.
+// A rule without a default uses an empty mapping filtered with its nested rules, so that a missing "database"
+// is emitted with the defaults of its nested rules, like the one of "database.timeout".
+// It returns nil if nothing is left of the empty mapping and the empty branches are dropped.
+func (f *filter) defaultValue(rule IncludeItem, path string) (*yaml.Node, error) {
+	if rule.Default.Kind != 0 {
+		return deepCopy(&rule.Default), nil
+	}
+	nestedOutputNode, err := f.filterValue(rule.Include, nil, joinPath(path, rule.Key), &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+	if err != nil {
+		return nil, err
+	}
+	if f.dropsEmpty(nestedOutputNode) {
+		return nil, nil
+	}
+	return nestedOutputNode, nil
+}
@@ -0,0 +1,224 @@
+package trimmer
+
+import (
+	"testing"
+)
+
+func Test_defaults(t *testing.T) {
+	input := unindent(`
+    database:
+      host: db.example.com
+      tags:
+        - primary
+    cache:
+      enabled: true
+    ---
+    database:
+      port: 3306
+    `)
+
+	config, err := parseRules(unindent(`
+    include:
+      - key: database
+    defaults:
+      database:
+        host: localhost
+        port: 5432
+        tags:
+          - default
+      replicas: 1
+    `))
+	if err != nil {
+		t.Fatalf("failed to parse rules: %v", err)
+	}
+
+	output, err := config.Trim([]byte(input))
+	if err != nil {
+		t.Fatalf("failed to trim input YAML: %v", err)
+	}
+
+	expectedYAML := unindent(`
+    database:
+      host: db.example.com
+      tags:
+        - primary
+      port: 5432
+    replicas: 1
+    ---
+    database:
+      port: 3306
+      host: localhost
+      tags:
+        - default
+    replicas: 1
+    `)
+	gotYAML := unindent(string(output))
+	if gotYAML != expectedYAML {
+		t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+	}
+}
+
+func Test_defaults_anchors(t *testing.T) {
+	input := unindent(`
+    database: &database
+      host: db.example.com
+    replica: *database
+    `)
+
+	config, err := parseRules(unindent(`
+    include:
+      - key: database
+      - key: replica
+    defaults:
+      database:
+        port: 5432
+    `))
+	if err != nil {
+		t.Fatalf("failed to parse rules: %v", err)
+	}
+
+	output, err := config.Trim([]byte(input))
+	if err != nil {
+		t.Fatalf("failed to trim input YAML: %v", err)
+	}
+
+	// The defaults of the anchored mapping don't show up at its alias
+	expectedYAML := unindent(`
+    database:
+      host: db.example.com
+      port: 5432
+    replica:
+      host: db.example.com
+    `)
+	gotYAML := unindent(string(output))
+	if gotYAML != expectedYAML {
+		t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+	}
+
+	// The defaults are not merged into the parsed input either, trimming again gives the same result
+	again, err := config.Trim([]byte(input))
+	if err != nil {
+		t.Fatalf("failed to trim input YAML: %v", err)
+	}
+	if string(again) != string(output) {
+		t.Errorf("unexpected result of the second trimming:\n%s", again)
+	}
+}
+
+func Test_defaults_notMapping(t *testing.T) {
+	config, err := parseRules("defaults: [a, b]\n")
+	if err != nil {
+		t.Fatalf("failed to parse rules: %v", err)
+	}
+	if _, err := config.Trim([]byte("foo: bar")); err == nil || err.Error() != "defaults must be a mapping at line 1, column 11" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_ruleDefaults(t *testing.T) {
+	input := unindent(`
+    database:
+      host: db.example.com
+    replicas: 3
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		expectedYAML string
+		errorMessage string
+	}{
+		{
+			name: "missing key",
+			rules: `
+            include:
+              - key: replicas
+                default: 1
+              - key: logLevel
+                default: info
+            `,
+			expectedYAML: `
+            replicas: 3
+            logLevel: info
+            `,
+		},
+		{
+			name: "missing subtree",
+			rules: `
+            include:
+              - key: tls
+                default:
+                  enabled: false
+                  ciphers: [a, b]
+            `,
+			expectedYAML: `
+            tls:
+              enabled: false
+              ciphers: [a, b]
+            `,
+		},
+		{
+			name: "nested key",
+			rules: `
+            include:
+              - key: database.timeout
+                default: 30
+              - key: cache.ttl
+                default: 60
+            `,
+			expectedYAML: `
+            database:
+              timeout: 30
+            cache:
+              ttl: 60
+            `,
+		},
+		{
+			name: "renamed",
+			rules: `
+            include:
+              - key: logLevel
+                as: level
+                default: info
+            `,
+			expectedYAML: `
+            level: info
+            `,
+		},
+		{
+			name: "pattern",
+			rules: `
+            include:
+              - key: "log*"
+                default: info
+            `,
+			errorMessage: `rule "log*": default can only be used with a literal key`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+
+			output, err := config.Trim([]byte(input))
+			if tt.errorMessage != "" {
+				if err == nil || err.Error() != tt.errorMessage {
+					t.Errorf("expected error %q, got: %v", tt.errorMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package trimmer
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+// truncateRoot truncates the trimmed root node of a document to MaxDepth levels.
+// The elements of a sequence root are truncated like the roots of documents, the same way the rules apply to them.
+func (config *Configuration) truncateRoot(root *yaml.Node) *yaml.Node {
+	if root.Kind != yaml.SequenceNode {
+		return config.truncateDepth(root, 0)
+	}
+	truncated := *root
+	truncated.Content = make([]*yaml.Node, 0, len(root.Content))
+	for _, element := range root.Content {
+		truncated.Content = append(truncated.Content, config.truncateDepth(element, 0))
+	}
+	return &truncated
+}
+
+// truncateDepth returns a copy of the node at the given level with the mappings and the sequences below MaxDepth levels emptied,
+// or dropped with the drop policy for the empty branches. The scalars are kept at all the levels.
+// The collections are copied, as they may be shared with the input, and their aliases are inlined,
+// as their anchors may be in the truncated values.
+func (config *Configuration) truncateDepth(node *yaml.Node, level int) *yaml.Node {
+	if node.Kind == yaml.AliasNode && isCollection(node.Alias) {
+		inlined := *node.Alias
+		inlined.HeadComment = node.HeadComment
+		inlined.LineComment = node.LineComment
+		inlined.FootComment = node.FootComment
+		node = &inlined
+	}
+	if !isCollection(node) {
+		return node
+	}
+
+	truncated := *node
+	truncated.Anchor = ""
+	truncated.Content = nil
+	if level >= config.MaxDepth {
+		return &truncated
+	}
+
+	keep := func(value *yaml.Node) bool {
+		return config.EmptyBranches != EmptyDrop || !isCollection(value) || len(value.Content) > 0
+	}
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if value := config.truncateDepth(node.Content[i+1], level+1); keep(value) {
+				truncated.Content = append(truncated.Content, node.Content[i], value)
+			}
+		}
+		return &truncated
+	}
+	for _, element := range node.Content {
+		if value := config.truncateDepth(element, level+1); keep(value) {
+			truncated.Content = append(truncated.Content, value)
+		}
+	}
+	return &truncated
+}
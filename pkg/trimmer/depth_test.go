@@ -0,0 +1,135 @@
+package trimmer
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_maxDepth(t *testing.T) {
+	input := unindent(`
+    name: app
+    spec:
+      replicas: 2
+      template:
+        image: app:1.0
+    defaults: &defaults
+      timeout: 30
+    ports:
+      - 8080
+    override: *defaults
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		expectedYAML string
+		errorMessage string
+	}{
+		{
+			name: "one level",
+			rules: `
+            maxDepth: 1
+            include:
+              - key: "*"
+            `,
+			expectedYAML: `
+            name: app
+            spec: {}
+            defaults: {}
+            ports: []
+            override: {}
+            `,
+		},
+		{
+			name: "two levels",
+			rules: `
+            maxDepth: 2
+            include:
+              - key: "*"
+            `,
+			expectedYAML: `
+            name: app
+            spec:
+              replicas: 2
+              template: {}
+            defaults:
+              timeout: 30
+            ports:
+              - 8080
+            override:
+              timeout: 30
+            `,
+		},
+		{
+			name: "after the rules",
+			rules: `
+            maxDepth: 2
+            include:
+              - key: spec.template.image
+            `,
+			expectedYAML: `
+            spec:
+              template: {}
+            `,
+		},
+		{
+			name: "dropped with the empty branches",
+			rules: `
+            maxDepth: 1
+            emptyBranches: drop
+            include:
+              - key: name
+              - key: spec
+            `,
+			expectedYAML: `
+            name: app
+            `,
+		},
+		{
+			name: "negative",
+			rules: `
+            maxDepth: -1
+            include:
+              - key: name
+            `,
+			errorMessage: "maxDepth: must not be negative, got -1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+
+			output, err := config.Trim([]byte(input))
+			if tt.errorMessage != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMessage) {
+					t.Errorf("expected error containing %q, got: %v", tt.errorMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
+
+func Test_maxDepth_sequenceRoot(t *testing.T) {
+	config := Configuration{MaxDepth: 1, Include: []IncludeItem{{Key: "*"}}}
+	output, err := config.Trim([]byte("- name: a\n  spec:\n    replicas: 1\n- name: b\n"))
+	if err != nil {
+		t.Fatalf("failed to trim input YAML: %v", err)
+	}
+	if expected := "- name: a\n  spec: {}\n- name: b\n"; string(output) != expected {
+		t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", string(output), expected)
+	}
+}
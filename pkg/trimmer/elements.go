@@ -0,0 +1,107 @@
+package trimmer
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// nestedRules returns the nested rules of the rule, with the rules of its elements
+func (rule IncludeItem) nestedRules() []IncludeItem {
+	if len(rule.Elements) == 0 {
+		return rule.Include
+	}
+	nested := append([]IncludeItem{}, rule.Include...)
+	for _, element := range rule.Elements {
+		nested = append(nested, element.Include...)
+	}
+	return nested
+}
+
+// expandElementRules expands the dotted keys of the rules of the elements, like expandDottedKeys
+func expandElementRules(elements []ElementRules) []ElementRules {
+	if len(elements) == 0 {
+		return nil
+	}
+	expanded := make([]ElementRules, 0, len(elements))
+	for _, element := range elements {
+		element.Include = expandDottedKeys(element.Include)
+		expanded = append(expanded, element)
+	}
+	return expanded
+}
+
+// checkElementRules checks the rules with the rules of elements and their nested rules don't use the options selecting the elements otherwise,
+// and don't list an element twice
+func checkElementRules(rules []IncludeItem) error {
+	for _, rule := range rules {
+		if len(rule.Elements) > 0 {
+			if len(rule.Include) > 0 || rule.Index != nil || rule.Where != nil || rule.Recursive {
+				return fmt.Errorf("rule %q: elements can't be used with include, index, where or recursive", rule.name())
+			}
+			indices := map[int]bool{}
+			for _, element := range rule.Elements {
+				if indices[element.Index] {
+					return fmt.Errorf("rule %q: index %d is listed more than once in elements", rule.name(), element.Index)
+				}
+				indices[element.Index] = true
+			}
+		}
+		if err := checkElementRules(rule.nestedRules()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filterElementRules returns a copy of a sequence value with only the elements the rule lists, each trimmed with its own rules.
+// The elements are kept in their order in the input. An out of range index is skipped, or an error in strict mode.
+func (f *filter) filterElementRules(rule IncludeItem, excludes []ExcludeItem, path string, valueNode *yaml.Node) (*yaml.Node, error) {
+	if valueNode.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("value of key %q is not a sequence node at line %d, column %d", rule.Key, valueNode.Line, valueNode.Column)
+	}
+
+	selected := map[int]ElementRules{}
+	for _, element := range rule.Elements {
+		index := element.Index
+		if index < 0 {
+			index += len(valueNode.Content)
+		}
+		if index < 0 || index >= len(valueNode.Content) {
+			if f.config.Strict {
+				return nil, fmt.Errorf("index %d is out of range for key %q with %d elements at line %d, column %d", element.Index, rule.Key, len(valueNode.Content), valueNode.Line, valueNode.Column)
+			}
+			logrus.Debugf("Index %d is out of range for key %q with %d elements, skipping", element.Index, rule.Key, len(valueNode.Content))
+			continue
+		}
+		// A negative index can target the same element as another one, the first one listed wins
+		if _, ok := selected[index]; !ok {
+			selected[index] = element
+		}
+	}
+
+	outputNode := &yaml.Node{}
+	copyProperties(valueNode, outputNode)
+	for i, element := range valueNode.Content {
+		elementRules, ok := selected[i]
+		if !ok {
+			continue
+		}
+		elementExcludes := append(append([]ExcludeItem{}, excludes...), elementRules.Exclude...)
+		if len(elementRules.Include) == 0 && (len(elementExcludes) == 0 || !isCollection(element)) {
+			outputNode.Content = append(outputNode.Content, element)
+			continue
+		}
+
+		filtered, err := f.filterValue(elementRules.Include, elementExcludes, fmt.Sprintf("%s[%d]", path, i), element)
+		if err != nil {
+			return nil, err
+		}
+		if f.dropsEmpty(filtered) {
+			continue
+		}
+		outputNode.Content = append(outputNode.Content, filtered)
+	}
+	return outputNode, nil
+}
@@ -0,0 +1,229 @@
+package trimmer
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_elementRules(t *testing.T) {
+	input := unindent(`
+    containers:
+      - name: app
+        image: app:1.0
+        ports:
+          http: 8080
+          debug: 9090
+      - name: sidecar
+        image: proxy:2.1
+        ports:
+          admin: 15000
+      - name: init
+        image: busybox
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		strict       bool
+		expectedYAML string
+		errorMessage string
+	}{
+		{
+			name: "distinct rules per element",
+			rules: `
+            include:
+              - key: containers
+                elements:
+                  - index: 0
+                    include:
+                      - key: name
+                  - index: 1
+                    include:
+                      - key: image
+            `,
+			expectedYAML: `
+            containers:
+              - name: app
+              - image: proxy:2.1
+            `,
+		},
+		{
+			name: "elements are kept in the input order",
+			rules: `
+            include:
+              - key: containers
+                elements:
+                  - index: 2
+                    include:
+                      - key: name
+                  - index: 0
+                    include:
+                      - key: ports.http
+            `,
+			expectedYAML: `
+            containers:
+              - ports:
+                  http: 8080
+              - name: init
+            `,
+		},
+		{
+			name: "element without rules is kept whole",
+			rules: `
+            include:
+              - key: containers
+                elements:
+                  - index: -1
+            `,
+			expectedYAML: `
+            containers:
+              - name: init
+                image: busybox
+            `,
+		},
+		{
+			name: "exclusions of an element",
+			rules: `
+            include:
+              - key: containers
+                elements:
+                  - index: 0
+                    exclude:
+                      - key: ports
+                  - index: 1
+                    include:
+                      - key: name
+            `,
+			expectedYAML: `
+            containers:
+              - name: app
+                image: app:1.0
+              - name: sidecar
+            `,
+		},
+		{
+			name: "out of range index is skipped",
+			rules: `
+            include:
+              - key: containers
+                elements:
+                  - index: 5
+                  - index: 1
+                    include:
+                      - key: name
+            `,
+			expectedYAML: `
+            containers:
+              - name: sidecar
+            `,
+		},
+		{
+			name: "out of range index in strict mode",
+			rules: `
+            include:
+              - key: containers
+                elements:
+                  - index: 5
+            `,
+			strict:       true,
+			errorMessage: `index 5 is out of range for key "containers" with 3 elements at line 2, column 3`,
+		},
+		{
+			name: "same name in different elements in strict mode",
+			rules: `
+            include:
+              - key: containers
+                elements:
+                  - index: 0
+                    include:
+                      - key: name
+                  - index: 1
+                    include:
+                      - key: name
+            `,
+			strict: true,
+			expectedYAML: `
+            containers:
+              - name: app
+              - name: sidecar
+            `,
+		},
+		{
+			name: "not a sequence",
+			rules: `
+            include:
+              - key: containers
+                elements:
+                  - index: 0
+                    include:
+                      - key: name
+                        elements:
+                          - index: 0
+            `,
+			errorMessage: `value of key "name" is not a sequence node at line 2, column 11`,
+		},
+		{
+			name: "with include",
+			rules: `
+            include:
+              - key: containers
+                include:
+                  - key: name
+                elements:
+                  - index: 0
+            `,
+			errorMessage: `rule "containers": elements can't be used with include, index, where or recursive`,
+		},
+		{
+			name: "index listed twice",
+			rules: `
+            include:
+              - key: containers
+                elements:
+                  - index: 0
+                  - index: 0
+            `,
+			errorMessage: `rule "containers": index 0 is listed more than once in elements`,
+		},
+		{
+			name: "invalid nested rule",
+			rules: `
+            include:
+              - key: containers
+                elements:
+                  - index: 0
+                    include:
+                      - key: name
+                        transform: reverse
+            `,
+			errorMessage: `rule "name": unsupported transform "reverse"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+			config.Strict = tt.strict
+
+			output, err := config.Trim([]byte(input))
+			if tt.errorMessage != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMessage) {
+					t.Errorf("expected error containing %q, got: %v", tt.errorMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package trimmer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// normalizeLineEndings converts the line endings of the encoded output to LF, or to CRLF with LineEndingCRLF.
+// The output is then the same on every platform, whatever the line endings of the input are.
+func normalizeLineEndings(content []byte, lineEnding string) []byte {
+	content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	if lineEnding == LineEndingCRLF {
+		content = bytes.ReplaceAll(content, []byte("\n"), []byte("\r\n"))
+	}
+	return content
+}
+
+// encodeYAML marshals the documents into YAML, separated by "---".
+// With explicitStart the first document starts with "---" too, and with explicitEnd every document ends with "...".
+// The directives of a document are written before its "---".
+func encodeYAML(documents []trimmedDocument, indent int, explicitStart, explicitEnd bool) ([]byte, error) {
+	var output bytes.Buffer
+	for i, document := range documents {
+		for _, directive := range document.directives {
+			output.WriteString(directive + "\n")
+		}
+		if i > 0 || explicitStart || len(document.directives) > 0 {
+			output.WriteString("---\n")
+		}
+
+		// Every document is encoded on its own, as the encoder writes the "---" separators only between the documents
+		var encoded bytes.Buffer
+		encoder := yaml.NewEncoder(&encoded)
+		encoder.SetIndent(indent)
+		if err := encoder.Encode(document.output); err != nil {
+			return nil, fmt.Errorf("failed to marshal output YAML: %w", err)
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, fmt.Errorf("failed to marshal output YAML: %w", err)
+		}
+		output.Write(encoded.Bytes())
+
+		if explicitEnd {
+			output.WriteString("...\n")
+		}
+	}
+	if len(documents) > 0 {
+		logrus.Debugf("Marshalled output YAML successfully")
+	}
+
+	return output.Bytes(), nil
+}
+
+// setStyle sets or clears the flow style of all the mappings and the sequences under the node, the scalars are left as they are.
+// The flow style drops the comments under the document, as the encoder writes them where they break the flow syntax.
+func setStyle(node *yaml.Node, flow bool) {
+	if flow && node.Kind != yaml.DocumentNode {
+		node.HeadComment = ""
+		node.LineComment = ""
+		node.FootComment = ""
+	}
+	if node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode {
+		if flow {
+			node.Style |= yaml.FlowStyle
+		} else {
+			node.Style &^= yaml.FlowStyle
+		}
+	}
+	for _, child := range node.Content {
+		setStyle(child, flow)
+	}
+}
+
+// encodeJSON marshals the documents into indented JSON, one value per document.
+// The keys are written in the order of the document, like in the YAML output.
+func encodeJSON(documents []*yaml.Node, indent int) ([]byte, error) {
+	var output bytes.Buffer
+	encoder := json.NewEncoder(&output)
+	encoder.SetIndent("", strings.Repeat(" ", indent))
+	// The values are kept as they are, like the URLs with "&", instead of being escaped for embedding in HTML
+	encoder.SetEscapeHTML(false)
+
+	for _, document := range documents {
+		value, err := toJSONValue(document)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode output YAML: %w", err)
+		}
+		if err := encoder.Encode(value); err != nil {
+			return nil, fmt.Errorf("failed to marshal output JSON: %w", err)
+		}
+	}
+	logrus.Debugf("Marshalled output JSON successfully")
+
+	return output.Bytes(), nil
+}
+
+// toJSONValue converts a node into a value marshalled into JSON the way YAML decodes it, but with the keys in their order.
+// Non-string keys are formatted as strings, and the special floats become strings.
+// Timestamps are left as they are, as they are marshalled in RFC 3339 format.
+func toJSONValue(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return toJSONValue(node.Content[0])
+	case yaml.AliasNode:
+		return toJSONValue(node.Alias)
+	case yaml.MappingNode:
+		object := &jsonObject{values: map[string]interface{}{}}
+		if err := object.addFields(node); err != nil {
+			return nil, err
+		}
+		return object, nil
+	case yaml.SequenceNode:
+		values := make([]interface{}, 0, len(node.Content))
+		for _, element := range node.Content {
+			value, err := toJSONValue(element)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	default:
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return nil, err
+		}
+		if v, ok := value.(float64); ok && (math.IsNaN(v) || math.IsInf(v, 0)) {
+			return fmt.Sprint(v), nil
+		}
+		return value, nil
+	}
+}
+
+// jsonObject is a JSON object keeping its keys in the order they are added, which a map doesn't
+type jsonObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// addFields adds the keys of a mapping with their values.
+// A later key replaces the value of an earlier one with the same name, but not its position.
+// The keys of a "<<" merge key are added only if the object doesn't have them yet, like the earlier merged keys.
+func (object *jsonObject) addFields(mapping *yaml.Node) error {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		keyNode, valueNode := mapping.Content[i], mapping.Content[i+1]
+		if keyNode.Tag == mergeTag {
+			for _, source := range mergeSources(valueNode) {
+				merged := &jsonObject{values: map[string]interface{}{}}
+				if err := merged.addFields(source); err != nil {
+					return err
+				}
+				for _, key := range merged.keys {
+					if _, ok := object.values[key]; !ok {
+						object.set(key, merged.values[key])
+					}
+				}
+			}
+			continue
+		}
+
+		var key interface{}
+		if err := keyNode.Decode(&key); err != nil {
+			return err
+		}
+		value, err := toJSONValue(valueNode)
+		if err != nil {
+			return err
+		}
+		object.set(fmt.Sprint(key), value)
+	}
+	return nil
+}
+
+// set sets the value of a key, adding the key after the others if the object doesn't have it
+func (object *jsonObject) set(key string, value interface{}) {
+	if _, ok := object.values[key]; !ok {
+		object.keys = append(object.keys, key)
+	}
+	object.values[key] = value
+}
+
+// MarshalJSON writes the keys in their order.
+// The HTML characters are not escaped here, the encoder of the output escapes them if it's set to.
+func (object *jsonObject) MarshalJSON() ([]byte, error) {
+	var output bytes.Buffer
+	encoder := json.NewEncoder(&output)
+	encoder.SetEscapeHTML(false)
+
+	output.WriteByte('{')
+	for i, key := range object.keys {
+		if i > 0 {
+			output.WriteByte(',')
+		}
+		if err := encoder.Encode(key); err != nil {
+			return nil, err
+		}
+		output.WriteByte(':')
+		if err := encoder.Encode(object.values[key]); err != nil {
+			return nil, err
+		}
+	}
+	output.WriteByte('}')
+	return output.Bytes(), nil
+}
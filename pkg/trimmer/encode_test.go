@@ -0,0 +1,396 @@
+package trimmer
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func Test_encodeJSON(t *testing.T) {
+	tests := []struct {
+		name         string
+		inputYAML    string
+		rules        string
+		expectedJSON string
+	}{
+		{
+			name: "trimmed document",
+			inputYAML: `
+            cache:
+              enabled: true
+            database:
+              host: localhost
+              port: 5432
+              tags:
+                - primary
+                - eu
+            `,
+			rules: `
+            outputFormat: json
+            include:
+              - key: database
+            `,
+			expectedJSON: `
+            {
+              "database": {
+                "host": "localhost",
+                "port": 5432,
+                "tags": [
+                  "primary",
+                  "eu"
+                ]
+              }
+            }
+            `,
+		},
+		{
+			name: "HTML characters",
+			inputYAML: `
+            url: https://example.com/search?q=a&page=2
+            template: <b>{{ .Name }}</b>
+            `,
+			rules: `
+            outputFormat: json
+            include:
+              - key: url
+              - key: template
+            `,
+			expectedJSON: `
+            {
+              "url": "https://example.com/search?q=a&page=2",
+              "template": "<b>{{ .Name }}</b>"
+            }
+            `,
+		},
+		{
+			name: "YAML-only types",
+			inputYAML: `
+            ports:
+              80: http
+              443: https
+            created: 2024-01-02T03:04:05Z
+            ratio: .nan
+            `,
+			rules: `
+            outputFormat: json
+            include:
+              - key: ports
+              - key: created
+              - key: ratio
+            `,
+			expectedJSON: `
+            {
+              "ports": {
+                "80": "http",
+                "443": "https"
+              },
+              "created": "2024-01-02T03:04:05Z",
+              "ratio": "NaN"
+            }
+            `,
+		},
+		{
+			name: "document order",
+			inputYAML: `
+            zone: eu
+            name: foo
+            metadata:
+              version: 2
+              author: bar
+            `,
+			rules: `
+            outputFormat: json
+            include:
+              - key: zone
+              - key: name
+              - key: metadata
+            `,
+			expectedJSON: `
+            {
+              "zone": "eu",
+              "name": "foo",
+              "metadata": {
+                "version": 2,
+                "author": "bar"
+              }
+            }
+            `,
+		},
+		{
+			name: "merge keys",
+			inputYAML: `
+            base: &base
+              port: 80
+              host: a
+            service:
+              name: foo
+              <<: *base
+              host: b
+            `,
+			rules: `
+            outputFormat: json
+            include:
+              - key: service
+            `,
+			expectedJSON: `
+            {
+              "service": {
+                "name": "foo",
+                "port": 80,
+                "host": "b"
+              }
+            }
+            `,
+		},
+		{
+			name: "multiple documents",
+			inputYAML: `
+            name: first
+            ---
+            name: second
+            `,
+			rules: `
+            outputFormat: json
+            include:
+              - key: name
+            `,
+			expectedJSON: `
+            {
+              "name": "first"
+            }
+            {
+              "name": "second"
+            }
+            `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+
+			output, err := config.Trim([]byte(unindent(tt.inputYAML)))
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotJSON := strings.TrimSpace(string(output))
+			expectedJSON := unindent(tt.expectedJSON)
+			if gotJSON != expectedJSON {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotJSON, expectedJSON)
+			}
+		})
+	}
+}
+
+func Test_unsupportedOutputFormat(t *testing.T) {
+	config := Configuration{OutputFormat: "toml"}
+	if _, err := config.Trim([]byte("foo: bar")); err == nil || !strings.Contains(err.Error(), "unsupported output format") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_indent(t *testing.T) {
+	input := []byte("database:\n  host: localhost\n  tags:\n    - primary\n")
+
+	config := Configuration{Indent: 4}
+	output, err := config.Trim(input)
+	if err != nil {
+		t.Fatalf("failed to trim input YAML: %v", err)
+	}
+	expected := "database:\n    host: localhost\n    tags:\n        - primary\n"
+	if string(output) != expected {
+		t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", string(output), expected)
+	}
+
+	config.OutputFormat = FormatJSON
+	output, err = config.Trim(input)
+	if err != nil {
+		t.Fatalf("failed to trim input YAML: %v", err)
+	}
+	expected = "{\n    \"database\": {\n        \"host\": \"localhost\",\n        \"tags\": [\n            \"primary\"\n        ]\n    }\n}\n"
+	if string(output) != expected {
+		t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", string(output), expected)
+	}
+
+	for _, indent := range []int{-1, 1, 10} {
+		config := Configuration{Indent: indent}
+		if _, err := config.Trim(input); err == nil || !strings.Contains(err.Error(), "indent must be between 2 and 9") {
+			t.Errorf("unexpected error for indent %d: %v", indent, err)
+		}
+	}
+}
+
+func Test_outputStyle(t *testing.T) {
+	input := []byte("database:\n  host: localhost\n  port: 5432\n  tags: [primary, \"eu west\"]\ndebug: true\n")
+
+	tests := []struct {
+		style    string
+		expected string
+	}{
+		{
+			style:    StyleFlow,
+			expected: "{database: {host: localhost, tags: [primary, \"eu west\"]}}\n",
+		},
+		{
+			style:    StyleBlock,
+			expected: "database:\n  host: localhost\n  tags:\n    - primary\n    - \"eu west\"\n",
+		},
+		{
+			expected: "database:\n  host: localhost\n  tags: [primary, \"eu west\"]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.style, func(t *testing.T) {
+			config := Configuration{
+				Include:     []IncludeItem{{Key: "database.host"}, {Key: "database.tags"}},
+				OutputStyle: tt.style,
+			}
+			output, err := config.Trim(input)
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+			if string(output) != tt.expected {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", string(output), tt.expected)
+			}
+		})
+	}
+
+	config := Configuration{OutputStyle: "compact"}
+	if _, err := config.Trim(input); err == nil || !strings.Contains(err.Error(), "outputStyle: unsupported style") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_outputStyle_comments(t *testing.T) {
+	input := []byte("# the head\n\n# the database\ndatabase: # the line\n  # the host\n  host: localhost # local\n  # the foot\ntags: [primary, eu] # the tags\n\n# the end\n")
+
+	config := Configuration{Include: []IncludeItem{{Key: "database"}, {Key: "tags"}}, OutputStyle: StyleFlow}
+	output, err := config.Trim(input)
+	if err != nil {
+		t.Fatalf("failed to trim input YAML: %v", err)
+	}
+
+	// The output must be valid YAML on its own, with the same content
+	var reparsed map[string]interface{}
+	if err := yaml.Unmarshal(output, &reparsed); err != nil {
+		t.Fatalf("failed to parse the output YAML: %v\n%s", err, output)
+	}
+	expected := map[string]interface{}{
+		"database": map[string]interface{}{"host": "localhost"},
+		"tags":     []interface{}{"primary", "eu"},
+	}
+	if !reflect.DeepEqual(reparsed, expected) {
+		t.Errorf("unexpected content: %v", reparsed)
+	}
+	expectedYAML := "# the head\n\n{database: {host: localhost}, tags: [primary, eu]}\n\n# the end\n"
+	if string(output) != expectedYAML {
+		t.Errorf("expected only the comments of the document to be kept:\nGot:\n%s\nExpected:\n%s", output, expectedYAML)
+	}
+}
+
+func Test_lineEnding(t *testing.T) {
+	input := []byte("database:\r\n  host: localhost # the host\r\n  script: |\r\n    a\r\n    b\r\n---\r\ndatabase:\r\n  host: remote\r\n")
+	lf := "database:\n  host: localhost # the host\n  script: |\n    a\n    b\n---\ndatabase:\n  host: remote\n"
+
+	tests := []struct {
+		lineEnding string
+		expected   string
+	}{
+		{lineEnding: "", expected: lf},
+		{lineEnding: LineEndingLF, expected: lf},
+		{lineEnding: LineEndingCRLF, expected: strings.ReplaceAll(lf, "\n", "\r\n")},
+	}
+	for _, tt := range tests {
+		config := &Configuration{Include: []IncludeItem{{Key: "database"}}, LineEnding: tt.lineEnding}
+		output, err := config.Trim(input)
+		if err != nil {
+			t.Fatalf("failed to trim with line ending %q: %v", tt.lineEnding, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("unexpected output with line ending %q: %q, expected %q", tt.lineEnding, output, tt.expected)
+		}
+
+		var streamed strings.Builder
+		if err := config.TrimStream(bytes.NewReader(input), &streamed); err != nil {
+			t.Fatalf("failed to stream with line ending %q: %v", tt.lineEnding, err)
+		}
+		if streamed.String() != tt.expected {
+			t.Errorf("unexpected streamed output with line ending %q: %q, expected %q", tt.lineEnding, streamed.String(), tt.expected)
+		}
+	}
+
+	config := &Configuration{LineEnding: "cr"}
+	if _, err := config.Trim(input); err == nil || err.Error() != `lineEnding: unsupported line ending "cr", expected "lf" or "crlf"` {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_documentMarkers(t *testing.T) {
+	input := []byte("%TAG !e! tag:example.com,2000:\n---\ndatabase:\n  host: localhost\n  port: 5432\n...\n# second\n---\ndatabase:\n  host: remote\n")
+
+	tests := []struct {
+		name     string
+		config   Configuration
+		expected string
+	}{
+		{
+			name:     "separators only",
+			config:   Configuration{},
+			expected: "database:\n  host: localhost\n---\n# second\ndatabase:\n  host: remote\n",
+		},
+		{
+			name:     "explicit start",
+			config:   Configuration{ExplicitStart: true},
+			expected: "---\ndatabase:\n  host: localhost\n---\n# second\ndatabase:\n  host: remote\n",
+		},
+		{
+			name:     "explicit start and end",
+			config:   Configuration{ExplicitStart: true, ExplicitEnd: true},
+			expected: "---\ndatabase:\n  host: localhost\n...\n---\n# second\ndatabase:\n  host: remote\n...\n",
+		},
+		{
+			name:     "directives",
+			config:   Configuration{PreserveDirectives: true},
+			expected: "%TAG !e! tag:example.com,2000:\n---\ndatabase:\n  host: localhost\n---\n# second\ndatabase:\n  host: remote\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Include = []IncludeItem{{Key: "database.host"}}
+			output, err := tt.config.Trim(input)
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+			if string(output) != tt.expected {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", string(output), tt.expected)
+			}
+		})
+	}
+}
+
+func Test_scanDirectives(t *testing.T) {
+	input := "# comment\n%YAML 1.1\n%TAG ! tag:example.com,2000:\n--- foo\n---\na: 1\n...\n%TAG !e! tag:example.com,2001:\n---\nb: 2\n"
+	directives := scanDirectives([]byte(input))
+	documents, err := decodeDocuments([]byte(input), FormatYAML)
+	if err != nil {
+		t.Fatalf("failed to decode input YAML: %v", err)
+	}
+	if len(directives) != len(documents) {
+		t.Fatalf("expected the directives of %d documents, got %d: %q", len(documents), len(directives), directives)
+	}
+	expected := [][]string{{"%YAML 1.1", "%TAG ! tag:example.com,2000:"}, nil, {"%TAG !e! tag:example.com,2001:"}}
+	for i := range expected {
+		if strings.Join(directives[i], "\n") != strings.Join(expected[i], "\n") {
+			t.Errorf("unexpected directives of document %d: %q, expected %q", i, directives[i], expected[i])
+		}
+	}
+}
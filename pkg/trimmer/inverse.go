@@ -0,0 +1,61 @@
+package trimmer
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+// position identifies a node of a document by its line and column in the input
+type position struct {
+	line, column int
+}
+
+// complement returns the parts of the input node that are not in its trimmed output node.
+// The output nodes are either the input nodes themselves or built from them with their positions,
+// so the output node of an input value is found by its position.
+// A value kept whole is left out of the complement, a filtered collection is replaced by the complement of its output.
+func complement(inputNode, outputNode *yaml.Node) *yaml.Node {
+	result := &yaml.Node{}
+	copyProperties(inputNode, result)
+
+	kept := map[position]*yaml.Node{}
+	switch inputNode.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(outputNode.Content); i += 2 {
+			value := outputNode.Content[i+1]
+			kept[position{value.Line, value.Column}] = value
+		}
+		for i := 0; i+1 < len(inputNode.Content); i += 2 {
+			if value := complementValue(inputNode.Content[i+1], kept); value != nil {
+				result.Content = append(result.Content, inputNode.Content[i], value)
+			}
+		}
+	case yaml.SequenceNode:
+		for _, element := range outputNode.Content {
+			kept[position{element.Line, element.Column}] = element
+		}
+		for _, element := range inputNode.Content {
+			if value := complementValue(element, kept); value != nil {
+				result.Content = append(result.Content, value)
+			}
+		}
+	}
+	return result
+}
+
+// complementValue returns the complement of an input value given the output values of its parent by position,
+// the value itself if it was dropped and nil if nothing of it is left
+func complementValue(inputValue *yaml.Node, kept map[position]*yaml.Node) *yaml.Node {
+	outputValue, ok := kept[position{inputValue.Line, inputValue.Column}]
+	if !ok {
+		return inputValue
+	}
+	// The values kept whole, and the scalars changed by a transform, have nothing left
+	if outputValue == inputValue || !isCollection(inputValue) || outputValue.Kind != inputValue.Kind {
+		return nil
+	}
+	rest := complement(inputValue, outputValue)
+	if len(rest.Content) == 0 {
+		return nil
+	}
+	return rest
+}
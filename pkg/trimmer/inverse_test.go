@@ -0,0 +1,113 @@
+package trimmer
+
+import (
+	"testing"
+)
+
+func Test_inverse(t *testing.T) {
+	input := unindent(`
+    # the database
+    database:
+      host: localhost
+      port: 5432
+      credentials:
+        user: admin
+        password: secret
+    cache:
+      enabled: true
+    servers:
+      - name: a
+        port: 1
+      - name: b
+        port: 2
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		expectedYAML string
+	}{
+		{
+			name: "simple include",
+			rules: `
+            include:
+              - key: database
+            `,
+			expectedYAML: `
+            cache:
+              enabled: true
+            servers:
+              - name: a
+                port: 1
+              - name: b
+                port: 2
+            `,
+		},
+		{
+			name: "nested include",
+			rules: `
+            include:
+              - key: database.host
+              - key: database.credentials.user
+              - key: cache
+            `,
+			expectedYAML: `
+            # the database
+            database:
+              port: 5432
+              credentials:
+                password: secret
+            servers:
+              - name: a
+                port: 1
+              - name: b
+                port: 2
+            `,
+		},
+		{
+			name: "sequence elements",
+			rules: `
+            include:
+              - key: servers.name
+              - key: database
+              - key: cache
+            `,
+			expectedYAML: `
+            servers:
+              - port: 1
+              - port: 2
+            `,
+		},
+		{
+			name: "everything kept",
+			rules: `
+            include:
+              - key: "*"
+            `,
+			expectedYAML: `
+            {}
+            `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+			config.Inverse = true
+
+			output, err := config.Trim([]byte(input))
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
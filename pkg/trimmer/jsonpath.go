@@ -0,0 +1,166 @@
+package trimmer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pathIndex matches a sequence index at the start of a JSONPath expression, like [0] or [-1]
+var pathIndex = regexp.MustCompile(`^\[-?[0-9]+\]`)
+
+// pathSegment is a key selected by a JSONPath expression
+type pathSegment struct {
+	key       string
+	wildcard  bool
+	recursive bool
+	index     *int
+}
+
+// pathRules converts the JSONPath expressions of the configuration into the equivalent include rules
+func (config *Configuration) pathRules() ([]IncludeItem, error) {
+	var rules []IncludeItem
+	for i, expression := range config.Paths {
+		rule, err := parseJSONPath(expression)
+		if err != nil {
+			return nil, fmt.Errorf("paths[%d]: invalid JSONPath %q: %w", i, expression, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// parseJSONPath converts a JSONPath expression, like "$.database.hosts[0].name", into the equivalent include rule.
+// The supported subset is the keys in the dot and the bracket notations, the "*" wildcard,
+// the sequence indices like [0] or [*], and the recursive descent with "..".
+// The selected values are kept with the paths leading to them.
+func parseJSONPath(expression string) (IncludeItem, error) {
+	if !strings.HasPrefix(expression, "$") {
+		return IncludeItem{}, fmt.Errorf("must start with $")
+	}
+
+	var segments []pathSegment
+	rest := expression[1:]
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, ".."), strings.HasPrefix(rest, "."):
+			recursive := strings.HasPrefix(rest, "..")
+			if recursive {
+				rest = rest[2:]
+			} else {
+				rest = rest[1:]
+			}
+			// A bracket can follow the recursive descent, like in "$..['name']"
+			if recursive && strings.HasPrefix(rest, "[") {
+				key, remaining, err := parseBracket(rest)
+				if err != nil {
+					return IncludeItem{}, err
+				}
+				if key == nil {
+					return IncludeItem{}, fmt.Errorf("a key is expected after ..")
+				}
+				segments = append(segments, pathSegment{key: *key, recursive: true})
+				rest = remaining
+				continue
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return IncludeItem{}, fmt.Errorf("empty key at %q", rest)
+			}
+			segments = append(segments, pathSegment{key: rest[:end], wildcard: rest[:end] == "*", recursive: recursive})
+			rest = rest[end:]
+		case strings.HasPrefix(rest, "["):
+			if strings.HasPrefix(rest, "[*]") || pathIndex.MatchString(rest) {
+				end := strings.Index(rest, "]")
+				if len(segments) == 0 {
+					return IncludeItem{}, fmt.Errorf("the root can't be indexed, only the values of keys")
+				}
+				// All the elements are kept by default, so [*] changes nothing
+				if rest[1:end] != "*" {
+					last := &segments[len(segments)-1]
+					if last.index != nil {
+						return IncludeItem{}, fmt.Errorf("only one index per key is supported")
+					}
+					index, err := strconv.Atoi(rest[1:end])
+					if err != nil {
+						return IncludeItem{}, fmt.Errorf("invalid index %q: %w", rest[1:end], err)
+					}
+					last.index = &index
+				}
+				rest = rest[end+1:]
+				continue
+			}
+			key, remaining, err := parseBracket(rest)
+			if err != nil {
+				return IncludeItem{}, err
+			}
+			if key == nil {
+				return IncludeItem{}, fmt.Errorf("unsupported expression at %q", rest)
+			}
+			segments = append(segments, pathSegment{key: *key})
+			rest = remaining
+		default:
+			return IncludeItem{}, fmt.Errorf("unexpected %q", rest)
+		}
+	}
+	if len(segments) == 0 {
+		return IncludeItem{}, fmt.Errorf("at least one key is required")
+	}
+
+	// Build the rule from the innermost key outwards, like the dotted keys
+	var rule IncludeItem
+	for i := len(segments) - 1; i >= 0; i-- {
+		segment := segments[i]
+		if segment.recursive && segment.index != nil {
+			return IncludeItem{}, fmt.Errorf("recursive descent can't have an index")
+		}
+
+		item := IncludeItem{Recursive: segment.recursive, Index: segment.index}
+		switch {
+		case segment.wildcard:
+			item.Key = "*"
+		case isPattern(segment.key):
+			// The glob characters of the literal keys are matched literally
+			item.KeyRegex = "^" + regexp.QuoteMeta(segment.key) + "$"
+		default:
+			item.Key = strings.NewReplacer(`\`, `\\`, ".", `\.`).Replace(segment.key)
+		}
+		if i < len(segments)-1 {
+			item.Include = []IncludeItem{rule}
+		}
+		rule = item
+	}
+	return rule, nil
+}
+
+// parseBracket parses a quoted key in brackets at the start of the expression, like ['name'] or ["name"].
+// It returns nil if the brackets don't have a quoted key, and the rest of the expression after the brackets.
+func parseBracket(expression string) (*string, string, error) {
+	if len(expression) < 2 || (expression[1] != '\'' && expression[1] != '"') {
+		return nil, expression, nil
+	}
+	quote := expression[1]
+	var key strings.Builder
+	for i := 2; i < len(expression); i++ {
+		switch expression[i] {
+		case '\\':
+			if i+1 < len(expression) {
+				i++
+				key.WriteByte(expression[i])
+			}
+		case quote:
+			if i+1 >= len(expression) || expression[i+1] != ']' {
+				return nil, "", fmt.Errorf("missing ] after the quoted key %q", key.String())
+			}
+			result := key.String()
+			return &result, expression[i+2:], nil
+		default:
+			key.WriteByte(expression[i])
+		}
+	}
+	return nil, "", fmt.Errorf("unterminated quoted key in %q", expression)
+}
@@ -0,0 +1,211 @@
+package trimmer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_paths(t *testing.T) {
+	tests := []struct {
+		name         string
+		paths        string
+		inputYAML    string
+		expectedYAML string
+	}{
+		{
+			name: "nested filtering",
+			inputYAML: `
+            cache:
+              enabled: true
+            database:
+              host: localhost
+              port: 5432
+              credentials:
+                username: user
+                password: pass
+            `,
+			paths: `
+            paths:
+              - $.database.host
+              - $.database.credentials.username
+            `,
+			expectedYAML: `
+            database:
+              host: localhost
+              credentials:
+                username: user
+            `,
+		},
+		{
+			name: "bracket notation",
+			inputYAML: `
+            hosts:
+              example.com: 10.0.0.1
+              "*.example.com": 10.0.0.2
+              other.com: 10.0.0.3
+            `,
+			paths: `
+            paths:
+              - $.hosts['example.com']
+              - $["hosts"]["*.example.com"]
+            `,
+			expectedYAML: `
+            hosts:
+              example.com: 10.0.0.1
+              "*.example.com": 10.0.0.2
+            `,
+		},
+		{
+			name: "indices and wildcards",
+			inputYAML: `
+            servers:
+              - name: a
+                port: 80
+              - name: b
+                port: 8080
+            regions:
+              eu:
+                name: Europe
+                zones: 3
+              us:
+                name: America
+                zones: 5
+            `,
+			paths: `
+            paths:
+              - $.servers[*].name
+              - $.servers[-1].port
+              - $.regions.*.name
+            `,
+			expectedYAML: `
+            servers:
+              - name: a
+              - name: b
+            regions:
+              eu:
+                name: Europe
+              us:
+                name: America
+            `,
+		},
+		{
+			name: "recursive descent",
+			inputYAML: `
+            app:
+              database:
+                password: secret
+                host: localhost
+            cache:
+              password: other
+            `,
+			paths: `
+            paths:
+              - $..password
+            `,
+			expectedYAML: `
+            app:
+              database:
+                password: secret
+            cache:
+              password: other
+            `,
+		},
+		{
+			name: "with include rules",
+			inputYAML: `
+            name: app
+            database:
+              host: localhost
+              port: 5432
+            `,
+			paths: `
+            include:
+              - key: name
+            paths:
+              - $.database.port
+            `,
+			expectedYAML: `
+            name: app
+            database:
+              port: 5432
+            `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.paths))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+
+			output, err := config.Trim([]byte(unindent(tt.inputYAML)))
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
+
+func Test_parseJSONPath(t *testing.T) {
+	index := 0
+	tests := []struct {
+		expression   string
+		expected     IncludeItem
+		errorMessage string
+	}{
+		{
+			expression: "$.database.host",
+			expected:   IncludeItem{Key: "database", Include: []IncludeItem{{Key: "host"}}},
+		},
+		{
+			expression: "$.servers[0]['name']",
+			expected:   IncludeItem{Key: "servers", Index: &index, Include: []IncludeItem{{Key: "name"}}},
+		},
+		{
+			expression: "$..database.host",
+			expected:   IncludeItem{Key: "database", Recursive: true, Include: []IncludeItem{{Key: "host"}}},
+		},
+		{
+			expression: `$['a.b\'s']`,
+			expected:   IncludeItem{Key: `a\.b's`},
+		},
+		{expression: "database.host", errorMessage: "must start with $"},
+		{expression: "$", errorMessage: "at least one key is required"},
+		{expression: "$.servers[0][1]", errorMessage: "only one index per key is supported"},
+		{expression: "$..servers[0]", errorMessage: "recursive descent can't have an index"},
+		{expression: "$.servers[?(@.port > 80)]", errorMessage: "unsupported expression"},
+		{expression: "$.a..", errorMessage: "empty key"},
+		{expression: "$['a", errorMessage: "unterminated quoted key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			got, err := parseJSONPath(tt.expression)
+			if tt.errorMessage != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMessage) {
+					t.Errorf("expected error containing %q, got: %v", tt.errorMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to parse JSONPath: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("unexpected rule:\nGot:\n%+v\nExpected:\n%+v", got, tt.expected)
+			}
+		})
+	}
+
+	config := Configuration{Paths: []string{"$.a", "a.b"}}
+	if _, err := config.Trim([]byte("a: 1")); err == nil || !strings.Contains(err.Error(), `paths[1]: invalid JSONPath "a.b": must start with $`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
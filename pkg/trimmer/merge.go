@@ -0,0 +1,80 @@
+package trimmer
+
+import "gopkg.in/yaml.v3"
+
+// mergeTag is the tag yaml.v3 gives to the "<<" merge keys
+const mergeTag = "!!merge"
+
+// resolveMergeKeys replaces the "<<" merge keys of the mappings under the node with the keys they merge,
+// so that the rules see the effective keys of the mappings.
+// The keys of the mapping take precedence over the merged ones, and the earlier merged mappings over the later ones.
+// The anchors are defined before their aliases, so the merged mappings are already resolved when they are merged.
+func resolveMergeKeys(node *yaml.Node) {
+	if node.Kind == yaml.AliasNode {
+		return
+	}
+	for _, child := range node.Content {
+		resolveMergeKeys(child)
+	}
+	if node.Kind != yaml.MappingNode || !hasMergeKey(node) {
+		return
+	}
+
+	// The keys of the mapping itself, which the merged keys can't override
+	explicit := map[string]bool{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Tag != mergeTag {
+			explicit[node.Content[i].Value] = true
+		}
+	}
+
+	// The merged keys take the place of the merge key
+	var content []*yaml.Node
+	merged := map[string]bool{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+		if keyNode.Tag != mergeTag {
+			content = append(content, keyNode, valueNode)
+			continue
+		}
+		for _, source := range mergeSources(valueNode) {
+			for j := 0; j+1 < len(source.Content); j += 2 {
+				key := source.Content[j].Value
+				if explicit[key] || merged[key] {
+					continue
+				}
+				merged[key] = true
+				content = append(content, source.Content[j], source.Content[j+1])
+			}
+		}
+	}
+	node.Content = content
+}
+
+// hasMergeKey checks if a mapping has a "<<" merge key
+func hasMergeKey(node *yaml.Node) bool {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Tag == mergeTag {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeSources returns the mappings merged by the value of a merge key: a mapping, an alias of one, or a sequence of them
+func mergeSources(node *yaml.Node) []*yaml.Node {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return mergeSources(node.Alias)
+	case yaml.MappingNode:
+		return []*yaml.Node{node}
+	case yaml.SequenceNode:
+		var sources []*yaml.Node
+		for _, element := range node.Content {
+			sources = append(sources, mergeSources(element)...)
+		}
+		return sources
+	default:
+		return nil
+	}
+}
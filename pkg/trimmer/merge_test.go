@@ -0,0 +1,87 @@
+package trimmer
+
+import "testing"
+
+func Test_resolveMergeKeys(t *testing.T) {
+	input := unindent(`
+    base: &base
+      host: localhost
+      port: 5432
+    ssl: &ssl
+      port: 5433
+      sslmode: require
+    production:
+      <<: *base
+      host: db.example.com
+    secure:
+      <<: [*ssl, *base]
+      user: admin
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		expectedYAML string
+	}{
+		{
+			name: "key only in the merged mapping",
+			rules: `
+            include:
+              - key: production.port
+            `,
+			expectedYAML: `
+            production:
+              port: 5432
+            `,
+		},
+		{
+			name: "keys of the mapping take precedence",
+			rules: `
+            include:
+              - key: production
+            `,
+			expectedYAML: `
+            production:
+              port: 5432
+              host: db.example.com
+            `,
+		},
+		{
+			name: "earlier merged mappings take precedence",
+			rules: `
+            include:
+              - key: secure
+                include:
+                  - key: port
+                  - key: host
+                  - key: user
+            `,
+			expectedYAML: `
+            secure:
+              port: 5433
+              host: localhost
+              user: admin
+            `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+
+			output, err := config.Trim([]byte(input))
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package trimmer
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ListPaths returns the paths of all the leaf values in the input, in the order they appear.
+// The paths use the dotted notation of the include rules, with "[i]" for the elements of sequences.
+// The paths that appear in multiple documents are listed once.
+func (config *Configuration) ListPaths(input []byte) ([]string, error) {
+	documents, err := decodeDocuments(input, config.inputFormat(input))
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	seen := map[string]bool{}
+	for _, document := range documents {
+		if isEmptyDocument(document) {
+			continue
+		}
+		collectPaths("", document.Content[0], func(path string) {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		})
+	}
+	return paths, nil
+}
+
+// collectPaths calls add with the path of every leaf value under the node.
+// Scalars, aliases and empty collections are the leaves.
+func collectPaths(path string, node *yaml.Node, add func(string)) {
+	switch {
+	case node.Kind == yaml.MappingNode && len(node.Content) > 0:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			collectPaths(joinPath(path, node.Content[i].Value), node.Content[i+1], add)
+		}
+	case node.Kind == yaml.SequenceNode && len(node.Content) > 0:
+		for i, element := range node.Content {
+			collectPaths(fmt.Sprintf("%s[%d]", path, i), element, add)
+		}
+	case path != "":
+		add(path)
+	}
+}
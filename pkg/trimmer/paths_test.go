@@ -0,0 +1,46 @@
+package trimmer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_ListPaths(t *testing.T) {
+	input := `
+    database:
+      credentials:
+        username: admin
+        password: secret
+      hosts:
+        - name: primary
+          port: 5432
+        - replica
+      options: {}
+    example.com: true
+    ---
+    database:
+      credentials:
+        username: other
+    version: 2
+    `
+
+	config := &Configuration{}
+	paths, err := config.ListPaths([]byte(unindent(input)))
+	if err != nil {
+		t.Fatalf("failed to list paths: %v", err)
+	}
+
+	expected := []string{
+		"database.credentials.username",
+		"database.credentials.password",
+		"database.hosts[0].name",
+		"database.hosts[0].port",
+		"database.hosts[1]",
+		"database.options",
+		"example\\.com",
+		"version",
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("unexpected paths:\nGot:\n%v\nExpected:\n%v", paths, expected)
+	}
+}
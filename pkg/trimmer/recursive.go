@@ -0,0 +1,128 @@
+package trimmer
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// checkRecursiveRules checks the recursive rules and their nested rules don't use the options that only make sense on a single level
+func checkRecursiveRules(rules []IncludeItem) error {
+	for _, rule := range rules {
+		if rule.Recursive && (rule.Index != nil || rule.Where != nil || rule.As != "") {
+			return fmt.Errorf("recursive rule %q can't have index, where or as", rule.name())
+		}
+		if err := checkRecursiveRules(rule.nestedRules()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// descend finds the keys matching a recursive rule at any depth under the node.
+// It returns a copy of the node with only the paths leading to the matching keys, or nil if nothing matches.
+// The values of the matching keys are kept whole, or filtered with the nested rules of the rule, and not descended into.
+// Only the elements of sequences with a match are kept.
+func (f *filter) descend(rule IncludeItem, path string, node *yaml.Node) (*yaml.Node, error) {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return f.descend(rule, path, node.Alias)
+	case yaml.MappingNode:
+		outputNode := &yaml.Node{}
+		copyProperties(node, outputNode)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode, valueNode := node.Content[i], node.Content[i+1]
+			childPath := joinPath(path, keyNode.Value)
+
+			if f.matchRule(rule, keyNode.Value) && rule.matchesValueKind(valueNode) {
+				if inRange, err := f.inBounds(rule, childPath, valueNode); err != nil {
+					return nil, err
+				} else if !inRange {
+					continue
+				}
+				if len(rule.Include) > 0 || (len(rule.Exclude) > 0 && isCollection(valueNode)) {
+					filtered, err := f.filterValue(rule.Include, rule.Exclude, childPath, valueNode)
+					if err != nil {
+						return nil, err
+					}
+					valueNode = filtered
+				}
+				transformed, err := f.transformValue(rule, childPath, valueNode)
+				if err != nil {
+					return nil, err
+				}
+				transformed, err = f.coerceValue(rule, childPath, transformed)
+				if err != nil {
+					return nil, err
+				}
+				outputNode.Content = append(outputNode.Content, keyNode, transformed)
+				continue
+			}
+
+			descended, err := f.descend(rule, childPath, valueNode)
+			if err != nil {
+				return nil, err
+			}
+			if descended != nil {
+				outputNode.Content = append(outputNode.Content, keyNode, descended)
+			}
+		}
+		if len(outputNode.Content) == 0 {
+			return nil, nil
+		}
+		return outputNode, nil
+	case yaml.SequenceNode:
+		outputNode := &yaml.Node{}
+		copyProperties(node, outputNode)
+		for i, element := range node.Content {
+			descended, err := f.descend(rule, fmt.Sprintf("%s[%d]", path, i), element)
+			if err != nil {
+				return nil, err
+			}
+			if descended != nil {
+				outputNode.Content = append(outputNode.Content, descended)
+			}
+		}
+		if len(outputNode.Content) == 0 {
+			return nil, nil
+		}
+		return outputNode, nil
+	default:
+		return nil, nil
+	}
+}
+
+// mergePair adds a key/value pair to the output mapping, or merges it into the pair with the same key if there is one.
+// It returns true if the pair is added. The renamed keys are left to the rename collision checks, nothing is merged into them.
+// The mappings are merged recursively, for other values the one already in the output is kept.
+// The merged mappings are copies, so that the input nodes kept as they are in the output are never changed.
+func mergePair(outputNode, keyNode, valueNode *yaml.Node, renamed map[*yaml.Node]bool) bool {
+	for i := 0; i+1 < len(outputNode.Content); i += 2 {
+		if outputNode.Content[i].Value != keyNode.Value || renamed[outputNode.Content[i]] {
+			continue
+		}
+		existing := outputNode.Content[i+1]
+		if existing.Kind == yaml.MappingNode && valueNode.Kind == yaml.MappingNode && existing != valueNode {
+			merged := &yaml.Node{}
+			copyProperties(existing, merged)
+			merged.Content = append([]*yaml.Node{}, existing.Content...)
+			for j := 0; j+1 < len(valueNode.Content); j += 2 {
+				mergePair(merged, valueNode.Content[j], valueNode.Content[j+1], nil)
+			}
+			outputNode.Content[i+1] = merged
+		}
+		return false
+	}
+	outputNode.Content = append(outputNode.Content, keyNode, valueNode)
+	return true
+}
+
+// keyIndex returns the position of a key node in the content of a mapping
+func keyIndex(node, keyNode *yaml.Node) int {
+	for i := 0; i < len(node.Content); i += 2 {
+		if node.Content[i] == keyNode {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,123 @@
+package trimmer
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_recursive(t *testing.T) {
+	input := unindent(`
+    image: base:1.0
+    spec:
+      replicas: 2
+      template:
+        containers:
+          - name: app
+            image: app:1.0
+          - name: sidecar
+            image: sidecar:2.0
+            ports:
+              - 8080
+        volumes:
+          - name: data
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		expectedYAML string
+		errorMessage string
+	}{
+		{
+			name: "key at different depths",
+			rules: `
+            include:
+              - key: image
+                recursive: true
+            `,
+			expectedYAML: `
+            image: base:1.0
+            spec:
+              template:
+                containers:
+                  - image: app:1.0
+                  - image: sidecar:2.0
+            `,
+		},
+		{
+			name: "overlapping paths are merged",
+			rules: `
+            include:
+              - key: spec.replicas
+              - key: spec.template.containers
+                index: 0
+              - key: name
+                recursive: true
+            `,
+			// The mappings are merged, the sequence of the earlier rule is kept
+			expectedYAML: `
+            spec:
+              replicas: 2
+              template:
+                containers:
+                  - name: app
+                    image: app:1.0
+                volumes:
+                  - name: data
+            `,
+		},
+		{
+			name: "under a nested rule",
+			rules: `
+            include:
+              - key: spec
+                include:
+                  - key: port*
+                    recursive: true
+            `,
+			expectedYAML: `
+            spec:
+              template:
+                containers:
+                  - ports:
+                      - 8080
+            `,
+		},
+		{
+			name: "with index",
+			rules: `
+            include:
+              - key: image
+                recursive: true
+                index: 0
+            `,
+			errorMessage: `recursive rule "image" can't have index, where or as`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+
+			output, err := config.Trim([]byte(input))
+			if tt.errorMessage != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMessage) {
+					t.Errorf("expected error containing %q, got: %v", tt.errorMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package trimmer
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// TrimStream is like TrimReader, but reads, trims and writes the documents of the input one at a time.
+// Only the document being trimmed is kept in memory, instead of the whole input and all of its documents,
+// which makes a big difference for the inputs with many documents.
+// A single document is still parsed whole before trimming, as the YAML parser has no way to skip the values.
+//
+// The input format is not detected, it is YAML unless the JSON input format is configured.
+// The documents already written stay in the writer when trimming a later document fails.
+// PreserveDirectives is not supported, as the whole input is needed to find the directives.
+func (config *Configuration) TrimStream(reader io.Reader, writer io.Writer) error {
+	return config.TrimStreamContext(context.Background(), reader, writer)
+}
+
+// TrimStreamContext is like TrimStream, but stops with the error of the context when it is canceled.
+func (config *Configuration) TrimStreamContext(ctx context.Context, reader io.Reader, writer io.Writer) error {
+	if config.PreserveDirectives {
+		return fmt.Errorf("preserveDirectives is not supported when streaming")
+	}
+	rules, regexps, err := config.prepare()
+	if err != nil {
+		return err
+	}
+	indent, err := config.indent()
+	if err != nil {
+		return err
+	}
+
+	inputFormat := config.InputFormat
+	if inputFormat == "" {
+		inputFormat = FormatYAML
+	}
+	outputFormat := config.OutputFormat
+	if outputFormat == "" {
+		outputFormat = inputFormat
+	}
+	if outputFormat != FormatYAML && outputFormat != FormatJSON {
+		return fmt.Errorf("unsupported output format: %q", outputFormat)
+	}
+	input := &textReader{reader: reader}
+	next, err := newDocumentDecoder(input, inputFormat)
+	if err != nil {
+		return err
+	}
+
+	written := 0
+	inputEmpty, resultEmpty := true, true
+	for i := 0; ; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		root, err := next()
+		if err == io.EOF {
+			if inputEmpty {
+				return noContentError(input.text, i)
+			}
+			break
+		} else if err != nil {
+			// The YAML parser fails on the tabs of the whitespace only input
+			if !input.text {
+				return errEmptyInput
+			}
+			return err
+		}
+
+		if isEmptyDocument(root) {
+			logrus.Debugf("Skipping empty input YAML document %d", i)
+			continue
+		}
+		inputEmpty = false
+
+		outputDocument, empty, err := config.trimDocument(i, root, rules, regexps)
+		if err != nil {
+			return err
+		}
+		if !empty {
+			resultEmpty = false
+		}
+		if outputDocument == nil {
+			continue
+		}
+
+		var content []byte
+		if outputFormat == FormatJSON {
+			content, err = encodeJSON([]*yaml.Node{outputDocument}, indent)
+		} else {
+			// The documents after the first one are separated with "---", like in the output of Trim
+			content, err = encodeYAML([]trimmedDocument{{output: outputDocument}}, indent, config.ExplicitStart || written > 0, config.ExplicitEnd)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(normalizeLineEndings(content, config.LineEnding)); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		written++
+	}
+
+	if config.FailOnEmptyResult && resultEmpty {
+		return errEmptyResult
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package trimmer
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func Test_TrimStream(t *testing.T) {
+	input := "name: first\nspec:\n  replicas: 1\n  image: nginx\n---\n---\nname: second\nspec:\n  replicas: 2\n---\nother: true\n"
+
+	tests := []struct {
+		name   string
+		config Configuration
+	}{
+		{
+			name:   "multiple documents",
+			config: Configuration{Include: []IncludeItem{{Key: "name"}, {Key: "spec.replicas"}}},
+		},
+		{
+			name:   "dropped empty documents",
+			config: Configuration{Include: []IncludeItem{{Key: "name"}}, EmptyDocuments: EmptyDrop},
+		},
+		{
+			name:   "explicit markers",
+			config: Configuration{Include: []IncludeItem{{Key: "spec"}}, ExplicitStart: true, ExplicitEnd: true},
+		},
+		{
+			name:   "JSON output",
+			config: Configuration{Include: []IncludeItem{{Key: "name"}}, OutputFormat: FormatJSON},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected, err := tt.config.Trim([]byte(input))
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			var output bytes.Buffer
+			if err := tt.config.TrimStream(strings.NewReader(input), &output); err != nil {
+				t.Fatalf("failed to trim input YAML stream: %v", err)
+			}
+			if output.String() != string(expected) {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", output.String(), string(expected))
+			}
+		})
+	}
+}
+
+func Test_TrimStream_errors(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       Configuration
+		input        string
+		errorMessage string
+	}{
+		{
+			name:         "empty input",
+			config:       Configuration{Include: []IncludeItem{{Key: "name"}}},
+			errorMessage: "no content in the input YAML",
+		},
+		{
+			name:         "invalid document",
+			config:       Configuration{Include: []IncludeItem{{Key: "name"}}},
+			input:        "name: first\n---\nname: [\n",
+			errorMessage: "failed to unmarshal input YAML",
+		},
+		{
+			name:         "empty result",
+			config:       Configuration{Include: []IncludeItem{{Key: "missing"}}, FailOnEmptyResult: true},
+			input:        "name: first\n",
+			errorMessage: "the trimmed result is empty",
+		},
+		{
+			name:         "directives",
+			config:       Configuration{Include: []IncludeItem{{Key: "name"}}, PreserveDirectives: true},
+			input:        "name: first\n",
+			errorMessage: "preserveDirectives is not supported when streaming",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			err := tt.config.TrimStream(strings.NewReader(tt.input), &output)
+			if err == nil || !strings.Contains(err.Error(), tt.errorMessage) {
+				t.Errorf("expected error containing %q, got: %v", tt.errorMessage, err)
+			}
+		})
+	}
+}
+
+// benchmarkInput returns a YAML input with many big documents, of which only the names are kept
+func benchmarkInput() []byte {
+	var input strings.Builder
+	for i := 0; i < 200; i++ {
+		if i > 0 {
+			input.WriteString("---\n")
+		}
+		fmt.Fprintf(&input, "name: document-%d\nspec:\n", i)
+		for j := 0; j < 500; j++ {
+			fmt.Fprintf(&input, "  key-%d:\n    value: %d\n    enabled: true\n", j, j)
+		}
+	}
+	return []byte(input.String())
+}
+
+// heapSampler is a writer recording the highest heap size seen on its writes, as an estimate of the peak memory
+type heapSampler struct {
+	peak uint64
+}
+
+func (sampler *heapSampler) Write(p []byte) (int, error) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	if stats.HeapAlloc > sampler.peak {
+		sampler.peak = stats.HeapAlloc
+	}
+	return len(p), nil
+}
+
+func Benchmark_Trim(b *testing.B) {
+	input := benchmarkInput()
+	config := Configuration{Include: []IncludeItem{{Key: "name"}}}
+	sampler := &heapSampler{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		output, err := config.TrimReader(bytes.NewReader(input))
+		if err != nil {
+			b.Fatalf("failed to trim input YAML: %v", err)
+		}
+		sampler.Write(output)
+	}
+	b.ReportMetric(float64(sampler.peak), "peak-heap-B")
+}
+
+func Benchmark_TrimStream(b *testing.B) {
+	input := benchmarkInput()
+	config := Configuration{Include: []IncludeItem{{Key: "name"}}}
+	sampler := &heapSampler{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		if err := config.TrimStream(bytes.NewReader(input), sampler); err != nil {
+			b.Fatalf("failed to trim input YAML stream: %v", err)
+		}
+	}
+	b.ReportMetric(float64(sampler.peak), "peak-heap-B")
+}
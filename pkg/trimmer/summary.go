@@ -0,0 +1,81 @@
+package trimmer
+
+import (
+	"context"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Summary describes how much of the input is kept by the trimming.
+type Summary struct {
+	InputSize  int
+	OutputSize int
+
+	// InputKeys and KeptKeys are the numbers of the keys of all the mappings, at any depth, in the input and the output
+	InputKeys int
+	KeptKeys  int
+}
+
+// DroppedKeys returns the number of the keys of the input that are not in the output.
+// The defaults can add keys to the output, so it is never below zero.
+func (summary Summary) DroppedKeys() int {
+	return max(summary.InputKeys-summary.KeptKeys, 0)
+}
+
+// Reduction returns how much smaller the output is than the input, in percent
+func (summary Summary) Reduction() float64 {
+	if summary.InputSize == 0 {
+		return 0
+	}
+	return 100 * float64(summary.InputSize-summary.OutputSize) / float64(summary.InputSize)
+}
+
+// TrimWithSummary is like Trim, but also returns a summary of how much of the input is kept.
+func (config *Configuration) TrimWithSummary(input []byte) ([]byte, Summary, error) {
+	return config.TrimWithSummaryContext(context.Background(), input)
+}
+
+// TrimWithSummaryContext is like TrimWithSummary, but stops with the error of the context when it is canceled.
+func (config *Configuration) TrimWithSummaryContext(ctx context.Context, input []byte) ([]byte, Summary, error) {
+	documents, outputFormat, err := config.trim(ctx, input)
+	if err != nil {
+		return nil, Summary{}, err
+	}
+
+	summary := Summary{InputSize: len(input)}
+	for _, document := range documents {
+		summary.KeptKeys += countKeys(document.output)
+	}
+
+	// The documents dropped from the output are counted too, so the input is parsed again
+	inputDocuments, err := decodeDocuments(input, config.inputFormat(input))
+	if err != nil {
+		return nil, Summary{}, err
+	}
+	for _, document := range inputDocuments {
+		summary.InputKeys += countKeys(document)
+	}
+
+	output, err := config.encode(documents, outputFormat)
+	if err != nil {
+		return nil, Summary{}, err
+	}
+	summary.OutputSize = len(output)
+	return output, summary, nil
+}
+
+// countKeys returns the number of the keys of all the mappings under the node.
+// The aliases are counted as the nodes they refer to, as they are written like that in the output when their anchors are dropped.
+func countKeys(node *yaml.Node) int {
+	if node.Kind == yaml.AliasNode {
+		return countKeys(node.Alias)
+	}
+	count := 0
+	if node.Kind == yaml.MappingNode {
+		count = len(node.Content) / 2
+	}
+	for _, child := range node.Content {
+		count += countKeys(child)
+	}
+	return count
+}
@@ -0,0 +1,27 @@
+package trimmer
+
+import "testing"
+
+func Test_TrimWithSummary(t *testing.T) {
+	input := []byte("name: app\ndatabase:\n  host: localhost\n  port: 5432\nservers:\n  - host: a\n  - host: b\n---\nname: other\n")
+	config := Configuration{Include: []IncludeItem{{Key: "database.host"}}, DropEmptyDocuments: true}
+
+	output, summary, err := config.TrimWithSummary(input)
+	if err != nil {
+		t.Fatalf("failed to trim input YAML: %v", err)
+	}
+	if string(output) != "database:\n  host: localhost\n" {
+		t.Errorf("unexpected result: %q", string(output))
+	}
+
+	expected := Summary{InputSize: len(input), OutputSize: len(output), InputKeys: 8, KeptKeys: 2}
+	if summary != expected {
+		t.Errorf("unexpected summary: %+v, expected %+v", summary, expected)
+	}
+	if summary.DroppedKeys() != 6 {
+		t.Errorf("unexpected number of dropped keys: %d", summary.DroppedKeys())
+	}
+	if reduction := summary.Reduction(); reduction != 72 {
+		t.Errorf("unexpected reduction: %.2f%%", reduction)
+	}
+}
@@ -0,0 +1,153 @@
+package trimmer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// The transforms of the scalar values, a rule can apply several of them like "trim,lower"
+const (
+	TransformTrim  = "trim"
+	TransformLower = "lower"
+	TransformUpper = "upper"
+)
+
+// The types the scalar values can be coerced to, the tags "!!str", "!!int", "!!float" and "!!bool" can be used too
+const (
+	CoerceString = "str"
+	CoerceInt    = "int"
+	CoerceFloat  = "float"
+	CoerceBool   = "bool"
+)
+
+// transforms returns the transforms of the rule in the order they are applied
+func (rule IncludeItem) transforms() []string {
+	if rule.Transform == "" {
+		return nil
+	}
+	var transforms []string
+	for _, transform := range strings.Split(rule.Transform, ",") {
+		transforms = append(transforms, strings.TrimSpace(transform))
+	}
+	return transforms
+}
+
+// checkTransforms checks the transforms of the rules and their nested rules are supported ones
+func checkTransforms(rules []IncludeItem) error {
+	for _, rule := range rules {
+		for _, transform := range rule.transforms() {
+			switch transform {
+			case TransformTrim, TransformLower, TransformUpper:
+			default:
+				return fmt.Errorf("rule %q: unsupported transform %q, expected %q, %q or %q", rule.name(), transform, TransformTrim, TransformLower, TransformUpper)
+			}
+		}
+		if err := checkTransforms(rule.nestedRules()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transformValue applies the transforms of the rule to a scalar value, returning a transformed copy.
+// Other values are kept as they are, or are an error in strict mode.
+func (f *filter) transformValue(rule IncludeItem, path string, valueNode *yaml.Node) (*yaml.Node, error) {
+	transforms := rule.transforms()
+	if len(transforms) == 0 {
+		return valueNode, nil
+	}
+
+	scalarNode := valueNode
+	if scalarNode.Kind == yaml.AliasNode {
+		scalarNode = scalarNode.Alias
+	}
+	if scalarNode.Kind != yaml.ScalarNode {
+		if f.config.Strict {
+			return nil, fmt.Errorf("transform of %q only applies to scalar values at line %d, column %d", path, valueNode.Line, valueNode.Column)
+		}
+		logrus.Debugf("Not transforming %q, it is not a scalar value", path)
+		return valueNode, nil
+	}
+
+	// The copy is a new value, the aliases of the input value refer to the one without the transforms
+	transformed := *scalarNode
+	transformed.Anchor = ""
+	// The quotes of the input may only be there for the surrounding whitespace, the encoder adds them back if they are still needed
+	transformed.Style &^= yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle
+	for _, transform := range transforms {
+		switch transform {
+		case TransformTrim:
+			transformed.Value = strings.TrimSpace(transformed.Value)
+		case TransformLower:
+			transformed.Value = strings.ToLower(transformed.Value)
+		case TransformUpper:
+			transformed.Value = strings.ToUpper(transformed.Value)
+		}
+	}
+	return &transformed, nil
+}
+
+// coerceTag returns the tag the rule coerces the scalar values to, or an empty string if it doesn't coerce them
+func (rule IncludeItem) coerceTag() string {
+	if rule.Coerce == "" {
+		return ""
+	}
+	return "!!" + strings.TrimPrefix(rule.Coerce, "!!")
+}
+
+// checkCoercions checks the coerced types of the rules and their nested rules are supported ones
+func checkCoercions(rules []IncludeItem) error {
+	for _, rule := range rules {
+		switch rule.coerceTag() {
+		case "", "!!" + CoerceString, "!!" + CoerceInt, "!!" + CoerceFloat, "!!" + CoerceBool:
+		default:
+			return fmt.Errorf("rule %q: unsupported coerce %q, expected %q, %q, %q or %q", rule.name(), rule.Coerce, CoerceString, CoerceInt, CoerceFloat, CoerceBool)
+		}
+		if err := checkCoercions(rule.nestedRules()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// coerceValue returns a copy of a scalar value with the tag the rule coerces it to, like "!!str" to write 12345 as "12345".
+// A value can only be coerced to a number or a boolean if it reads as one, like the quoted "8080".
+// Other values, and the values that don't read as the type, are kept as they are, or are an error in strict mode.
+func (f *filter) coerceValue(rule IncludeItem, path string, valueNode *yaml.Node) (*yaml.Node, error) {
+	tag := rule.coerceTag()
+	if tag == "" {
+		return valueNode, nil
+	}
+
+	scalarNode := valueNode
+	if scalarNode.Kind == yaml.AliasNode {
+		scalarNode = scalarNode.Alias
+	}
+	if scalarNode.Kind != yaml.ScalarNode {
+		if f.config.Strict {
+			return nil, fmt.Errorf("coerce of %q only applies to scalar values at line %d, column %d", path, valueNode.Line, valueNode.Column)
+		}
+		logrus.Debugf("Not coercing %q, it is not a scalar value", path)
+		return valueNode, nil
+	}
+
+	coerced := *scalarNode
+	coerced.Anchor = ""
+	coerced.Tag = tag
+	if tag != "!!"+CoerceString {
+		// The value is read the way a plain value would be, without its quotes
+		resolved := (&yaml.Node{Kind: yaml.ScalarNode, Value: scalarNode.Value}).ShortTag()
+		if resolved != tag && (tag != "!!"+CoerceFloat || resolved != "!!"+CoerceInt) {
+			if f.config.Strict {
+				return nil, fmt.Errorf("value of %q can't be coerced to %s at line %d, column %d", path, tag, valueNode.Line, valueNode.Column)
+			}
+			logrus.Debugf("Not coercing %q, %q is not a %s value", path, scalarNode.Value, tag)
+			return valueNode, nil
+		}
+		coerced.Style &^= yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle
+	}
+	return &coerced, nil
+}
@@ -0,0 +1,95 @@
+package trimmer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// NodeTransformer changes the nodes kept by the rules, like to redact or rewrite values.
+// Transform is called with every node of a trimmed document and the path to it, the keys leading to the node
+// and "[i]" for the elements of sequences. The root of the document has an empty path.
+// The node can be changed in place, its children are visited after the changes.
+// The nodes can be shared with the parsed input, and are only changed after the trimming of their document.
+type NodeTransformer interface {
+	Transform(path []string, node *yaml.Node) error
+}
+
+// applyTransformer calls the transformer with the node and all of its descendants, parents first.
+// The aliases are not followed, their anchored nodes are visited where they are defined.
+func applyTransformer(transformer NodeTransformer, path []string, node *yaml.Node) error {
+	if err := transformer.Transform(path, node); err != nil {
+		return fmt.Errorf("%s: %w", displayPath(path), err)
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if err := applyTransformer(transformer, appendPath(path, node.Content[i].Value), node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, element := range node.Content {
+			if err := applyTransformer(transformer, appendPath(path, "["+strconv.Itoa(i)+"]"), element); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// appendPath returns a copy of the path with the segment added, so that the transformers can keep the paths they get
+func appendPath(path []string, segment string) []string {
+	return append(append(make([]string, 0, len(path)+1), path...), segment)
+}
+
+// displayPath joins the path of a node for the messages, like "containers[0].name"
+func displayPath(path []string) string {
+	if len(path) == 0 {
+		return "root"
+	}
+	var joined strings.Builder
+	for _, segment := range path {
+		if joined.Len() > 0 && !strings.HasPrefix(segment, "[") {
+			joined.WriteByte('.')
+		}
+		joined.WriteString(segment)
+	}
+	return joined.String()
+}
+
+// redacted is the value of the redacted keys
+const redacted = "***"
+
+// redactor is the transformer replacing the scalar values of the keys matching the Redact patterns of the configuration
+type redactor struct {
+	filter *filter
+}
+
+func (r *redactor) Transform(path []string, node *yaml.Node) error {
+	if len(path) == 0 || !r.redacts(path[len(path)-1]) {
+		return nil
+	}
+	// An alias of a scalar is replaced too, as the JSON output writes the aliased value.
+	// The anchor is kept for the other aliases of the value, which are redacted with it.
+	if node.Kind == yaml.ScalarNode || (node.Kind == yaml.AliasNode && node.Alias.Kind == yaml.ScalarNode) {
+		anchor := ""
+		if node.Kind == yaml.ScalarNode {
+			anchor = node.Anchor
+		}
+		*node = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: redacted, Anchor: anchor, Line: node.Line, Column: node.Column, LineComment: node.LineComment}
+	}
+	return nil
+}
+
+// redacts checks if the key matches one of the Redact patterns
+func (r *redactor) redacts(key string) bool {
+	for _, pattern := range r.filter.config.Redact {
+		if r.filter.matchKey(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
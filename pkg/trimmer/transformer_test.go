@@ -0,0 +1,136 @@
+package trimmer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redactPasswords replaces the values of the keys named password, and records the paths it is called with
+type redactPasswords struct {
+	paths []string
+}
+
+func (r *redactPasswords) Transform(path []string, node *yaml.Node) error {
+	r.paths = append(r.paths, displayPath(path))
+	if len(path) > 0 && path[len(path)-1] == "password" && node.Kind == yaml.ScalarNode {
+		node.Value = "redacted"
+	}
+	return nil
+}
+
+// failingTransformer fails on the nodes of a key
+type failingTransformer struct {
+	key string
+}
+
+func (f failingTransformer) Transform(path []string, node *yaml.Node) error {
+	if len(path) > 0 && path[len(path)-1] == f.key {
+		return fmt.Errorf("unexpected key")
+	}
+	return nil
+}
+
+func Test_NodeTransformer(t *testing.T) {
+	input := unindent(`
+    database:
+      user: admin
+      password: secret
+    replicas:
+      - host: a
+        password: first
+    cache:
+      password: dropped
+    `)
+
+	transformer := &redactPasswords{}
+	output, err := Trim([]byte(input), []IncludeItem{{Key: "database"}, {Key: "replicas"}}, transformer)
+	if err != nil {
+		t.Fatalf("failed to trim input YAML: %v", err)
+	}
+
+	expectedYAML := unindent(`
+    database:
+      user: admin
+      password: redacted
+    replicas:
+      - host: a
+        password: redacted
+    `)
+	if gotYAML := unindent(string(output)); gotYAML != expectedYAML {
+		t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+	}
+
+	// Only the kept nodes are visited, parents first
+	expectedPaths := "root, database, database.user, database.password, replicas, replicas[0], replicas[0].host, replicas[0].password"
+	if paths := strings.Join(transformer.paths, ", "); paths != expectedPaths {
+		t.Errorf("unexpected paths: %s, expected %s", paths, expectedPaths)
+	}
+
+	_, err = Trim([]byte(input), []IncludeItem{{Key: "replicas"}}, failingTransformer{key: "host"})
+	expected := "failed to transform trimmed YAML document 0: replicas[0].host: unexpected key"
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_redact(t *testing.T) {
+	input := unindent(`
+    database:
+      user: admin
+      password: secret # the password
+      credentials:
+        Token: abc
+        api_token: &token def
+    services:
+      - name: a
+        token: *token
+      - name: b
+        password:
+          file: /run/secrets/b
+    `)
+
+	config, err := parseRules(unindent(`
+    include:
+      - key: database
+      - key: services
+    redact:
+      - password
+      - "*token"
+    caseInsensitive: true
+    `))
+	if err != nil {
+		t.Fatalf("failed to parse rules: %v", err)
+	}
+
+	output, err := config.Trim([]byte(input))
+	if err != nil {
+		t.Fatalf("failed to trim input YAML: %v", err)
+	}
+
+	// The keys are kept, and only the scalar values are redacted
+	expectedYAML := unindent(`
+    database:
+      user: admin
+      password: '***' # the password
+      credentials:
+        Token: '***'
+        api_token: &token '***'
+    services:
+      - name: a
+        token: '***'
+      - name: b
+        password:
+          file: /run/secrets/b
+    `)
+	if gotYAML := unindent(string(output)); gotYAML != expectedYAML {
+		t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+	}
+
+	config.Redact = []string{"[token"}
+	if _, err := config.Trim([]byte(input)); err == nil || !strings.Contains(err.Error(), `redact[0]: invalid pattern "[token"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
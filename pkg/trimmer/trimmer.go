@@ -0,0 +1,1515 @@
+// Package trimmer trims YAML documents down to the keys selected by a set of rules.
+package trimmer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// The indentation of the output, yaml.v3 ignores the values out of the range
+const (
+	defaultIndent = 2
+	minIndent     = 2
+	maxIndent     = 9
+)
+
+// The supported input and output formats
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+// The policies for the mappings and the sequences that are empty after trimming
+const (
+	EmptyKeep = "keep"
+	EmptyDrop = "drop"
+)
+
+// The line endings of the output
+const (
+	LineEndingLF   = "lf"
+	LineEndingCRLF = "crlf"
+)
+
+// The styles of the mappings and the sequences in the YAML output
+const (
+	StyleBlock = "block"
+	StyleFlow  = "flow"
+)
+
+// The kinds of the values the include rules can be limited to
+const (
+	KindScalar   = "scalar"
+	KindMapping  = "mapping"
+	KindSequence = "sequence"
+)
+
+// IncludeItem is a rule that keeps a key, optionally keeping only some of its nested keys.
+type IncludeItem struct {
+	Key     string        `yaml:"key,omitempty"`
+	Include []IncludeItem `yaml:"include,omitempty"`
+	Exclude []ExcludeItem `yaml:"exclude,omitempty"`
+
+	// KeyRegex matches the keys with a regular expression instead of the literal key
+	KeyRegex string `yaml:"keyRegex,omitempty"`
+
+	// Keys matches any of the listed keys, the same as one rule per key with the rest of the rule
+	Keys []string `yaml:"keys,omitempty"`
+
+	// AnyOf matches only the first of the listed keys that is in the input, like the alternative spellings of a key
+	AnyOf []string `yaml:"anyOf,omitempty"`
+
+	// Index selects a single element of a sequence value, negative indices count from the end
+	Index *int `yaml:"index,omitempty"`
+
+	// Where keeps only the elements of a sequence value that match the condition
+	Where *Condition `yaml:"where,omitempty"`
+
+	// Elements keeps only the listed elements of a sequence value, each trimmed with its own rules
+	Elements []ElementRules `yaml:"elements,omitempty"`
+
+	// As renames the matched key in the output
+	As string `yaml:"as,omitempty"`
+
+	// Overwrite lets the renamed key replace a sibling key with the same name, instead of failing
+	Overwrite bool `yaml:"overwrite,omitempty"`
+
+	// Recursive matches the key at any depth, keeping the paths to the matching keys
+	Recursive bool `yaml:"recursive,omitempty"`
+
+	// ValueKind limits the rule to the keys with a value of the kind, KindScalar, KindMapping or KindSequence
+	ValueKind string `yaml:"valueKind,omitempty"`
+
+	// Transform is a comma separated list of the transforms applied to a scalar value, like "trim,lower"
+	Transform string `yaml:"transform,omitempty"`
+
+	// Coerce sets the tag of a scalar value, CoerceString, CoerceInt, CoerceFloat or CoerceBool, like to keep 12345 a string
+	Coerce string `yaml:"coerce,omitempty"`
+
+	// Min and Max keep the key only when its value is a number in the range, both bounds included
+	Min *float64 `yaml:"min,omitempty"`
+	Max *float64 `yaml:"max,omitempty"`
+
+	// Default is the value the key is emitted with when it is not in the input, only for the literal keys.
+	// It is emitted as it is, the nested rules and the transforms don't apply to it.
+	Default yaml.Node `yaml:"default,omitempty"`
+}
+
+// Condition matches the elements of a sequence by the value of one of their fields.
+type Condition struct {
+	// Field is the key of the field, can be a dotted path for a nested field
+	Field string `yaml:"field"`
+	Value string `yaml:"value"`
+
+	// Tag is the tag of the value, like "!!int" or "!!bool", set from the configuration.
+	// The values with the "!!int" and "!!bool" tags only match the fields of the same type, the other values are compared as strings.
+	Tag string `yaml:"-"`
+}
+
+// UnmarshalYAML reads the condition together with the tag of its value, so that `port: 443` and `port: "443"` are told apart
+func (condition *Condition) UnmarshalYAML(node *yaml.Node) error {
+	type plain Condition
+	if err := node.Decode((*plain)(condition)); err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "value" {
+			condition.Tag = node.Content[i+1].ShortTag()
+		}
+	}
+	return nil
+}
+
+// matches checks if the scalar field has the value of the condition, comparing the integers and the booleans by their values
+func (condition *Condition) matches(field *yaml.Node) bool {
+	switch condition.Tag {
+	case "!!int":
+		if field.ShortTag() != "!!int" {
+			return false
+		}
+		expected, err := strconv.ParseInt(condition.Value, 0, 64)
+		if err != nil {
+			return false
+		}
+		actual, err := strconv.ParseInt(field.Value, 0, 64)
+		return err == nil && actual == expected
+	case "!!bool":
+		if field.ShortTag() != "!!bool" {
+			return false
+		}
+		expected, err := strconv.ParseBool(condition.Value)
+		if err != nil {
+			return false
+		}
+		actual, err := strconv.ParseBool(field.Value)
+		return err == nil && actual == expected
+	default:
+		return field.Value == condition.Value
+	}
+}
+
+// name returns the key of the rule as used in the messages
+func (rule IncludeItem) name() string {
+	if rule.KeyRegex != "" {
+		return "/" + rule.KeyRegex + "/"
+	}
+	if rule.Key == "" && len(rule.AnyOf) > 0 {
+		return strings.Join(rule.AnyOf, "|")
+	}
+	return rule.Key
+}
+
+// matchesValueKind checks if the value is of the kind the rule is limited to, if it's limited to one
+func (rule IncludeItem) matchesValueKind(valueNode *yaml.Node) bool {
+	if valueNode.Kind == yaml.AliasNode {
+		valueNode = valueNode.Alias
+	}
+	switch rule.ValueKind {
+	case KindScalar:
+		return valueNode.Kind == yaml.ScalarNode
+	case KindMapping:
+		return valueNode.Kind == yaml.MappingNode
+	case KindSequence:
+		return valueNode.Kind == yaml.SequenceNode
+	default:
+		return true
+	}
+}
+
+// checkValueKinds checks the value kinds of the rules and their nested rules are supported ones
+func checkValueKinds(rules []IncludeItem) error {
+	for _, rule := range rules {
+		switch rule.ValueKind {
+		case "", KindScalar, KindMapping, KindSequence:
+		default:
+			return fmt.Errorf("rule %q: unsupported valueKind %q, expected %q, %q or %q", rule.name(), rule.ValueKind, KindScalar, KindMapping, KindSequence)
+		}
+		if err := checkValueKinds(rule.nestedRules()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchesMany checks if the rule can match more than one key on the same level
+func (rule IncludeItem) matchesMany() bool {
+	return rule.KeyRegex != "" || isPattern(rule.Key)
+}
+
+// compileKeyRegexps compiles the regular expressions of the rules and their nested rules
+func compileKeyRegexps(rules []IncludeItem, regexps map[string]*regexp.Regexp) error {
+	for _, rule := range rules {
+		if rule.KeyRegex != "" {
+			if _, ok := regexps[rule.KeyRegex]; !ok {
+				compiled, err := regexp.Compile(rule.KeyRegex)
+				if err != nil {
+					return fmt.Errorf("invalid keyRegex %q: %w", rule.KeyRegex, err)
+				}
+				regexps[rule.KeyRegex] = compiled
+			}
+		}
+		if err := compileKeyRegexps(rule.nestedRules(), regexps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ElementRules are the rules of a single element of a sequence, selected by its index.
+// An element without nested rules is kept whole.
+type ElementRules struct {
+	// Index is the position of the element, negative indices count from the end
+	Index   int           `yaml:"index"`
+	Include []IncludeItem `yaml:"include,omitempty"`
+	Exclude []ExcludeItem `yaml:"exclude,omitempty"`
+}
+
+// ExcludeItem is a rule that drops a key, or only some of its nested keys.
+type ExcludeItem struct {
+	Key     string        `yaml:"key"`
+	Exclude []ExcludeItem `yaml:"exclude,omitempty"`
+}
+
+// Configuration holds the trimming rules and options.
+type Configuration struct {
+	Include            []IncludeItem `yaml:"include,omitempty"`
+	Exclude            []ExcludeItem `yaml:"exclude,omitempty"`
+	DropEmptyDocuments bool          `yaml:"dropEmptyDocuments,omitempty"`
+	StripComments      bool          `yaml:"stripComments,omitempty"`
+	InputFormat        string        `yaml:"inputFormat,omitempty"`
+	OutputFormat       string        `yaml:"outputFormat,omitempty"`
+	CaseInsensitive    bool          `yaml:"caseInsensitive,omitempty"`
+
+	// Paths are JSONPath expressions like "$.database.host", the values they select are kept in addition to the ones of the include rules
+	Paths []string `yaml:"paths,omitempty"`
+
+	// Defaults is merged into every trimmed document, the trimmed values take precedence over the defaults
+	Defaults yaml.Node `yaml:"defaults,omitempty"`
+
+	// PreserveOrder keeps the keys in the order of the input, instead of the order of the rules
+	PreserveOrder bool `yaml:"preserveOrder,omitempty"`
+
+	// SortKeys sorts the keys of the mappings in the output, instead of keeping them in the order of the rules
+	SortKeys bool `yaml:"sortKeys,omitempty"`
+
+	// Indent is the number of spaces used for indentation in the output, 2 if not set
+	Indent int `yaml:"indent,omitempty"`
+
+	// MaxDepth is the number of the nesting levels kept in the output, all of them if not set.
+	// The mappings and the sequences below that level are written empty, or dropped with the drop policy for the empty branches.
+	// The depth is applied after the rules.
+	MaxDepth int `yaml:"maxDepth,omitempty"`
+
+	// AlwaysKeep are the top-level keys kept with their whole values in every document, in addition to the ones the rules keep.
+	// Like the rule keys, they can be glob patterns.
+	AlwaysKeep []string `yaml:"alwaysKeep,omitempty"`
+
+	// EmptyBranches is the policy for the nested values that are empty after trimming, kept as "{}" or "[]" if not set
+	EmptyBranches string `yaml:"emptyBranches,omitempty"`
+
+	// EmptyDocuments is the policy for the documents that are empty after trimming, kept if not set.
+	// DropEmptyDocuments is the same as the drop policy.
+	EmptyDocuments string `yaml:"emptyDocuments,omitempty"`
+
+	// OutputStyle is StyleBlock or StyleFlow to write all the mappings and the sequences of the YAML output in that style.
+	// The styles of the input are kept if not set. The flow style keeps only the comments before and after the documents.
+	OutputStyle string `yaml:"outputStyle,omitempty"`
+
+	// LineEnding is LineEndingLF or LineEndingCRLF, the line endings of the output.
+	// The output has LF line endings if not set, whatever the platform and the line endings of the input are.
+	LineEnding string `yaml:"lineEnding,omitempty"`
+
+	// ExplicitStart writes a "---" marker before the first document of the YAML output too, not only between the documents
+	ExplicitStart bool `yaml:"explicitStart,omitempty"`
+
+	// ExplicitEnd writes a "..." marker after every document of the YAML output
+	ExplicitEnd bool `yaml:"explicitEnd,omitempty"`
+
+	// PreserveDirectives writes the directives of the YAML input documents, like "%TAG", before the trimmed documents
+	PreserveDirectives bool `yaml:"preserveDirectives,omitempty"`
+
+	// StripCustomTags removes the tags of the output that are not standard YAML tags, like "!vault", keeping the tagged values.
+	// The tags are kept as they are in the input otherwise, the standard ones like "!!binary" too.
+	StripCustomTags bool `yaml:"stripCustomTags,omitempty"`
+
+	// Inverse keeps the values the rules drop instead of the ones they keep, like for auditing what is trimmed away.
+	// The defaults are not merged into the inverse output.
+	Inverse bool `yaml:"inverse,omitempty"`
+
+	// FailOnEmptyResult makes it an error when the rules keep nothing of an input that is not empty
+	FailOnEmptyResult bool `yaml:"failOnEmptyResult,omitempty"`
+
+	// AnnotateRemovals adds a comment to every mapping in the output listing the keys removed from it
+	AnnotateRemovals bool `yaml:"annotateRemovals,omitempty"`
+
+	// StrictParse makes the duplicate keys in the input mappings an error, instead of keeping all of them
+	StrictParse bool `yaml:"strictParse,omitempty"`
+
+	// Strict makes the rules that can't be applied or match nothing an error instead of skipping them
+	Strict bool `yaml:"strict,omitempty"`
+
+	// Redact lists the keys, or the patterns of the keys like "*_token", whose scalar values are replaced with "***" at any depth.
+	// The keys are kept, and the redaction is applied before the transformers.
+	Redact []string `yaml:"redact,omitempty"`
+
+	// Transformers are applied in order to every node of the trimmed documents, only set from Go
+	Transformers []NodeTransformer `yaml:"-"`
+}
+
+// isPattern checks if a rule key is a glob pattern rather than a literal key
+func isPattern(key string) bool {
+	return strings.ContainsAny(key, "*?")
+}
+
+// splitDottedKey splits a dotted key like "database.credentials.username" into its segments.
+// A literal dot in a key can be escaped with a backslash, like "example\\.com".
+func splitDottedKey(key string) []string {
+	var segments []string
+	var segment strings.Builder
+	for i := 0; i < len(key); i++ {
+		switch {
+		case key[i] == '\\' && i+1 < len(key) && (key[i+1] == '.' || key[i+1] == '\\'):
+			i++
+			segment.WriteByte(key[i])
+		case key[i] == '.':
+			segments = append(segments, segment.String())
+			segment.Reset()
+		default:
+			segment.WriteByte(key[i])
+		}
+	}
+	return append(segments, segment.String())
+}
+
+// expandDottedKeys expands the rules with dotted keys into the equivalent nested rules.
+// Rules that share a key on the same level are merged.
+func expandDottedKeys(rules []IncludeItem) []IncludeItem {
+	var expanded []IncludeItem
+	for _, rule := range expandKeyLists(rules) {
+		item := rule
+		item.Include = expandDottedKeys(rule.Include)
+		item.Elements = expandElementRules(rule.Elements)
+
+		// Regular expressions are not split, as dots have a meaning there
+		if rule.KeyRegex != "" {
+			expanded = mergeIncludeItem(expanded, item)
+			continue
+		}
+
+		// Build the nested rule from the innermost segment outwards, the innermost one keeps the rest of the rule
+		segments := splitDottedKey(rule.Key)
+		item.Key = segments[len(segments)-1]
+		for i := len(segments) - 2; i >= 0; i-- {
+			item = IncludeItem{Key: segments[i], Include: []IncludeItem{item}}
+		}
+
+		expanded = mergeIncludeItem(expanded, item)
+	}
+	return expanded
+}
+
+// expandKeyLists replaces the rules with a list of keys with one rule per key, the rest of the rule being the same
+func expandKeyLists(rules []IncludeItem) []IncludeItem {
+	var expanded []IncludeItem
+	for _, rule := range rules {
+		if len(rule.Keys) == 0 {
+			expanded = append(expanded, rule)
+			continue
+		}
+		for _, key := range rule.Keys {
+			item := rule
+			item.Key = key
+			item.Keys = nil
+			expanded = append(expanded, item)
+		}
+	}
+	return expanded
+}
+
+// checkKeyLists checks the rules with a list of keys or of alternative keys and their nested rules don't have a single key or a regular expression too.
+// The alternative keys are matched on a single level, they can't be dotted paths.
+func checkKeyLists(rules []IncludeItem) error {
+	for _, rule := range rules {
+		if len(rule.Keys) > 0 && (rule.Key != "" || rule.KeyRegex != "") {
+			return fmt.Errorf("rule %q: keys can't be used with key or keyRegex", rule.name())
+		}
+		if len(rule.AnyOf) > 0 && (rule.Key != "" || rule.KeyRegex != "" || len(rule.Keys) > 0 || rule.Recursive) {
+			return fmt.Errorf("rule %q: anyOf can't be used with key, keyRegex, keys or recursive", rule.name())
+		}
+		for _, key := range rule.AnyOf {
+			if len(splitDottedKey(key)) > 1 {
+				return fmt.Errorf("rule %q: anyOf keys must be on a single level, %q is a dotted path", rule.name(), key)
+			}
+		}
+		if err := checkKeyLists(rule.nestedRules()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeIncludeItem adds the rule to the list, merging it with an existing rule with the same key
+func mergeIncludeItem(rules []IncludeItem, rule IncludeItem) []IncludeItem {
+	for i := range rules {
+		if !rules[i].mergeableWith(rule) {
+			continue
+		}
+
+		existing := &rules[i]
+		if len(existing.Include) == 0 || len(rule.Include) == 0 {
+			// One of the rules keeps the whole value already
+			existing.Include = nil
+		} else {
+			for _, nested := range rule.Include {
+				existing.Include = mergeIncludeItem(existing.Include, nested)
+			}
+		}
+		existing.Exclude = append(append([]ExcludeItem{}, existing.Exclude...), rule.Exclude...)
+		if existing.Default.Kind == 0 {
+			existing.Default = rule.Default
+		}
+		return rules
+	}
+	return append(rules, rule)
+}
+
+// checkDuplicateKeys checks the rules and their nested rules for literal keys listed more than once on the same level.
+// The rules with the same options are merged already, the others are kept apart: the values they keep are merged if
+// they are mappings, and the value of the first rule is kept otherwise. In strict mode such duplicates are an error.
+func checkDuplicateKeys(rules []IncludeItem, strict, caseInsensitive bool) error {
+	for i, rule := range rules {
+		if rule.isLiteral() && rule.As == "" && len(rule.AnyOf) == 0 {
+			for _, other := range rules[:i] {
+				if !other.isLiteral() || other.As != "" || len(other.AnyOf) > 0 || !(other.Key == rule.Key || caseInsensitive && strings.EqualFold(other.Key, rule.Key)) {
+					continue
+				}
+				if strict {
+					return fmt.Errorf("rule %q: key is listed more than once on the same level with different options, the rules can't be merged", rule.name())
+				}
+				logrus.Debugf("Rule %q is listed more than once on the same level with different options, the first match is kept if the values can't be merged", rule.name())
+				break
+			}
+		}
+		if err := checkDuplicateKeys(rule.Include, strict, caseInsensitive); err != nil {
+			return err
+		}
+		// The rules of different elements apply to different values, they are checked apart
+		for _, element := range rule.Elements {
+			if err := checkDuplicateKeys(element.Include, strict, caseInsensitive); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mergeableWith checks if the rule can be merged with the other one: they match the same keys with the same options,
+// so that only their nested rules, exclusions and defaults differ. The rules with elements are never merged.
+func (rule IncludeItem) mergeableWith(other IncludeItem) bool {
+	return rule.Key == other.Key &&
+		rule.KeyRegex == other.KeyRegex &&
+		slices.Equal(rule.AnyOf, other.AnyOf) &&
+		sameIndex(rule.Index, other.Index) &&
+		sameCondition(rule.Where, other.Where) &&
+		rule.As == other.As &&
+		rule.Recursive == other.Recursive &&
+		rule.ValueKind == other.ValueKind &&
+		rule.Transform == other.Transform &&
+		rule.Coerce == other.Coerce &&
+		sameBound(rule.Min, other.Min) &&
+		sameBound(rule.Max, other.Max) &&
+		len(rule.Elements) == 0 && len(other.Elements) == 0
+}
+
+// sameIndex checks if two rules target the same sequence index, or both target the whole value
+func sameIndex(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// sortKeys sorts the key/value pairs of the mappings in the node and all of its descendants by key.
+// The order of the elements of sequences is kept.
+func sortKeys(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		pairs := make([][2]*yaml.Node, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			pairs = append(pairs, [2]*yaml.Node{node.Content[i], node.Content[i+1]})
+		}
+		sort.SliceStable(pairs, func(i, j int) bool {
+			return pairs[i][0].Value < pairs[j][0].Value
+		})
+		node.Content = node.Content[:0]
+		for _, pair := range pairs {
+			node.Content = append(node.Content, pair[0], pair[1])
+		}
+	}
+	for _, child := range node.Content {
+		sortKeys(child)
+	}
+}
+
+// sameCondition checks if two rules have the same where condition, or both have none
+func sameCondition(a, b *Condition) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// stripComments removes the comments of the node and all of its descendants
+func stripComments(node *yaml.Node) {
+	node.HeadComment = ""
+	node.LineComment = ""
+	node.FootComment = ""
+	for _, child := range node.Content {
+		stripComments(child)
+	}
+}
+
+// stripCustomTags removes the tags of the node and all of its descendants that are not standard YAML tags, like "!vault".
+// The standard tags, like "!!binary", are kept.
+// The scalars with a removed tag stay strings, as they are decoded as strings with the tag too.
+func stripCustomTags(node *yaml.Node) {
+	if node.Tag != "" && !strings.HasPrefix(node.Tag, "!!") {
+		logrus.Debugf("Removing the tag %q at line %d, column %d", node.Tag, node.Line, node.Column)
+		switch node.Kind {
+		case yaml.ScalarNode:
+			node.Tag = "!!str"
+		default:
+			node.Tag = ""
+		}
+		node.Style &^= yaml.TaggedStyle
+	}
+	for _, child := range node.Content {
+		stripCustomTags(child)
+	}
+}
+
+// isCollection checks if a node can have nested keys, either directly or in its elements
+func isCollection(node *yaml.Node) bool {
+	return node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode
+}
+
+// isCollectionValue checks if a value is a collection, or an alias of one, which the nested rules filter the same way
+func isCollectionValue(node *yaml.Node) bool {
+	if node.Kind == yaml.AliasNode {
+		return isCollection(node.Alias)
+	}
+	return isCollection(node)
+}
+
+// filter applies the rules to the nodes of a document using the options of the configuration
+type filter struct {
+	config *Configuration
+
+	// regexps holds the compiled regular expressions of the rules
+	regexps map[string]*regexp.Regexp
+
+	// unmatched collects the paths of the include rules that matched nothing
+	unmatched []string
+}
+
+// joinPath appends a key to a dotted path, escaping the dots in the key
+func joinPath(path, key string) string {
+	key = strings.ReplaceAll(key, ".", "\\.")
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// matchKey checks if a key matches a rule key, using path/filepath.Match semantics for glob patterns
+func (f *filter) matchKey(ruleKey, key string) bool {
+	if f.config.CaseInsensitive {
+		ruleKey = strings.ToLower(ruleKey)
+		key = strings.ToLower(key)
+	}
+	if !isPattern(ruleKey) {
+		return ruleKey == key
+	}
+	matched, err := filepath.Match(ruleKey, key)
+	if err != nil {
+		logrus.Debugf("Invalid key pattern %q: %v", ruleKey, err)
+		return false
+	}
+	return matched
+}
+
+// resolveAnyOf returns the rule with its key set to the first of its alternative keys in the mapping,
+// or to the first alternative if none of them is in the mapping
+func (f *filter) resolveAnyOf(rule IncludeItem, mapping *yaml.Node) IncludeItem {
+	rule.Key = rule.AnyOf[0]
+	for _, key := range rule.AnyOf {
+		if f.hasKey(mapping, key) {
+			rule.Key = key
+			break
+		}
+	}
+	return rule
+}
+
+// matchRule checks if a key matches the regular expression of the rule, or its key
+func (f *filter) matchRule(rule IncludeItem, key string) bool {
+	if rule.KeyRegex != "" {
+		return f.regexps[rule.KeyRegex].MatchString(key)
+	}
+	return f.matchKey(rule.Key, key)
+}
+
+// alwaysKept checks if a top-level key is one of the keys that are always kept
+func (f *filter) alwaysKept(key string) bool {
+	for _, alwaysKeep := range f.config.AlwaysKeep {
+		if f.matchKey(alwaysKeep, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// findExcludeRule returns the exclude rule for the given key, or nil if there is none
+func (f *filter) findExcludeRule(excludes []ExcludeItem, key string) *ExcludeItem {
+	for i := range excludes {
+		if f.matchKey(excludes[i].Key, key) {
+			return &excludes[i]
+		}
+	}
+	return nil
+}
+
+// filterValue applies the nested rules to a value node.
+// Mappings are filtered directly, sequences have the rules applied to each of their elements.
+// An alias is filtered as the node it refers to, the anchored node itself is left as it is.
+func (f *filter) filterValue(rules []IncludeItem, excludes []ExcludeItem, path string, valueNode *yaml.Node) (*yaml.Node, error) {
+	if valueNode.Kind == yaml.AliasNode {
+		valueNode = valueNode.Alias
+	}
+	if valueNode.Kind != yaml.SequenceNode {
+		var outputNode yaml.Node
+		if err := f.filterByRules(rules, excludes, path, valueNode, &outputNode); err != nil {
+			return nil, err
+		}
+		return &outputNode, nil
+	}
+
+	// Create an output node as a sequence node of the same length
+	outputNode := &yaml.Node{}
+	copyProperties(valueNode, outputNode)
+	for i, element := range valueNode.Content {
+		filteredElement, err := f.filterValue(rules, excludes, fmt.Sprintf("%s[%d]", path, i), element)
+		if err != nil {
+			return nil, err
+		}
+		if f.dropsEmpty(filteredElement) {
+			continue
+		}
+		outputNode.Content = append(outputNode.Content, filteredElement)
+	}
+	return outputNode, nil
+}
+
+// dropsEmpty checks if a filtered value is dropped from its parent, because it is empty and the policy is to drop such values
+func (f *filter) dropsEmpty(node *yaml.Node) bool {
+	return f.config.EmptyBranches == EmptyDrop && isCollection(node) && len(node.Content) == 0
+}
+
+// copyProperties copies the kind, the tag, the style and the comments of a node to a node built from it,
+// so that a filtered collection is written the same way as the input one.
+// The position is copied too, for the inverse trimming to find the output node of an input node.
+func copyProperties(from, to *yaml.Node) {
+	to.Kind = from.Kind
+	to.Line = from.Line
+	to.Column = from.Column
+	to.Tag = from.Tag
+	to.Style = from.Style
+	to.HeadComment = from.HeadComment
+	to.LineComment = from.LineComment
+	to.FootComment = from.FootComment
+}
+
+// filterRoot applies the rules to the root node of a document.
+// The rules of a sequence root apply to each of its elements, like the elements are documents themselves.
+func (f *filter) filterRoot(rules []IncludeItem, excludes []ExcludeItem, inputNode, outputNode *yaml.Node) error {
+	if inputNode.Kind != yaml.SequenceNode {
+		return f.filterByRules(rules, excludes, "", inputNode, outputNode)
+	}
+
+	copyProperties(inputNode, outputNode)
+	for i, element := range inputNode.Content {
+		var outputElement yaml.Node
+		if err := f.filterByRules(rules, excludes, fmt.Sprintf("[%d]", i), element, &outputElement); err != nil {
+			return err
+		}
+		outputNode.Content = append(outputNode.Content, &outputElement)
+	}
+	return nil
+}
+
+// isTopLevel checks if the path is the one of a document root, or of an element of a sequence root
+func isTopLevel(path string) bool {
+	if path == "" {
+		return true
+	}
+	if !strings.HasPrefix(path, "[") || !strings.HasSuffix(path, "]") {
+		return false
+	}
+	_, err := strconv.Atoi(path[1 : len(path)-1])
+	return err == nil
+}
+
+func (f *filter) filterByRules(rules []IncludeItem, excludes []ExcludeItem, path string, inputNode, outputNode *yaml.Node) error {
+	if inputNode.Kind == yaml.AliasNode {
+		inputNode = inputNode.Alias
+	}
+	if inputNode.Kind != yaml.MappingNode {
+		return fmt.Errorf("input node is not a mapping node at line %d, column %d", inputNode.Line, inputNode.Column)
+	}
+
+	// Create an output node as a mapping node
+	copyProperties(inputNode, outputNode)
+
+	// Without include rules, everything is kept except the excluded keys
+	if len(rules) == 0 {
+		for i := 0; i < len(inputNode.Content); i += 2 {
+			keyNode := inputNode.Content[i]
+			valueNode := inputNode.Content[i+1]
+
+			exclude := f.findExcludeRule(excludes, keyNode.Value)
+			if exclude != nil && isTopLevel(path) && f.alwaysKept(keyNode.Value) {
+				exclude = nil
+			}
+			if exclude == nil {
+				// Not excluded, copy the key and the value directly
+				outputNode.Content = append(outputNode.Content, keyNode, valueNode)
+			} else if len(exclude.Exclude) > 0 && isCollectionValue(valueNode) {
+				// Only some keys of the value are excluded, process the value node recursively
+				nestedOutputNode, err := f.filterValue(nil, exclude.Exclude, joinPath(path, keyNode.Value), valueNode)
+				if err != nil {
+					return err
+				}
+				if f.dropsEmpty(nestedOutputNode) {
+					continue
+				}
+				outputNode.Content = append(outputNode.Content, keyNode, nestedOutputNode)
+			} else if len(exclude.Exclude) > 0 {
+				// Nested exclusions only apply to mappings and sequences, keep other values as they are
+				outputNode.Content = append(outputNode.Content, keyNode, valueNode)
+			}
+		}
+		f.annotateRemovals(inputNode, outputNode, nil)
+		return nil
+	}
+
+	// Iterate over the rules, remembering the position in the input of every kept key
+	var renames []rename
+	renamed := map[*yaml.Node]bool{}
+	var sources []int
+	for _, rule := range rules {
+		// A recursive rule matches the keys at any depth, the paths to them are merged with the output of the other rules
+		if rule.Recursive {
+			descended, err := f.descend(rule, path, inputNode)
+			if err != nil {
+				return err
+			}
+			if descended == nil {
+				logrus.Debugf("Rule %q matched nothing", joinPath(path, rule.name()))
+				f.unmatched = append(f.unmatched, joinPath(path, rule.name()))
+				continue
+			}
+			for i := 0; i+1 < len(descended.Content); i += 2 {
+				if mergePair(outputNode, descended.Content[i], descended.Content[i+1], renamed) {
+					sources = append(sources, keyIndex(inputNode, descended.Content[i]))
+				}
+			}
+			continue
+		}
+
+		// A rule with alternative keys matches the first of them in the input, or names the first one if none of them is
+		if len(rule.AnyOf) > 0 {
+			rule = f.resolveAnyOf(rule, inputNode)
+		}
+
+		matched := false
+
+		// Find the corresponding keys in the input YAML
+		for i := 0; i < len(inputNode.Content); i += 2 {
+			keyNode := inputNode.Content[i]
+			valueNode := inputNode.Content[i+1]
+
+			if !f.matchRule(rule, keyNode.Value) || !rule.matchesValueKind(valueNode) {
+				continue
+			}
+			matched = true
+
+			// Keep only the numbers in the range, if the rule has one
+			if inRange, err := f.inBounds(rule, joinPath(path, keyNode.Value), valueNode); err != nil {
+				return err
+			} else if !inRange {
+				continue
+			}
+
+			// Include wins over exclude on the same level, but the nested exclusions are still applied to the included subtree
+			nestedExcludes := append([]ExcludeItem{}, rule.Exclude...)
+			if exclude := f.findExcludeRule(excludes, keyNode.Value); exclude != nil {
+				nestedExcludes = append(nestedExcludes, exclude.Exclude...)
+			}
+
+			// Keep only the elements of a sequence matching the condition, if the rule has one
+			if rule.Where != nil {
+				filtered, err := f.filterElements(rule, valueNode)
+				if err != nil {
+					return err
+				}
+				if f.dropsEmpty(filtered) {
+					logrus.Debugf("Dropping %q, no element matches the condition", joinPath(path, keyNode.Value))
+					continue
+				}
+				valueNode = filtered
+			}
+
+			// Pick a single element of a sequence, if the rule targets one
+			if rule.Index != nil {
+				element, err := f.selectElement(rule, valueNode)
+				if err != nil {
+					return err
+				}
+				if element == nil {
+					// An out of range index is skipped
+					continue
+				}
+				sequenceNode := &yaml.Node{}
+				copyProperties(valueNode, sequenceNode)
+				sequenceNode.Content = []*yaml.Node{element}
+				valueNode = sequenceNode
+			}
+
+			// Keep only the listed elements of a sequence, each trimmed with its own rules and the exclusions, if the rule has them
+			if len(rule.Elements) > 0 {
+				elements, err := f.filterElementRules(rule, nestedExcludes, joinPath(path, keyNode.Value), valueNode)
+				if err != nil {
+					return err
+				}
+				if f.dropsEmpty(elements) {
+					logrus.Debugf("Dropping %q, none of its elements is kept", joinPath(path, keyNode.Value))
+					continue
+				}
+				valueNode = elements
+			} else if len(rule.Include) > 0 || (len(nestedExcludes) > 0 && isCollectionValue(valueNode)) {
+				// If there are nested rules, process the value node recursively
+				nestedOutputNode, err := f.filterValue(rule.Include, nestedExcludes, joinPath(path, keyNode.Value), valueNode)
+				if err != nil {
+					return err
+				}
+				if f.dropsEmpty(nestedOutputNode) {
+					logrus.Debugf("Dropping %q, it is empty after trimming", joinPath(path, keyNode.Value))
+					continue
+				}
+				valueNode = nestedOutputNode
+			}
+
+			valueNode, err := f.transformValue(rule, joinPath(path, keyNode.Value), valueNode)
+			if err != nil {
+				return err
+			}
+			valueNode, err = f.coerceValue(rule, joinPath(path, keyNode.Value), valueNode)
+			if err != nil {
+				return err
+			}
+
+			// Emit a copy of the key with the new name, if the rule renames it
+			if rule.As != "" {
+				renamedKey := *keyNode
+				renamedKey.Tag = "!!str"
+				renamedKey.Value = rule.As
+				renames = append(renames, rename{key: &renamedKey, from: keyNode.Value, overwrite: rule.Overwrite})
+				renamed[&renamedKey] = true
+				keyNode = &renamedKey
+				outputNode.Content = append(outputNode.Content, keyNode, valueNode)
+				sources = append(sources, i)
+			} else if mergePair(outputNode, keyNode, valueNode, renamed) {
+				// The keys matched by several rules are merged, like a key matched by a pattern and by its name
+				sources = append(sources, i)
+			}
+
+			// A literal key can only match once, a pattern or a regular expression can match many keys
+			if !rule.matchesMany() {
+				break
+			}
+		}
+
+		// A missing key with a default is emitted with it, after the keys of the input when their order is preserved
+		if !matched && !f.config.Inverse && rule.isLiteral() && (rule.Default.Kind != 0 || hasDefaults(rule.Include)) && !f.hasKey(inputNode, rule.Key) {
+			valueNode, err := f.defaultValue(rule, path)
+			if err != nil {
+				return err
+			}
+			if valueNode == nil {
+				continue
+			}
+			logrus.Debugf("Rule %q matched nothing, using its default", joinPath(path, rule.name()))
+			keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: rule.Key}
+			if rule.As != "" {
+				keyNode.Value = rule.As
+				renames = append(renames, rename{key: keyNode, from: rule.Key, overwrite: rule.Overwrite})
+				renamed[keyNode] = true
+				outputNode.Content = append(outputNode.Content, keyNode, valueNode)
+				sources = append(sources, len(inputNode.Content))
+			} else if mergePair(outputNode, keyNode, valueNode, renamed) {
+				sources = append(sources, len(inputNode.Content))
+			}
+			continue
+		}
+
+		if !matched {
+			logrus.Debugf("Rule %q matched nothing", joinPath(path, rule.name()))
+			f.unmatched = append(f.unmatched, joinPath(path, rule.name()))
+		}
+	}
+
+	// The always kept keys are only on the top level
+	if isTopLevel(path) {
+		for i := 0; i+1 < len(inputNode.Content); i += 2 {
+			if f.alwaysKept(inputNode.Content[i].Value) && mergePair(outputNode, inputNode.Content[i], inputNode.Content[i+1], renamed) {
+				sources = append(sources, i)
+			}
+		}
+	}
+
+	if f.config.PreserveOrder {
+		sortByInputOrder(outputNode, sources)
+	}
+
+	if err := resolveRenames(path, outputNode, renames); err != nil {
+		return err
+	}
+	f.annotateRemovals(inputNode, outputNode, renames)
+	return nil
+}
+
+// annotateRemovals adds a comment to the output mapping listing the keys of the input mapping that are not in it,
+// if the removals are annotated. The renamed keys are not removed.
+func (f *filter) annotateRemovals(inputNode, outputNode *yaml.Node, renames []rename) {
+	if !f.config.AnnotateRemovals {
+		return
+	}
+
+	kept := map[string]bool{}
+	for i := 0; i < len(outputNode.Content); i += 2 {
+		kept[outputNode.Content[i].Value] = true
+	}
+	for _, r := range renames {
+		kept[r.from] = true
+	}
+
+	var removed []string
+	for i := 0; i < len(inputNode.Content); i += 2 {
+		if key := inputNode.Content[i].Value; !kept[key] {
+			removed = append(removed, key)
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+
+	annotation := "removed: " + strings.Join(removed, ", ")
+	if outputNode.HeadComment != "" {
+		annotation = outputNode.HeadComment + "\n" + annotation
+	}
+	outputNode.HeadComment = annotation
+}
+
+// sortByInputOrder reorders the key/value pairs of the output mapping by the positions of the keys in the input.
+// The pairs from the same input key keep the order of the rules.
+func sortByInputOrder(outputNode *yaml.Node, sources []int) {
+	pairs := make([]int, len(sources))
+	for i := range pairs {
+		pairs[i] = i
+	}
+	sort.SliceStable(pairs, func(a, b int) bool {
+		return sources[pairs[a]] < sources[pairs[b]]
+	})
+
+	content := outputNode.Content
+	outputNode.Content = make([]*yaml.Node, 0, len(content))
+	for _, pair := range pairs {
+		outputNode.Content = append(outputNode.Content, content[2*pair], content[2*pair+1])
+	}
+}
+
+// rename is a key of an output mapping renamed by a rule
+type rename struct {
+	key       *yaml.Node
+	from      string
+	overwrite bool
+}
+
+// resolveRenames checks that the renamed keys don't collide with the other keys of the output mapping.
+// A renamed key of a rule that allows overwriting replaces the colliding keys instead.
+func resolveRenames(path string, outputNode *yaml.Node, renames []rename) error {
+	dropped := map[*yaml.Node]bool{}
+	for _, r := range renames {
+		if dropped[r.key] {
+			continue
+		}
+		name := r.key.Value
+		for i := 0; i < len(outputNode.Content); i += 2 {
+			keyNode := outputNode.Content[i]
+			if keyNode == r.key || dropped[keyNode] || keyNode.Value != name {
+				continue
+			}
+			if !r.overwrite {
+				return fmt.Errorf("key %q renamed to %q collides with an existing key at %s", r.from, name, joinPath(path, name))
+			}
+			dropped[keyNode] = true
+		}
+	}
+	if len(dropped) == 0 {
+		return nil
+	}
+
+	content := outputNode.Content
+	outputNode.Content = nil
+	for i := 0; i < len(content); i += 2 {
+		if !dropped[content[i]] {
+			outputNode.Content = append(outputNode.Content, content[i], content[i+1])
+		}
+	}
+	return nil
+}
+
+// filterElements returns a sequence with only the elements of the sequence value matching the where condition of the rule
+func (f *filter) filterElements(rule IncludeItem, valueNode *yaml.Node) (*yaml.Node, error) {
+	if valueNode.Kind == yaml.AliasNode {
+		valueNode = valueNode.Alias
+	}
+	if valueNode.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("value of key %q is not a sequence node at line %d, column %d", rule.Key, valueNode.Line, valueNode.Column)
+	}
+
+	outputNode := &yaml.Node{}
+	copyProperties(valueNode, outputNode)
+	segments := splitDottedKey(rule.Where.Field)
+	for _, element := range valueNode.Content {
+		if field := f.findField(element, segments); field != nil && field.Kind == yaml.ScalarNode && rule.Where.matches(field) {
+			outputNode.Content = append(outputNode.Content, element)
+		}
+	}
+	logrus.Debugf("%d of %d elements of key %q match the condition", len(outputNode.Content), len(valueNode.Content), rule.Key)
+	return outputNode, nil
+}
+
+// findField returns the value of the nested field of a mapping, or nil if there is no such field.
+// The aliases are followed on the way, and the field itself is returned as the node its alias refers to.
+func (f *filter) findField(node *yaml.Node, segments []string) *yaml.Node {
+	for _, segment := range segments {
+		if node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		var value *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if f.matchKey(segment, node.Content[i].Value) {
+				value = node.Content[i+1]
+				break
+			}
+		}
+		if value == nil {
+			return nil
+		}
+		node = value
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// selectElement returns the element of a sequence value targeted by the index of the rule.
+// For an out of range index, nil is returned, or an error in strict mode.
+func (f *filter) selectElement(rule IncludeItem, valueNode *yaml.Node) (*yaml.Node, error) {
+	if valueNode.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("value of key %q is not a sequence node at line %d, column %d", rule.Key, valueNode.Line, valueNode.Column)
+	}
+
+	index := *rule.Index
+	if index < 0 {
+		index += len(valueNode.Content)
+	}
+	if index < 0 || index >= len(valueNode.Content) {
+		if f.config.Strict {
+			return nil, fmt.Errorf("index %d is out of range for key %q with %d elements at line %d, column %d", *rule.Index, rule.Key, len(valueNode.Content), valueNode.Line, valueNode.Column)
+		}
+		logrus.Debugf("Index %d is out of range for key %q with %d elements, skipping", *rule.Index, rule.Key, len(valueNode.Content))
+		return nil, nil
+	}
+
+	return valueNode.Content[index], nil
+}
+
+// resolveAliases inlines the aliases whose anchor is not defined earlier in the output,
+// like an alias under a retained key referring to an anchor under a dropped key.
+// The nodes are walked in document order and the defined anchors are collected on the way.
+func resolveAliases(node *yaml.Node, defined map[*yaml.Node]bool) {
+	for i, child := range node.Content {
+		if child.Kind == yaml.AliasNode && !defined[child.Alias] {
+			logrus.Debugf("Inlining the alias %q at line %d, column %d, as its anchor is not in the output", child.Value, child.Line, child.Column)
+
+			// Copy the anchored node without its anchor, as the original may still be used elsewhere
+			inlined := *child.Alias
+			inlined.Anchor = ""
+			inlined.Content = append([]*yaml.Node{}, child.Alias.Content...)
+			inlined.HeadComment = child.HeadComment
+			inlined.LineComment = child.LineComment
+			inlined.FootComment = child.FootComment
+			node.Content[i] = &inlined
+			child = &inlined
+		}
+
+		if child.Anchor != "" {
+			defined[child] = true
+		}
+		resolveAliases(child, defined)
+	}
+}
+
+// isEmptyDocument checks if a document node has no content but a null value
+func isEmptyDocument(document *yaml.Node) bool {
+	if len(document.Content) == 0 {
+		return true
+	}
+	node := document.Content[0]
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null" && node.Value == ""
+}
+
+// Trim trims the input YAML by keeping only the keys matched by the given include rules,
+// applying the transformers to the kept nodes.
+func Trim(input []byte, rules []IncludeItem, transformers ...NodeTransformer) ([]byte, error) {
+	config := Configuration{Include: rules, Transformers: transformers}
+	return config.Trim(input)
+}
+
+// Trim trims the input YAML using the rules and the options of the configuration.
+// Input with multiple documents is supported, each document is trimmed with the same rules.
+// JSON input is supported as well, the output is JSON then too unless another output format is configured.
+func (config *Configuration) Trim(input []byte) ([]byte, error) {
+	return config.TrimContext(context.Background(), input)
+}
+
+// TrimContext is like Trim, but stops with the error of the context when it is canceled or its deadline passes.
+func (config *Configuration) TrimContext(ctx context.Context, input []byte) ([]byte, error) {
+	documents, outputFormat, err := config.trim(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.encode(documents, outputFormat)
+}
+
+// Document is a trimmed document of the input.
+type Document struct {
+	// Name is the value of the name field in the input document, empty if the document has no such field
+	Name    string
+	Content []byte
+
+	// Format is the format of the content, FormatYAML or FormatJSON
+	Format string
+}
+
+// TrimDocuments is like Trim, but returns every trimmed document separately.
+// The name of a document is the scalar value at the dotted path nameField in the input document.
+func (config *Configuration) TrimDocuments(input []byte, nameField string) ([]Document, error) {
+	return config.TrimDocumentsContext(context.Background(), input, nameField)
+}
+
+// TrimDocumentsContext is like TrimDocuments, but stops with the error of the context when it is canceled.
+func (config *Configuration) TrimDocumentsContext(ctx context.Context, input []byte, nameField string) ([]Document, error) {
+	documents, outputFormat, err := config.trim(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &filter{config: config}
+	var segments []string
+	if nameField != "" {
+		segments = splitDottedKey(nameField)
+	}
+
+	var result []Document
+	for _, document := range documents {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		content, err := config.encode([]trimmedDocument{document}, outputFormat)
+		if err != nil {
+			return nil, err
+		}
+
+		var name string
+		if segments != nil {
+			if field := f.findField(document.input.Content[0], segments); field != nil && field.Kind == yaml.ScalarNode {
+				name = field.Value
+			}
+		}
+		result = append(result, Document{Name: name, Content: content, Format: outputFormat})
+	}
+	return result, nil
+}
+
+// trimmedDocument is a document of the input with its trimmed output
+type trimmedDocument struct {
+	input  *yaml.Node
+	output *yaml.Node
+
+	// directives are the directive lines of the input document, only set with PreserveDirectives
+	directives []string
+}
+
+// trim parses the input and trims its documents, it returns them with the format of the output
+func (config *Configuration) trim(ctx context.Context, input []byte) ([]trimmedDocument, string, error) {
+	rules, regexps, err := config.prepare()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Parse the input documents into yaml.Nodes
+	inputFormat := config.inputFormat(input)
+	documents, err := decodeContent(input, inputFormat)
+	if err != nil {
+		return nil, "", err
+	}
+	logrus.Debugf("Parsed %d input documents successfully", len(documents))
+
+	var directives [][]string
+	if config.PreserveDirectives && inputFormat == FormatYAML {
+		directives = scanDirectives(input)
+	}
+
+	var trimmed []trimmedDocument
+	resultEmpty := true
+	for i, root := range documents {
+		if err := ctx.Err(); err != nil {
+			return nil, "", err
+		}
+
+		// Skip the empty documents, like the one between two consecutive "---" separators
+		if isEmptyDocument(root) {
+			logrus.Debugf("Skipping empty input YAML document %d", i)
+			continue
+		}
+
+		outputDocument, empty, err := config.trimDocument(i, root, rules, regexps)
+		if err != nil {
+			return nil, "", err
+		}
+		if !empty {
+			resultEmpty = false
+		}
+		if outputDocument == nil {
+			continue
+		}
+
+		document := trimmedDocument{input: root, output: outputDocument}
+		if i < len(directives) {
+			document.directives = directives[i]
+		}
+		trimmed = append(trimmed, document)
+	}
+
+	if config.FailOnEmptyResult && resultEmpty {
+		return nil, "", errEmptyResult
+	}
+
+	// The output format matches the input format, unless configured otherwise
+	outputFormat := config.OutputFormat
+	if outputFormat == "" {
+		outputFormat = inputFormat
+	}
+	return trimmed, outputFormat, nil
+}
+
+// errEmptyResult is the error of FailOnEmptyResult
+var errEmptyResult = fmt.Errorf("the trimmed result is empty, the rules matched nothing in the input")
+
+// prepare validates the options and the rules of the configuration before trimming begins.
+// It returns the rules with the dotted keys and the paths expanded, and their compiled regular expressions.
+func (config *Configuration) prepare() ([]IncludeItem, map[string]*regexp.Regexp, error) {
+	if err := checkKeyLists(config.Include); err != nil {
+		return nil, nil, err
+	}
+	pathRules, err := config.pathRules()
+	if err != nil {
+		return nil, nil, err
+	}
+	rules := expandDottedKeys(append(append([]IncludeItem{}, config.Include...), pathRules...))
+
+	// Invalid regular expressions are configuration errors, found before trimming begins
+	regexps := map[string]*regexp.Regexp{}
+	if err := compileKeyRegexps(rules, regexps); err != nil {
+		return nil, nil, err
+	}
+	if err := checkRecursiveRules(rules); err != nil {
+		return nil, nil, err
+	}
+	if err := checkValueKinds(rules); err != nil {
+		return nil, nil, err
+	}
+	if err := checkTransforms(rules); err != nil {
+		return nil, nil, err
+	}
+	if err := checkRuleDefaults(rules); err != nil {
+		return nil, nil, err
+	}
+	if err := checkBounds(rules); err != nil {
+		return nil, nil, err
+	}
+	if err := checkCoercions(rules); err != nil {
+		return nil, nil, err
+	}
+	if err := checkElementRules(rules); err != nil {
+		return nil, nil, err
+	}
+	if err := checkDuplicateKeys(rules, config.Strict, config.CaseInsensitive); err != nil {
+		return nil, nil, err
+	}
+
+	if config.Defaults.Kind != 0 && config.Defaults.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("defaults must be a mapping at line %d, column %d", config.Defaults.Line, config.Defaults.Column)
+	}
+
+	if _, err := config.indent(); err != nil {
+		return nil, nil, err
+	}
+	if config.MaxDepth < 0 {
+		return nil, nil, fmt.Errorf("maxDepth: must not be negative, got %d", config.MaxDepth)
+	}
+
+	if err := validateEmptyPolicy("emptyBranches", config.EmptyBranches); err != nil {
+		return nil, nil, err
+	}
+	if err := validateEmptyPolicy("emptyDocuments", config.EmptyDocuments); err != nil {
+		return nil, nil, err
+	}
+	switch config.OutputStyle {
+	case "", StyleBlock, StyleFlow:
+	default:
+		return nil, nil, fmt.Errorf("outputStyle: unsupported style %q, expected %q or %q", config.OutputStyle, StyleBlock, StyleFlow)
+	}
+	for i, pattern := range config.Redact {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, nil, fmt.Errorf("redact[%d]: invalid pattern %q: %w", i, pattern, err)
+		}
+	}
+	switch config.LineEnding {
+	case "", LineEndingLF, LineEndingCRLF:
+	default:
+		return nil, nil, fmt.Errorf("lineEnding: unsupported line ending %q, expected %q or %q", config.LineEnding, LineEndingLF, LineEndingCRLF)
+	}
+	return rules, regexps, nil
+}
+
+// trimDocument trims the input document i, which is not empty.
+// It returns nil if the trimmed document is dropped, and whether the trimmed document has no content.
+func (config *Configuration) trimDocument(i int, root *yaml.Node, rules []IncludeItem, regexps map[string]*regexp.Regexp) (*yaml.Node, bool, error) {
+	if config.StrictParse {
+		if duplicates := findDuplicateKeys("", root.Content[0]); len(duplicates) > 0 {
+			return nil, false, fmt.Errorf("duplicate keys in input YAML document %d: %s", i, strings.Join(duplicates, ", "))
+		}
+	}
+
+	// Apply trimming rules recursively
+	var outputNode yaml.Node
+	filter := &filter{config: config, regexps: regexps}
+	if err := filter.filterRoot(rules, config.Exclude, root.Content[0], &outputNode); err != nil {
+		return nil, false, fmt.Errorf("failed to trim input YAML document %d: %w", i, err)
+	}
+	if config.Strict && len(filter.unmatched) > 0 {
+		return nil, false, fmt.Errorf("rules matched nothing in input YAML document %d: %s", i, strings.Join(filter.unmatched, ", "))
+	}
+	logrus.Debugf("Trimmed input YAML document %d successfully", i)
+
+	if config.Inverse {
+		outputNode = *complement(root.Content[0], &outputNode)
+	}
+
+	empty := len(outputNode.Content) == 0
+	if empty && (config.DropEmptyDocuments || config.EmptyDocuments == EmptyDrop) {
+		logrus.Debugf("Dropping empty YAML document %d", i)
+		return nil, true, nil
+	}
+
+	if config.Defaults.Kind != 0 && !config.Inverse {
+		mergeRootDefaults(&outputNode, &config.Defaults)
+	}
+	trimmedRoot := &outputNode
+	if config.MaxDepth > 0 {
+		trimmedRoot = config.truncateRoot(trimmedRoot)
+	}
+
+	// Keep the comments of the document, like a comment at the top of the file
+	outputDocument := &yaml.Node{
+		Kind:        yaml.DocumentNode,
+		HeadComment: root.HeadComment,
+		LineComment: root.LineComment,
+		FootComment: root.FootComment,
+		Content:     []*yaml.Node{trimmedRoot},
+	}
+	// Sorting goes first, so that the aliases moved before their anchors are inlined
+	if config.SortKeys {
+		sortKeys(outputDocument)
+	}
+	resolveAliases(outputDocument, map[*yaml.Node]bool{})
+	if config.StripComments {
+		stripComments(outputDocument)
+	}
+	if config.StripCustomTags {
+		stripCustomTags(outputDocument)
+	}
+	if config.OutputStyle != "" {
+		setStyle(outputDocument, config.OutputStyle == StyleFlow)
+	}
+	transformers := config.Transformers
+	if len(config.Redact) > 0 {
+		transformers = append([]NodeTransformer{&redactor{filter: filter}}, transformers...)
+	}
+	for _, transformer := range transformers {
+		if err := applyTransformer(transformer, nil, trimmedRoot); err != nil {
+			return nil, false, fmt.Errorf("failed to transform trimmed YAML document %d: %w", i, err)
+		}
+	}
+	return outputDocument, empty, nil
+}
+
+// validateEmptyPolicy checks if the policy for the empty values is one of the supported ones
+func validateEmptyPolicy(field, policy string) error {
+	switch policy {
+	case "", EmptyKeep, EmptyDrop:
+		return nil
+	default:
+		return fmt.Errorf("%s: unsupported policy %q, expected %q or %q", field, policy, EmptyKeep, EmptyDrop)
+	}
+}
+
+// indent returns the configured indentation of the output, or the default one
+func (config *Configuration) indent() (int, error) {
+	if config.Indent == 0 {
+		return defaultIndent, nil
+	}
+	if config.Indent < minIndent || config.Indent > maxIndent {
+		return 0, fmt.Errorf("indent must be between %d and %d, got %d", minIndent, maxIndent, config.Indent)
+	}
+	return config.Indent, nil
+}
+
+// encode marshals the trimmed documents into the output format
+func (config *Configuration) encode(documents []trimmedDocument, outputFormat string) ([]byte, error) {
+	indent, err := config.indent()
+	if err != nil {
+		return nil, err
+	}
+
+	var content []byte
+	switch outputFormat {
+	case FormatYAML:
+		content, err = encodeYAML(documents, indent, config.ExplicitStart, config.ExplicitEnd)
+	case FormatJSON:
+		nodes := make([]*yaml.Node, 0, len(documents))
+		for _, document := range documents {
+			nodes = append(nodes, document.output)
+		}
+		content, err = encodeJSON(nodes, indent)
+	default:
+		return nil, fmt.Errorf("unsupported output format: %q", outputFormat)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return normalizeLineEndings(content, config.LineEnding), nil
+}
+
+// TrimReader is like Trim, but reads the input from the given reader.
+func (config *Configuration) TrimReader(reader io.Reader) ([]byte, error) {
+	return config.TrimReaderContext(context.Background(), reader)
+}
+
+// TrimReaderContext is like TrimReader, but stops with the error of the context when it is canceled.
+// The reading itself is not interrupted, the reader has to be closed for that.
+func (config *Configuration) TrimReaderContext(ctx context.Context, reader io.Reader) ([]byte, error) {
+	input, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+	return config.TrimContext(ctx, input)
+}
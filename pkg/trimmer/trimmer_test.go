@@ -0,0 +1,3062 @@
+package trimmer
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_filterByRules(t *testing.T) {
+	tests := []struct {
+		name         string
+		rules        string
+		inputYAML    string
+		expectedYAML string
+		expectError  bool
+		errorMessage string
+	}{
+		{
+			name: "simple filtering",
+			inputYAML: `
+            cache:
+              enabled: true
+              path: /tmp
+            database:
+              host: localhost
+              port: 5432
+            `,
+			rules: `
+            include:
+              - key: cache`,
+			expectedYAML: `
+            cache:
+              enabled: true
+              path: /tmp
+            `,
+			expectError: false,
+		},
+		{
+			name: "nested filtering",
+			inputYAML: `
+            cache:
+              enabled: true
+            database:
+              host: localhost
+              port: 5432
+              credentials:
+                username: user
+                password: pass
+            `,
+			rules: `
+            include:
+              - key: database
+                include:
+                    - key: host
+                    - key: credentials
+                      include:
+                      - key: username    
+            `,
+			expectedYAML: `
+            database:
+              host: localhost
+              credentials:
+                username: user
+            `,
+			expectError: false,
+		},
+		{
+			name: "no matching keys",
+			rules: `
+            include:            
+              - key: nonexistent
+            `,
+			inputYAML: `
+            cache:
+              enabled: true
+            database:
+              host: localhost
+              port: 5432
+            `,
+			expectedYAML: `{}`,
+			expectError:  false,
+		},
+		{
+			name: "top-level exclude",
+			inputYAML: `
+            cache:
+              enabled: true
+            database:
+              host: localhost
+            status:
+              ready: true
+            `,
+			rules: `
+            exclude:
+              - key: status
+            `,
+			expectedYAML: `
+            cache:
+              enabled: true
+            database:
+              host: localhost
+            `,
+			expectError: false,
+		},
+		{
+			name: "nested exclude",
+			inputYAML: `
+            metadata:
+              name: foo
+              managedFields:
+                - manager: kubectl
+            spec:
+              replicas: 1
+            status:
+              ready: true
+            `,
+			rules: `
+            exclude:
+              - key: metadata
+                exclude:
+                  - key: managedFields
+              - key: status
+            `,
+			expectedYAML: `
+            metadata:
+              name: foo
+            spec:
+              replicas: 1
+            `,
+			expectError: false,
+		},
+		{
+			name: "include wins over exclude on the same level",
+			inputYAML: `
+            metadata:
+              name: foo
+              managedFields:
+                - manager: kubectl
+            spec:
+              replicas: 1
+            status:
+              ready: true
+            `,
+			rules: `
+            include:
+              - key: metadata
+              - key: status
+            exclude:
+              - key: metadata
+                exclude:
+                  - key: managedFields
+              - key: status
+            `,
+			expectedYAML: `
+            metadata:
+              name: foo
+            status:
+              ready: true
+            `,
+			expectError: false,
+		},
+		{
+			name: "exclude within an include rule",
+			inputYAML: `
+            database:
+              host: localhost
+              port: 5432
+              credentials:
+                username: user
+                password: pass
+            `,
+			rules: `
+            include:
+              - key: database
+                exclude:
+                  - key: credentials
+                    exclude:
+                      - key: password
+            `,
+			expectedYAML: `
+            database:
+              host: localhost
+              port: 5432
+              credentials:
+                username: user
+            `,
+			expectError: false,
+		},
+		{
+			name: "wildcard matching several keys",
+			inputYAML: `
+            container-0:
+              name: foo
+              image: foo:latest
+            container-1:
+              name: bar
+              image: bar:latest
+            volume-0:
+              name: data
+            `,
+			rules: `
+            include:
+              - key: "container-*"
+                include:
+                  - key: image
+            `,
+			expectedYAML: `
+            container-0:
+              image: foo:latest
+            container-1:
+              image: bar:latest
+            `,
+			expectError: false,
+		},
+		{
+			name: "wildcard matching a single character",
+			inputYAML: `
+            container-0: foo
+            container-10: bar
+            `,
+			rules: `
+            include:
+              - key: "container-?"
+            `,
+			expectedYAML: `
+            container-0: foo
+            `,
+			expectError: false,
+		},
+		{
+			name: "wildcard matching nothing",
+			inputYAML: `
+            container-0: foo
+            container-1: bar
+            `,
+			rules: `
+            include:
+              - key: "volume-*"
+            `,
+			expectedYAML: `{}`,
+			expectError:  false,
+		},
+		{
+			name: "nested include on a scalar",
+			inputYAML: `
+            cache:
+              enabled: true
+            database: localhost
+            `,
+			rules: `
+            include:
+              - key: database
+                include:
+                  - key: host
+            `,
+			expectError:  true,
+			errorMessage: "input node is not a mapping node at line 3, column 11",
+		},
+		{
+			name: "sequence of mappings",
+			inputYAML: `
+            containers:
+              - name: foo
+                image: foo:latest
+                env:
+                  - name: FOO
+                    value: bar
+              - name: bar
+                image: bar:latest
+            volumes:
+              - name: data
+            `,
+			rules: `
+            include:
+              - key: containers
+                include:
+                  - key: name
+                  - key: image
+            `,
+			expectedYAML: `
+            containers:
+              - name: foo
+                image: foo:latest
+              - name: bar
+                image: bar:latest
+            `,
+			expectError: false,
+		},
+		{
+			name: "nested sequences",
+			inputYAML: `
+            spec:
+              containers:
+                - name: foo
+                  ports:
+                    - containerPort: 80
+                      protocol: TCP
+                    - containerPort: 443
+                      protocol: TCP
+            `,
+			rules: `
+            include:
+              - key: spec
+                include:
+                  - key: containers
+                    include:
+                      - key: ports
+                        include:
+                          - key: containerPort
+            `,
+			expectedYAML: `
+            spec:
+              containers:
+                - ports:
+                    - containerPort: 80
+                    - containerPort: 443
+            `,
+			expectError: false,
+		},
+		{
+			name: "exclude in a sequence of mappings",
+			inputYAML: `
+            containers:
+              - name: foo
+                env:
+                  - name: FOO
+              - name: bar
+            `,
+			rules: `
+            exclude:
+              - key: containers
+                exclude:
+                  - key: env
+            `,
+			expectedYAML: `
+            containers:
+              - name: foo
+              - name: bar
+            `,
+			expectError: false,
+		},
+		{
+			name: "sequence index",
+			inputYAML: `
+            containers:
+              - name: foo
+                image: foo:latest
+              - name: bar
+                image: bar:latest
+              - name: baz
+                image: baz:latest
+            `,
+			rules: `
+            include:
+              - key: containers
+                index: 1
+                include:
+                  - key: name
+            `,
+			expectedYAML: `
+            containers:
+              - name: bar
+            `,
+			expectError: false,
+		},
+		{
+			name: "negative sequence index",
+			inputYAML: `
+            containers:
+              - name: foo
+                image: foo:latest
+              - name: bar
+                image: bar:latest
+              - name: baz
+                image: baz:latest
+            `,
+			rules: `
+            include:
+              - key: containers
+                index: -1
+            `,
+			expectedYAML: `
+            containers:
+              - name: baz
+                image: baz:latest
+            `,
+			expectError: false,
+		},
+		{
+			name: "out of range sequence index",
+			inputYAML: `
+            containers:
+              - name: foo
+                image: foo:latest
+              - name: bar
+                image: bar:latest
+              - name: baz
+                image: baz:latest
+            `,
+			rules: `
+            include:
+              - key: containers
+                index: 3
+            `,
+			expectedYAML: `{}`,
+			expectError:  false,
+		},
+		{
+			name: "out of range sequence index in strict mode",
+			inputYAML: `
+            containers:
+              - name: foo
+                image: foo:latest
+              - name: bar
+                image: bar:latest
+              - name: baz
+                image: baz:latest
+            `,
+			rules: `
+            strict: true
+            include:
+              - key: containers
+                index: -4
+            `,
+			expectError:  true,
+			errorMessage: `index -4 is out of range for key "containers" with 3 elements at line 2, column 3`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inputNode yaml.Node
+			err := yaml.Unmarshal([]byte(unindent(tt.inputYAML)), &inputNode)
+			if err != nil {
+				t.Fatalf("failed to unmarshal input YAML: %v", err)
+			}
+
+			var outputNode yaml.Node
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+
+			// Call the function under test
+			f := &filter{config: config}
+			err = f.filterByRules(config.Include, config.Exclude, "", inputNode.Content[0], &outputNode)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				if !strings.Contains(err.Error(), tt.errorMessage) {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// Marshal the output node to YAML for comparison
+			var outputBuffer bytes.Buffer
+			encoder := yaml.NewEncoder(&outputBuffer)
+			encoder.SetIndent(2)
+			err = encoder.Encode(&outputNode)
+			if err != nil {
+				t.Fatalf("failed to marshal output YAML: %v", err)
+			}
+
+			// Compare the output
+			gotYAML := unindent(outputBuffer.String())
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
+
+func Test_trim(t *testing.T) {
+	tests := []struct {
+		name               string
+		rules              string
+		inputYAML          string
+		expectedYAML       string
+		dropEmptyDocuments bool
+	}{
+		{
+			name: "multiple documents",
+			inputYAML: `
+            name: first
+            kind: A
+            ---
+            name: second
+            kind: B
+            ---
+            name: third
+            kind: C
+            `,
+			rules: `
+            include:
+              - key: name
+            `,
+			expectedYAML: `
+            name: first
+            ---
+            name: second
+            ---
+            name: third
+            `,
+		},
+		{
+			name: "keep empty documents",
+			inputYAML: `
+            name: first
+            ---
+            kind: B
+            ---
+            name: third
+            `,
+			rules: `
+            include:
+              - key: name
+            `,
+			expectedYAML: `
+            name: first
+            ---
+            {}
+            ---
+            name: third
+            `,
+		},
+		{
+			name: "drop empty documents",
+			inputYAML: `
+            name: first
+            ---
+            kind: B
+            ---
+            name: third
+            `,
+			rules: `
+            include:
+              - key: name
+            `,
+			expectedYAML: `
+            name: first
+            ---
+            name: third
+            `,
+			dropEmptyDocuments: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+			config.DropEmptyDocuments = tt.dropEmptyDocuments
+
+			// Call the function under test
+			output, err := config.Trim([]byte(unindent(tt.inputYAML)))
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			// Compare the output
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
+
+func Test_TrimReader(t *testing.T) {
+	config := Configuration{
+		Include: []IncludeItem{
+			{Key: "database", Include: []IncludeItem{{Key: "host"}}},
+		},
+	}
+
+	input := strings.NewReader(unindent(`
+    cache:
+      enabled: true
+    database:
+      host: localhost
+      port: 5432
+    `))
+
+	output, err := config.TrimReader(input)
+	if err != nil {
+		t.Fatalf("failed to trim input YAML: %v", err)
+	}
+
+	gotYAML := unindent(string(output))
+	expectedYAML := unindent(`
+    database:
+      host: localhost
+    `)
+	if gotYAML != expectedYAML {
+		t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+	}
+}
+
+func Test_expandDottedKeys(t *testing.T) {
+	tests := []struct {
+		name        string
+		dottedRules string
+		nestedRules string
+		inputYAML   string
+	}{
+		{
+			name: "dotted key",
+			dottedRules: `
+            include:
+              - key: database.credentials.username
+            `,
+			nestedRules: `
+            include:
+              - key: database
+                include:
+                  - key: credentials
+                    include:
+                      - key: username
+            `,
+			inputYAML: `
+            cache:
+              enabled: true
+            database:
+              host: localhost
+              credentials:
+                username: user
+                password: pass
+            `,
+		},
+		{
+			name: "dotted keys sharing a prefix",
+			dottedRules: `
+            include:
+              - key: database.host
+              - key: cache
+              - key: database.credentials.username
+            `,
+			nestedRules: `
+            include:
+              - key: database
+                include:
+                  - key: host
+                  - key: credentials
+                    include:
+                      - key: username
+              - key: cache
+            `,
+			inputYAML: `
+            cache:
+              enabled: true
+            database:
+              host: localhost
+              port: 5432
+              credentials:
+                username: user
+                password: pass
+            `,
+		},
+		{
+			name: "escaped dot",
+			dottedRules: `
+            include:
+              - key: hosts.example\.com.port
+            `,
+			nestedRules: `
+            include:
+              - key: hosts
+                include:
+                  - key: example\.com
+                    include:
+                      - key: port
+            `,
+			inputYAML: `
+            hosts:
+              example.com:
+                port: 443
+                tls: true
+              example:
+                com: foo
+            `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dottedConfig, err := parseRules(unindent(tt.dottedRules))
+			if err != nil {
+				t.Fatalf("failed to parse dotted rules: %v", err)
+			}
+			nestedConfig, err := parseRules(unindent(tt.nestedRules))
+			if err != nil {
+				t.Fatalf("failed to parse nested rules: %v", err)
+			}
+
+			dottedOutput, err := dottedConfig.Trim([]byte(unindent(tt.inputYAML)))
+			if err != nil {
+				t.Fatalf("failed to trim with dotted rules: %v", err)
+			}
+			nestedOutput, err := nestedConfig.Trim([]byte(unindent(tt.inputYAML)))
+			if err != nil {
+				t.Fatalf("failed to trim with nested rules: %v", err)
+			}
+
+			if !bytes.Equal(dottedOutput, nestedOutput) {
+				t.Errorf("dotted and nested rules produce different output:\nDotted:\n%s\nNested:\n%s", dottedOutput, nestedOutput)
+			}
+			if len(bytes.TrimSpace(nestedOutput)) <= len("{}") {
+				t.Errorf("expected a non-empty output, got:\n%s", nestedOutput)
+			}
+		})
+	}
+}
+
+func Test_comments(t *testing.T) {
+	input := unindent(`
+    # head of the document
+
+    # head of cache
+    cache:
+      enabled: true # line of enabled
+    # head of database
+    database:
+      # head of host
+      host: localhost # line of host
+      port: 5432
+    `)
+
+	tests := []struct {
+		name          string
+		stripComments bool
+		expectedYAML  string
+	}{
+		{
+			name: "preserve comments",
+			expectedYAML: `
+            # head of the document
+
+            # head of database
+            database:
+              # head of host
+              host: localhost # line of host
+            `,
+		},
+		{
+			name:          "strip comments",
+			stripComments: true,
+			expectedYAML: `
+            database:
+              host: localhost
+            `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Configuration{
+				Include:       []IncludeItem{{Key: "database.host"}},
+				StripComments: tt.stripComments,
+			}
+
+			output, err := config.Trim([]byte(input))
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
+
+func Test_strict(t *testing.T) {
+	input := unindent(`
+    cache:
+      enabled: true
+    database:
+      host: localhost
+      credentials:
+        username: user
+    containers:
+      - name: foo
+        image: foo:latest
+      - name: bar
+    `)
+	rules := unindent(`
+    include:
+      - key: cache
+      - key: databse
+      - key: database
+        include:
+          - key: host
+          - key: credentials
+            include:
+              - key: user
+      - key: containers
+        include:
+          - key: image
+    `)
+
+	tests := []struct {
+		name         string
+		strict       bool
+		expectedYAML string
+		errorMessage string
+	}{
+		{
+			name: "non-strict skips missing keys",
+			expectedYAML: `
+            cache:
+              enabled: true
+            database:
+              host: localhost
+              credentials: {}
+            containers:
+              - image: foo:latest
+              - {}
+            `,
+		},
+		{
+			name:         "strict fails on missing keys",
+			strict:       true,
+			errorMessage: "rules matched nothing in input YAML document 0: databse, database.credentials.user, containers[1].image",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(rules)
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+			config.Strict = tt.strict
+
+			output, err := config.Trim([]byte(input))
+			if tt.errorMessage != "" {
+				if err == nil || err.Error() != tt.errorMessage {
+					t.Fatalf("unexpected error: %v, expected: %s", err, tt.errorMessage)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
+
+func Test_caseInsensitive(t *testing.T) {
+	input := unindent(`
+    Cache:
+      Enabled: true
+      path: /tmp
+    database:
+      host: localhost
+    `)
+
+	tests := []struct {
+		name            string
+		caseInsensitive bool
+		expectedYAML    string
+	}{
+		{
+			name:            "case insensitive",
+			caseInsensitive: true,
+			expectedYAML: `
+            Cache:
+              Enabled: true
+            `,
+		},
+		{
+			name:            "case sensitive",
+			caseInsensitive: false,
+			expectedYAML:    `{}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Configuration{
+				Include:         []IncludeItem{{Key: "cache", Include: []IncludeItem{{Key: "enabled"}}}},
+				CaseInsensitive: tt.caseInsensitive,
+			}
+
+			output, err := config.Trim([]byte(input))
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
+
+func Test_keyRegex(t *testing.T) {
+	input := unindent(`
+    env-db-secret:
+      value: foo
+      source: vault
+    env-api-secret:
+      value: bar
+      source: vault
+    env-db-host: localhost
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		expectedYAML string
+		errorMessage string
+	}{
+		{
+			name: "regex matching multiple keys",
+			rules: `
+            include:
+              - keyRegex: ^env-.*-secret$
+                include:
+                  - key: value
+            `,
+			expectedYAML: `
+            env-db-secret:
+              value: foo
+            env-api-secret:
+              value: bar
+            `,
+		},
+		{
+			name: "regex matching nothing",
+			rules: `
+            include:
+              - keyRegex: ^secret-
+            `,
+			expectedYAML: `{}`,
+		},
+		{
+			name: "invalid regex",
+			rules: `
+            include:
+              - key: env-db-secret
+                include:
+                  - keyRegex: ^env-(
+            `,
+			errorMessage: "invalid keyRegex \"^env-(\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+
+			output, err := config.Trim([]byte(input))
+			if tt.errorMessage != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMessage) {
+					t.Fatalf("unexpected error: %v, expected: %s", err, tt.errorMessage)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
+
+func Test_aliases(t *testing.T) {
+	tests := []struct {
+		name         string
+		inputYAML    string
+		rules        string
+		expectedYAML string
+	}{
+		{
+			name: "anchor under a dropped key",
+			inputYAML: `
+            defaults: &defaults
+              timeout: 30
+              retries: 3
+            service:
+              settings: *defaults
+              name: foo
+            `,
+			rules: `
+            include:
+              - key: service
+            `,
+			expectedYAML: `
+            service:
+              settings:
+                timeout: 30
+                retries: 3
+              name: foo
+            `,
+		},
+		{
+			name: "anchor under a retained key",
+			inputYAML: `
+            defaults: &defaults
+              timeout: 30
+            service:
+              settings: *defaults
+              name: foo
+            `,
+			rules: `
+            include:
+              - key: defaults
+              - key: service
+                include:
+                  - key: settings
+            `,
+			expectedYAML: `
+            defaults: &defaults
+              timeout: 30
+            service:
+              settings: *defaults
+            `,
+		},
+		{
+			name: "anchor defined after the alias in the output",
+			inputYAML: `
+            image: &image foo:latest
+            service:
+              image: *image
+            `,
+			rules: `
+            include:
+              - key: service
+              - key: image
+            `,
+			expectedYAML: `
+            service:
+              image: foo:latest
+            image: &image foo:latest
+            `,
+		},
+		{
+			name: "nested aliases",
+			inputYAML: `
+            internal:
+              port: &port 8080
+              defaults: &defaults
+                port: *port
+            service:
+              settings: *defaults
+            `,
+			rules: `
+            include:
+              - key: service
+            `,
+			expectedYAML: `
+            service:
+              settings:
+                port: 8080
+            `,
+		},
+		{
+			name: "nested rules under an aliased mapping",
+			inputYAML: `
+            database: &db
+              host: db.example.com
+              port: 5432
+            replica: *db
+            `,
+			rules: `
+            include:
+              - key: database
+              - key: replica
+                include:
+                  - key: host
+            `,
+			expectedYAML: `
+            database: &db
+              host: db.example.com
+              port: 5432
+            replica:
+              host: db.example.com
+            `,
+		},
+		{
+			name: "nested rules under an aliased sequence element",
+			inputYAML: `
+            primary: &primary
+              name: foo
+              port: 8080
+            servers:
+              - *primary
+              - name: bar
+                port: 9090
+            `,
+			rules: `
+            include:
+              - key: servers
+                include:
+                  - key: name
+            `,
+			expectedYAML: `
+            servers:
+              - name: foo
+              - name: bar
+            `,
+		},
+		{
+			name: "nested exclusions under an aliased mapping",
+			inputYAML: `
+            database: &db
+              host: db.example.com
+              password: secret
+            replica: *db
+            `,
+			rules: `
+            exclude:
+              - key: database
+              - key: replica
+                exclude:
+                  - key: password
+            `,
+			expectedYAML: `
+            replica:
+              host: db.example.com
+            `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+
+			output, err := config.Trim([]byte(unindent(tt.inputYAML)))
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			// The output must be valid YAML on its own
+			var reparsed yaml.Node
+			if err := yaml.Unmarshal(output, &reparsed); err != nil {
+				t.Fatalf("failed to parse the output YAML: %v\n%s", err, output)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
+
+func Test_styles(t *testing.T) {
+	input := unindent(`
+    config:
+      single: 'single quoted'
+      double: "double quoted"
+      plain: plain
+      folded: >-
+        folded text
+      literal: |
+        line one
+        line two
+      flow: {a: 1, b: "two", c: 3}
+      list: ['one', "two"]
+      tagged: !custom
+        a: 1
+        b: 2
+      dropped: true
+    `)
+
+	config := Configuration{
+		Include: []IncludeItem{{
+			Key: "config",
+			Exclude: []ExcludeItem{
+				{Key: "dropped"},
+				{Key: "flow", Exclude: []ExcludeItem{{Key: "c"}}},
+				{Key: "tagged", Exclude: []ExcludeItem{{Key: "b"}}},
+			},
+		}},
+	}
+
+	output, err := config.Trim([]byte(input))
+	if err != nil {
+		t.Fatalf("failed to trim input YAML: %v", err)
+	}
+
+	expectedYAML := unindent(`
+    config:
+      single: 'single quoted'
+      double: "double quoted"
+      plain: plain
+      folded: >-
+        folded text
+      literal: |
+        line one
+        line two
+      flow: {a: 1, b: "two"}
+      list: ['one', "two"]
+      tagged: !custom
+        a: 1
+    `)
+	gotYAML := unindent(string(output))
+	if gotYAML != expectedYAML {
+		t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+	}
+}
+
+func Test_rename(t *testing.T) {
+	input := unindent(`
+    database:
+      host: localhost
+      port: 5432
+    db: old
+    cache:
+      enabled: true
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		expectedYAML string
+		errorMessage string
+	}{
+		{
+			name: "top-level rename",
+			rules: `
+            include:
+              - key: database
+                as: settings
+                include:
+                  - key: host
+            `,
+			expectedYAML: `
+            settings:
+              host: localhost
+            `,
+		},
+		{
+			name: "nested rename",
+			rules: `
+            include:
+              - key: database
+                include:
+                  - key: host
+                    as: hostname
+              - key: cache.enabled
+                as: active
+            `,
+			expectedYAML: `
+            database:
+              hostname: localhost
+            cache:
+              active: true
+            `,
+		},
+		{
+			name: "collision",
+			rules: `
+            include:
+              - key: database
+                as: db
+              - key: db
+            `,
+			errorMessage: `key "database" renamed to "db" collides with an existing key at db`,
+		},
+		{
+			name: "collision with overwrite",
+			rules: `
+            include:
+              - key: db
+              - key: database
+                as: db
+                overwrite: true
+                include:
+                  - key: port
+            `,
+			expectedYAML: `
+            db:
+              port: 5432
+            `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+
+			output, err := config.Trim([]byte(input))
+			if tt.errorMessage != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMessage) {
+					t.Errorf("expected error containing %q, got: %v", tt.errorMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
+
+func Test_sortKeys(t *testing.T) {
+	input := unindent(`
+    zone: eu
+    database:
+      port: 5432
+      host: localhost
+      replicas:
+        - name: b
+          id: 2
+        - name: a
+          id: 1
+    cache:
+      enabled: true
+    `)
+
+	rules := [][]IncludeItem{
+		{{Key: "zone"}, {Key: "database"}, {Key: "cache"}},
+		{{Key: "cache"}, {Key: "database"}, {Key: "zone"}},
+	}
+
+	expectedYAML := unindent(`
+    cache:
+      enabled: true
+    database:
+      host: localhost
+      port: 5432
+      replicas:
+        - id: 2
+          name: b
+        - id: 1
+          name: a
+    zone: eu
+    `)
+
+	for _, include := range rules {
+		config := Configuration{Include: include, SortKeys: true}
+		output, err := config.Trim([]byte(input))
+		if err != nil {
+			t.Fatalf("failed to trim input YAML: %v", err)
+		}
+
+		gotYAML := unindent(string(output))
+		if gotYAML != expectedYAML {
+			t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+		}
+	}
+}
+
+func Test_preserveOrder(t *testing.T) {
+	input := unindent(`
+    apiVersion: v1
+    kind: Service
+    metadata:
+      name: web
+      namespace: default
+      labels:
+        app: web
+    spec:
+      type: ClusterIP
+    `)
+
+	tests := []struct {
+		name          string
+		preserveOrder bool
+		expectedYAML  string
+	}{
+		{
+			name: "rule order",
+			expectedYAML: `
+            metadata:
+              labels:
+                app: web
+              name: web
+            kind: Service
+            apiVersion: v1
+            `,
+		},
+		{
+			name:          "input order",
+			preserveOrder: true,
+			expectedYAML: `
+            apiVersion: v1
+            kind: Service
+            metadata:
+              name: web
+              labels:
+                app: web
+            `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Configuration{
+				Include: []IncludeItem{
+					{Key: "metadata", Include: []IncludeItem{{Key: "labels"}, {Key: "name"}}},
+					{Key: "kind"},
+					{Key: "apiVersion"},
+				},
+				PreserveOrder: tt.preserveOrder,
+			}
+
+			output, err := config.Trim([]byte(input))
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
+
+func Test_where(t *testing.T) {
+	input := unindent(`
+    containers:
+      - name: app
+        image: app:1.0
+      - name: istio-proxy
+        image: istio/proxyv2
+        resources:
+          limits:
+            cpu: 100m
+      - name: istio-proxy
+        image: istio/proxyv2:debug
+      - image: unnamed
+    volumes:
+      - name: data
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		expectedYAML string
+		errorMessage string
+	}{
+		{
+			name: "matching elements",
+			rules: `
+            include:
+              - key: containers
+                where:
+                  field: name
+                  value: istio-proxy
+                include:
+                  - key: image
+            `,
+			expectedYAML: `
+            containers:
+              - image: istio/proxyv2
+              - image: istio/proxyv2:debug
+            `,
+		},
+		{
+			name: "nested field",
+			rules: `
+            include:
+              - key: containers
+                where:
+                  field: resources.limits.cpu
+                  value: 100m
+                include:
+                  - key: name
+            `,
+			expectedYAML: `
+            containers:
+              - name: istio-proxy
+            `,
+		},
+		{
+			name: "with index",
+			rules: `
+            include:
+              - key: containers
+                where:
+                  field: name
+                  value: istio-proxy
+                index: -1
+            `,
+			expectedYAML: `
+            containers:
+              - name: istio-proxy
+                image: istio/proxyv2:debug
+            `,
+		},
+		{
+			name: "no match",
+			rules: `
+            include:
+              - key: volumes
+                where:
+                  field: name
+                  value: logs
+            `,
+			expectedYAML: `
+            volumes: []
+            `,
+		},
+		{
+			name: "not a sequence",
+			rules: `
+            include:
+              - key: containers
+                include:
+                  - key: name
+                    where:
+                      field: foo
+                      value: bar
+            `,
+			errorMessage: `value of key "name" is not a sequence node at line 2, column 11`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+
+			output, err := config.Trim([]byte(input))
+			if tt.errorMessage != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMessage) {
+					t.Errorf("expected error containing %q, got: %v", tt.errorMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
+
+func Test_where_typed(t *testing.T) {
+	input := unindent(`
+    listeners:
+      - name: https
+        port: 443
+        enabled: true
+      - name: quoted
+        port: "443"
+        enabled: "true"
+      - name: hex
+        port: 0x1BB
+        enabled: false
+      - name: http
+        port: 80
+        enabled: True
+    `)
+
+	tests := []struct {
+		name          string
+		rules         string
+		expectedNames []string
+	}{
+		{
+			name: "integer",
+			rules: `
+            include:
+              - key: listeners
+                where:
+                  field: port
+                  value: 443
+                include:
+                  - key: name
+            `,
+			expectedNames: []string{"https", "hex"},
+		},
+		{
+			name: "boolean",
+			rules: `
+            include:
+              - key: listeners
+                where:
+                  field: enabled
+                  value: true
+                include:
+                  - key: name
+            `,
+			expectedNames: []string{"https", "http"},
+		},
+		{
+			name: "string",
+			rules: `
+            include:
+              - key: listeners
+                where:
+                  field: port
+                  value: "443"
+                include:
+                  - key: name
+            `,
+			expectedNames: []string{"https", "quoted"},
+		},
+		{
+			name: "quoted boolean",
+			rules: `
+            include:
+              - key: listeners
+                where:
+                  field: enabled
+                  value: "true"
+                include:
+                  - key: name
+            `,
+			expectedNames: []string{"https", "quoted"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+
+			output, err := config.Trim([]byte(input))
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			expectedYAML := "listeners:\n"
+			for _, name := range tt.expectedNames {
+				expectedYAML += "  - name: " + name + "\n"
+			}
+			if string(output) != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", output, expectedYAML)
+			}
+		})
+	}
+}
+
+func Test_TrimDocuments(t *testing.T) {
+	input := unindent(`
+    metadata:
+      name: first
+    spec: 1
+    ---
+    spec: 2
+    `)
+
+	config := &Configuration{Include: []IncludeItem{{Key: "spec"}}}
+	documents, err := config.TrimDocuments([]byte(input), "metadata.name")
+	if err != nil {
+		t.Fatalf("failed to trim input YAML: %v", err)
+	}
+
+	expected := []Document{
+		{Name: "first", Content: []byte("spec: 1\n"), Format: FormatYAML},
+		{Name: "", Content: []byte("spec: 2\n"), Format: FormatYAML},
+	}
+	if !reflect.DeepEqual(documents, expected) {
+		t.Errorf("unexpected documents:\nGot:\n%+v\nExpected:\n%+v", documents, expected)
+	}
+}
+
+func Test_emptyPolicies(t *testing.T) {
+	input := unindent(`
+    name: app
+    database:
+      host: localhost
+      port: 5432
+    servers:
+      - host: a
+      - host: b
+        port: 80
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		expectedYAML string
+		errorMessage string
+	}{
+		{
+			name: "keep by default",
+			rules: `
+            include:
+              - key: name
+              - key: database
+                include:
+                  - key: user
+              - key: servers
+                include:
+                  - key: port
+            `,
+			expectedYAML: `
+            name: app
+            database: {}
+            servers:
+              - {}
+              - port: 80
+            `,
+		},
+		{
+			name: "drop branches",
+			rules: `
+            emptyBranches: drop
+            include:
+              - key: name
+              - key: database
+                include:
+                  - key: user
+              - key: servers
+                include:
+                  - key: port
+            `,
+			expectedYAML: `
+            name: app
+            servers:
+              - port: 80
+            `,
+		},
+		{
+			name: "drop branches emptied by exclusions",
+			rules: `
+            emptyBranches: drop
+            exclude:
+              - key: database
+                exclude:
+                  - key: host
+                  - key: port
+            `,
+			expectedYAML: `
+            name: app
+            servers:
+              - host: a
+              - host: b
+                port: 80
+            `,
+		},
+		{
+			name: "keep branches and documents",
+			rules: `
+            emptyBranches: keep
+            emptyDocuments: keep
+            include:
+              - key: database
+                include:
+                  - key: user
+            `,
+			expectedYAML: `
+            database: {}
+            `,
+		},
+		{
+			name: "drop branches and documents",
+			rules: `
+            emptyBranches: drop
+            emptyDocuments: drop
+            include:
+              - key: database
+                include:
+                  - key: user
+            `,
+			expectedYAML: ``,
+		},
+		{
+			name: "unsupported policy",
+			rules: `
+            emptyBranches: prune
+            include:
+              - key: name
+            `,
+			errorMessage: `emptyBranches: unsupported policy "prune"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+
+			output, err := config.Trim([]byte(input))
+			if tt.errorMessage != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMessage) {
+					t.Errorf("expected error containing %q, got: %v", tt.errorMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
+
+func Test_failOnEmptyResult(t *testing.T) {
+	config := Configuration{Include: []IncludeItem{{Key: "missing"}}}
+
+	// The empty result is written as "{}" by default
+	output, err := config.Trim([]byte("name: app\n"))
+	if err != nil {
+		t.Fatalf("failed to trim input YAML: %v", err)
+	}
+	if string(output) != "{}\n" {
+		t.Errorf("unexpected result: %q", string(output))
+	}
+
+	config.FailOnEmptyResult = true
+	if _, err := config.Trim([]byte("name: app\n---\nname: other\n")); err == nil || !strings.Contains(err.Error(), "the trimmed result is empty") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// A single document with a match is enough
+	if _, err := config.Trim([]byte("name: app\n---\nmissing: here\n")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_alwaysKeep(t *testing.T) {
+	input := unindent(`
+    apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: app
+      labels:
+        tier: web
+    data:
+      key: value
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		expectedYAML string
+	}{
+		{
+			name: "not in the rules",
+			rules: `
+            alwaysKeep: [apiVersion, kind]
+            include:
+              - key: data
+            `,
+			expectedYAML: `
+            data:
+              key: value
+            apiVersion: v1
+            kind: ConfigMap
+            `,
+		},
+		{
+			name: "also in the rules",
+			rules: `
+            alwaysKeep: [kind, metadata]
+            preserveOrder: true
+            include:
+              - key: kind
+              - key: metadata.name
+            `,
+			expectedYAML: `
+            kind: ConfigMap
+            metadata:
+              name: app
+              labels:
+                tier: web
+            `,
+		},
+		{
+			name: "excluded",
+			rules: `
+            alwaysKeep: [api*]
+            exclude:
+              - key: apiVersion
+              - key: metadata
+            `,
+			expectedYAML: `
+            apiVersion: v1
+            kind: ConfigMap
+            data:
+              key: value
+            `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+
+			output, err := config.Trim([]byte(input))
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
+
+func Test_annotateRemovals(t *testing.T) {
+	input := unindent(`
+    name: app
+    database:
+      host: localhost
+      port: 5432
+      password: secret
+    servers:
+      - host: a
+        port: 80
+    debug: true
+    `)
+
+	config, err := parseRules(unindent(`
+    annotateRemovals: true
+    include:
+      - key: name
+      - key: database.host
+      - key: servers
+        include:
+          - key: host
+    `))
+	if err != nil {
+		t.Fatalf("failed to parse rules: %v", err)
+	}
+
+	output, err := config.Trim([]byte(input))
+	if err != nil {
+		t.Fatalf("failed to trim input YAML: %v", err)
+	}
+
+	expectedYAML := unindent(`
+    # removed: debug
+    name: app
+    database:
+      # removed: port, password
+      host: localhost
+    servers:
+      # removed: port
+      - host: a
+    `)
+	if gotYAML := unindent(string(output)); gotYAML != expectedYAML {
+		t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+	}
+
+	// The annotated output is still valid YAML with the same content
+	var annotated, plain interface{}
+	if err := yaml.Unmarshal(output, &annotated); err != nil {
+		t.Fatalf("failed to parse the annotated output: %v", err)
+	}
+	config.AnnotateRemovals = false
+	plainOutput, err := config.Trim([]byte(input))
+	if err != nil {
+		t.Fatalf("failed to trim input YAML: %v", err)
+	}
+	if err := yaml.Unmarshal(plainOutput, &plain); err != nil {
+		t.Fatalf("failed to parse the output: %v", err)
+	}
+	if !reflect.DeepEqual(annotated, plain) {
+		t.Errorf("the annotated output differs from the plain one:\n%v\n%v", annotated, plain)
+	}
+}
+
+func Test_topLevelSequence(t *testing.T) {
+	input := unindent(`
+    - name: a
+      host: localhost
+      port: 80
+    - name: b
+      port: 8080
+      debug: true
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		expectedYAML string
+	}{
+		{
+			name: "include",
+			rules: `
+            include:
+              - key: name
+              - key: port
+            `,
+			expectedYAML: `
+            - name: a
+              port: 80
+            - name: b
+              port: 8080
+            `,
+		},
+		{
+			name: "exclude",
+			rules: `
+            exclude:
+              - key: port
+            `,
+			expectedYAML: `
+            - name: a
+              host: localhost
+            - name: b
+              debug: true
+            `,
+		},
+		{
+			name: "defaults and always kept keys",
+			rules: `
+            alwaysKeep: [name]
+            defaults:
+              debug: false
+            include:
+              - key: host
+            `,
+			expectedYAML: `
+            - host: localhost
+              name: a
+              debug: false
+            - name: b
+              debug: false
+            `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+
+			output, err := config.Trim([]byte(input))
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
+
+func Test_valueKind(t *testing.T) {
+	input := unindent(`
+    name: app
+    replicas: 3
+    database:
+      host: localhost
+      port: 5432
+    tags:
+      - web
+      - api
+    cache: &cache
+      enabled: true
+    session: *cache
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		expectedYAML string
+	}{
+		{
+			name: "scalar",
+			rules: `
+            include:
+              - key: "*"
+                valueKind: scalar
+            `,
+			expectedYAML: `
+            name: app
+            replicas: 3
+            `,
+		},
+		{
+			name: "mapping",
+			rules: `
+            include:
+              - key: "*"
+                valueKind: mapping
+            `,
+			expectedYAML: `
+            database:
+              host: localhost
+              port: 5432
+            cache: &cache
+              enabled: true
+            session: *cache
+            `,
+		},
+		{
+			name: "sequence",
+			rules: `
+            include:
+              - key: "*"
+                valueKind: sequence
+            `,
+			expectedYAML: `
+            tags:
+              - web
+              - api
+            `,
+		},
+		{
+			name: "nested",
+			rules: `
+            include:
+              - key: database
+                include:
+                  - keyRegex: "^(host|port)$"
+                    valueKind: scalar
+              - key: name
+                valueKind: mapping
+            `,
+			expectedYAML: `
+            database:
+              host: localhost
+              port: 5432
+            `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+
+			output, err := config.Trim([]byte(input))
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+
+	config := Configuration{Include: []IncludeItem{{Key: "name", ValueKind: "string"}}}
+	if _, err := config.Trim([]byte(input)); err == nil || !strings.Contains(err.Error(), `rule "name": unsupported valueKind "string"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_transform(t *testing.T) {
+	input := unindent(`
+    name: " Foo "
+    enabled: " true "
+    region: eu-west-1
+    owner: &owner " Team "
+    backup: *owner
+    database:
+      host: localhost
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		expectedYAML string
+	}{
+		{
+			name: "trim and lower",
+			rules: `
+            include:
+              - key: name
+                transform: trim,lower
+            `,
+			expectedYAML: `
+            name: foo
+            `,
+		},
+		{
+			name: "still needs quotes",
+			rules: `
+            include:
+              - key: enabled
+                transform: trim
+            `,
+			expectedYAML: `
+            enabled: "true"
+            `,
+		},
+		{
+			name: "upper in a nested rule",
+			rules: `
+            include:
+              - key: region
+                transform: upper
+              - key: database.host
+                transform: upper
+            `,
+			expectedYAML: `
+            region: EU-WEST-1
+            database:
+              host: LOCALHOST
+            `,
+		},
+		{
+			name: "alias",
+			rules: `
+            include:
+              - key: owner
+              - key: backup
+                transform: trim, upper
+            `,
+			expectedYAML: `
+            owner: &owner " Team "
+            backup: TEAM
+            `,
+		},
+		{
+			name: "not a scalar",
+			rules: `
+            include:
+              - key: database
+                transform: lower
+            `,
+			expectedYAML: `
+            database:
+              host: localhost
+            `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+
+			output, err := config.Trim([]byte(input))
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+
+	strict := Configuration{Include: []IncludeItem{{Key: "database", Transform: TransformLower}}, Strict: true}
+	if _, err := strict.Trim([]byte(input)); err == nil || !strings.Contains(err.Error(), `transform of "database" only applies to scalar values`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	unsupported := Configuration{Include: []IncludeItem{{Key: "name", Transform: "trim,title"}}}
+	if _, err := unsupported.Trim([]byte(input)); err == nil || !strings.Contains(err.Error(), `rule "name": unsupported transform "title"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_keys(t *testing.T) {
+	input := unindent(`
+    cache:
+      enabled: true
+    database:
+      host: localhost
+      port: 5432
+    logging:
+      level: info
+    services:
+      a1:
+        replicas: 1
+      b2:
+        replicas: 2
+      c3:
+        replicas: 3
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		expectedYAML string
+	}{
+		{
+			name: "top-level keys",
+			rules: `
+            include:
+              - keys: [cache, database]
+            `,
+			expectedYAML: `
+            cache:
+              enabled: true
+            database:
+              host: localhost
+              port: 5432
+            `,
+		},
+		{
+			name: "nested keys with nested rules",
+			rules: `
+            include:
+              - key: services
+                include:
+                  - keys: [a1, c3, d4]
+                    include:
+                      - key: replicas
+            `,
+			expectedYAML: `
+            services:
+              a1:
+                replicas: 1
+              c3:
+                replicas: 3
+            `,
+		},
+		{
+			name: "dotted keys",
+			rules: `
+            include:
+              - keys: [database.port, logging.level]
+            `,
+			expectedYAML: `
+            database:
+              port: 5432
+            logging:
+              level: info
+            `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+
+			output, err := config.Trim([]byte(input))
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+
+	both := Configuration{Include: []IncludeItem{{Key: "cache", Keys: []string{"database"}}}}
+	if _, err := both.Trim([]byte(input)); err == nil || !strings.Contains(err.Error(), `rule "cache": keys can't be used with key or keyRegex`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_tags(t *testing.T) {
+	input := unindent(`
+    certificate: !!binary aGVsbG8=
+    password: !vault |
+      abc123
+    port: !!str 5432
+    database: !custom
+      user: !vault admin
+      hosts: !hosts
+        - !host primary
+        - secondary
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		expectedYAML string
+	}{
+		{
+			name: "whole values",
+			rules: `
+            include:
+              - key: certificate
+              - key: password
+              - key: port
+            `,
+			expectedYAML: `
+            certificate: !!binary aGVsbG8=
+            password: !vault |
+              abc123
+            port: !!str 5432
+            `,
+		},
+		{
+			name: "filtered values",
+			rules: `
+            include:
+              - key: database.user
+                as: owner
+              - key: database.hosts
+                index: 0
+            `,
+			expectedYAML: `
+            database: !custom
+              owner: !vault admin
+              hosts: !hosts
+                - !host primary
+            `,
+		},
+		{
+			name: "transformed and sorted",
+			rules: `
+            sortKeys: true
+            include:
+              - key: password
+                transform: upper
+              - key: certificate
+            `,
+			expectedYAML: `
+            certificate: !!binary aGVsbG8=
+            password: !vault |
+              ABC123
+            `,
+		},
+		{
+			name: "custom tags stripped",
+			rules: `
+            stripCustomTags: true
+            include:
+              - key: certificate
+              - key: port
+              - key: database
+            `,
+			expectedYAML: `
+            certificate: !!binary aGVsbG8=
+            port: !!str 5432
+            database:
+              user: admin
+              hosts:
+                - primary
+                - secondary
+            `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+
+			output, err := config.Trim([]byte(input))
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
+
+func Test_coerce(t *testing.T) {
+	input := unindent(`
+    zip: 12345
+    port: "8080"
+    ratio: 1
+    enabled: "yes"
+    name: app
+    labels:
+      version: 2
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		strict       bool
+		expectedYAML string
+		errorMessage string
+	}{
+		{
+			name: "number to string",
+			rules: `
+            include:
+              - key: zip
+                coerce: str
+            `,
+			expectedYAML: `
+            zip: "12345"
+            `,
+		},
+		{
+			name: "quoted number to int",
+			rules: `
+            include:
+              - key: port
+                coerce: "!!int"
+            `,
+			expectedYAML: `
+            port: 8080
+            `,
+		},
+		{
+			name: "int to float",
+			rules: `
+            include:
+              - key: ratio
+                coerce: float
+            `,
+			expectedYAML: `
+            ratio: !!float 1
+            `,
+		},
+		{
+			name: "not a boolean",
+			rules: `
+            include:
+              - key: enabled
+                coerce: bool
+            `,
+			expectedYAML: `
+            enabled: "yes"
+            `,
+		},
+		{
+			name: "not a boolean in strict mode",
+			rules: `
+            include:
+              - key: enabled
+                coerce: bool
+            `,
+			strict:       true,
+			errorMessage: `value of "enabled" can't be coerced to !!bool at line 4, column 10`,
+		},
+		{
+			name: "recursive",
+			rules: `
+            include:
+              - key: version
+                recursive: true
+                coerce: str
+            `,
+			expectedYAML: `
+            labels:
+              version: "2"
+            `,
+		},
+		{
+			name: "unsupported",
+			rules: `
+            include:
+              - key: name
+                coerce: timestamp
+            `,
+			errorMessage: `rule "name": unsupported coerce "timestamp", expected "str", "int", "float" or "bool"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+			config.Strict = tt.strict
+
+			output, err := config.Trim([]byte(input))
+			if tt.errorMessage != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMessage) {
+					t.Errorf("expected error containing %q, got: %v", tt.errorMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
+
+func Test_duplicateKeys(t *testing.T) {
+	input := unindent(`
+    database:
+      host: localhost
+      port: 5432
+      user: admin
+    servers:
+      - name: a
+        port: 80
+      - name: b
+        port: 81
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		strict       bool
+		expectedYAML string
+		errorMessage string
+	}{
+		{
+			name: "nested includes are merged",
+			rules: `
+            include:
+              - key: database
+                include:
+                  - key: host
+              - key: database
+                include:
+                  - key: port
+            `,
+			expectedYAML: `
+            database:
+              host: localhost
+              port: 5432
+            `,
+		},
+		{
+			name: "nested includes are merged in strict mode",
+			rules: `
+            include:
+              - key: database
+                include:
+                  - key: host
+              - key: database
+                include:
+                  - key: port
+            `,
+			strict: true,
+			expectedYAML: `
+            database:
+              host: localhost
+              port: 5432
+            `,
+		},
+		{
+			name: "the whole value and a nested include",
+			rules: `
+            include:
+              - key: database
+                include:
+                  - key: host
+              - key: database
+            `,
+			expectedYAML: `
+            database:
+              host: localhost
+              port: 5432
+              user: admin
+            `,
+		},
+		{
+			name: "different options, first match wins",
+			rules: `
+            include:
+              - key: servers
+                index: 0
+              - key: servers
+                include:
+                  - key: name
+            `,
+			expectedYAML: `
+            servers:
+              - name: a
+                port: 80
+            `,
+		},
+		{
+			name: "different options in strict mode",
+			rules: `
+            include:
+              - key: servers
+                index: 0
+              - key: servers
+                include:
+                  - key: name
+            `,
+			strict:       true,
+			errorMessage: `rule "servers": key is listed more than once on the same level with different options, the rules can't be merged`,
+		},
+		{
+			name: "renamed duplicate",
+			rules: `
+            include:
+              - key: database.host
+                as: server
+              - key: database.host
+            `,
+			strict: true,
+			expectedYAML: `
+            database:
+              server: localhost
+              host: localhost
+            `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+			config.Strict = tt.strict
+
+			output, err := config.Trim([]byte(input))
+			if tt.errorMessage != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMessage) {
+					t.Errorf("expected error containing %q, got: %v", tt.errorMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
+
+func Test_anyOf(t *testing.T) {
+	input := unindent(`
+    database:
+      hostname: db.example.com
+      port: 5432
+    cache:
+      host: cache.example.com
+      hostname: cache
+    settings:
+      timeout: 30
+      retries: 3
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		strict       bool
+		expectedYAML string
+		errorMessage string
+	}{
+		{
+			name: "only the second alternative is present",
+			rules: `
+            include:
+              - key: database
+                include:
+                  - anyOf: [host, hostname]
+            `,
+			expectedYAML: `
+            database:
+              hostname: db.example.com
+            `,
+		},
+		{
+			name: "the first present alternative is preferred",
+			rules: `
+            include:
+              - key: cache
+                include:
+                  - anyOf: [host, hostname]
+            `,
+			expectedYAML: `
+            cache:
+              host: cache.example.com
+            `,
+		},
+		{
+			name: "nested includes of the present alternative",
+			rules: `
+            include:
+              - anyOf: [config, settings]
+                include:
+                  - key: timeout
+            `,
+			expectedYAML: `
+            settings:
+              timeout: 30
+            `,
+		},
+		{
+			name: "alternatives with patterns",
+			rules: `
+            include:
+              - key: cache
+                include:
+                  - anyOf: [address, host*]
+            `,
+			expectedYAML: `
+            cache:
+              host: cache.example.com
+              hostname: cache
+            `,
+		},
+		{
+			name: "default of a missing key",
+			rules: `
+            include:
+              - key: settings
+                include:
+                  - anyOf: [maxRetries, max_retries]
+                    default: 5
+            `,
+			expectedYAML: `
+            settings:
+              maxRetries: 5
+            `,
+		},
+		{
+			name: "none present in strict mode",
+			rules: `
+            include:
+              - key: settings
+                include:
+                  - anyOf: [maxRetries, max_retries]
+            `,
+			strict:       true,
+			errorMessage: "rules matched nothing in input YAML document 0: settings.maxRetries",
+		},
+		{
+			name: "with key",
+			rules: `
+            include:
+              - key: database
+                anyOf: [db, database]
+            `,
+			errorMessage: `rule "database": anyOf can't be used with key, keyRegex, keys or recursive`,
+		},
+		{
+			name: "dotted alternative",
+			rules: `
+            include:
+              - anyOf: [database.host, database.hostname]
+            `,
+			errorMessage: `rule "database.host|database.hostname": anyOf keys must be on a single level, "database.host" is a dotted path`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+			config.Strict = tt.strict
+
+			output, err := config.Trim([]byte(input))
+			if tt.errorMessage != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMessage) {
+					t.Errorf("expected error containing %q, got: %v", tt.errorMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
+
+func Test_where_aliases(t *testing.T) {
+	input := unindent(`
+    sidecar: &sidecar
+      name: istio-proxy
+      image: istio/proxyv2
+    proxy: &proxy istio-proxy
+    labels: &labels
+      app: istio-proxy
+    containers:
+      - name: app
+      - *sidecar
+      - name: *proxy
+        image: istio/proxyv2:debug
+      - labels: *labels
+        image: istio/proxyv2:labeled
+    jobs: &jobs
+      - name: migrate
+      - name: istio-proxy
+    copies: *jobs
+    `)
+
+	tests := []struct {
+		name         string
+		rules        string
+		expectedYAML string
+	}{
+		{
+			name: "aliased element and field",
+			rules: `
+            include:
+              - key: containers
+                where:
+                  field: name
+                  value: istio-proxy
+                include:
+                  - key: image
+            `,
+			expectedYAML: `
+            containers:
+              - image: istio/proxyv2
+              - image: istio/proxyv2:debug
+            `,
+		},
+		{
+			name: "aliased nested field",
+			rules: `
+            include:
+              - key: containers
+                where:
+                  field: labels.app
+                  value: istio-proxy
+                include:
+                  - key: image
+            `,
+			expectedYAML: `
+            containers:
+              - image: istio/proxyv2:labeled
+            `,
+		},
+		{
+			name: "aliased sequence",
+			rules: `
+            include:
+              - key: copies
+                where:
+                  field: name
+                  value: istio-proxy
+            `,
+			expectedYAML: `
+            copies:
+              - name: istio-proxy
+            `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseRules(unindent(tt.rules))
+			if err != nil {
+				t.Fatalf("failed to parse rules: %v", err)
+			}
+
+			output, err := config.Trim([]byte(input))
+			if err != nil {
+				t.Fatalf("failed to trim input YAML: %v", err)
+			}
+
+			gotYAML := unindent(string(output))
+			expectedYAML := unindent(tt.expectedYAML)
+			if gotYAML != expectedYAML {
+				t.Errorf("unexpected result:\nGot:\n%s\nExpected:\n%s", gotYAML, expectedYAML)
+			}
+		})
+	}
+}
+func unindent(inputYAML string) string {
+	inputYAML = strings.TrimLeft(inputYAML, "\n")
+
+	// replace tabs with spaces
+	inputYAML = strings.ReplaceAll(inputYAML, "\t", "    ")
+
+	// get the indent level from the first line
+	indent := 0
+	for _, c := range inputYAML {
+		if c == ' ' {
+			indent++
+		} else {
+			break
+		}
+	}
+
+	// unindent the input YAML
+	lines := strings.Split(inputYAML, "\n")
+	for i, line := range lines {
+		// blank lines may be shorter than the indent
+		if len(line) < indent {
+			lines[i] = strings.TrimLeft(line, " ")
+			continue
+		}
+		lines[i] = line[indent:]
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func parseRules(rules string) (*Configuration, error) {
+	var config Configuration
+	decoder := yaml.NewDecoder(strings.NewReader(rules))
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("error parsing YAML: %w", err)
+	}
+	return &config, nil
+}
@@ -0,0 +1,53 @@
+package trimmer
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UnmatchedRule is an include rule that matched nothing in a document of a sample input
+type UnmatchedRule struct {
+	// Path is the path of the rule in the document, the key of the rule after the path of the value it applies to
+	Path string
+
+	// Document is the index of the document in the sample input
+	Document int
+}
+
+// ValidateRules trims the sample input with the rules and returns the ones that matched nothing in its documents.
+// The rules under a sequence are tried on every element, so that they are returned once per element they matched nothing in.
+func ValidateRules(rules []IncludeItem, sample []byte) ([]UnmatchedRule, error) {
+	config := &Configuration{Include: rules}
+	return config.UnmatchedRules(sample)
+}
+
+// UnmatchedRules is like ValidateRules, but uses the rules and the options of the configuration,
+// like CaseInsensitive that changes what the rules match.
+func (config *Configuration) UnmatchedRules(sample []byte) ([]UnmatchedRule, error) {
+	rules, regexps, err := config.prepare()
+	if err != nil {
+		return nil, err
+	}
+
+	documents, err := decodeContent(sample, config.inputFormat(sample))
+	if err != nil {
+		return nil, err
+	}
+
+	var unmatched []UnmatchedRule
+	for i, root := range documents {
+		if isEmptyDocument(root) {
+			continue
+		}
+		var outputNode yaml.Node
+		filter := &filter{config: config, regexps: regexps}
+		if err := filter.filterRoot(rules, config.Exclude, root.Content[0], &outputNode); err != nil {
+			return nil, fmt.Errorf("failed to trim input YAML document %d: %w", i, err)
+		}
+		for _, path := range filter.unmatched {
+			unmatched = append(unmatched, UnmatchedRule{Path: path, Document: i})
+		}
+	}
+	return unmatched, nil
+}
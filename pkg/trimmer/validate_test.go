@@ -0,0 +1,78 @@
+package trimmer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_ValidateRules(t *testing.T) {
+	sample := []byte(unindent(`
+    database:
+      host: localhost
+      replicas:
+        - name: primary
+          port: 5432
+        - name: secondary
+    cache:
+      enabled: true
+    ---
+    database:
+      host: remote
+    `))
+
+	tests := []struct {
+		name     string
+		rules    []IncludeItem
+		expected []UnmatchedRule
+	}{
+		{
+			name:  "all rules match",
+			rules: []IncludeItem{{Key: "database.host"}},
+		},
+		{
+			name:  "missing in a document",
+			rules: []IncludeItem{{Key: "database.host"}, {Key: "cache"}},
+			expected: []UnmatchedRule{
+				{Path: "cache", Document: 1},
+			},
+		},
+		{
+			name: "some rules match",
+			rules: []IncludeItem{
+				{Key: "database", Include: []IncludeItem{{Key: "host"}, {Key: "user"}}},
+				{Key: "logging"},
+			},
+			expected: []UnmatchedRule{
+				{Path: "database.user", Document: 0},
+				{Path: "logging", Document: 0},
+				{Path: "database.user", Document: 1},
+				{Path: "logging", Document: 1},
+			},
+		},
+		{
+			name:  "in sequence elements",
+			rules: []IncludeItem{{Key: "database.replicas.port"}},
+			expected: []UnmatchedRule{
+				{Path: "database.replicas[1].port", Document: 0},
+				{Path: "database.replicas", Document: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unmatched, err := ValidateRules(tt.rules, sample)
+			if err != nil {
+				t.Fatalf("failed to validate rules: %v", err)
+			}
+			if !reflect.DeepEqual(unmatched, tt.expected) {
+				t.Errorf("unexpected unmatched rules:\nGot:      %+v\nExpected: %+v", unmatched, tt.expected)
+			}
+		})
+	}
+
+	if _, err := ValidateRules([]IncludeItem{{KeyRegex: "("}}, sample); err == nil || !strings.Contains(err.Error(), "invalid keyRegex") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}